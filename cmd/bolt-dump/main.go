@@ -0,0 +1,131 @@
+// Command bolt-dump decodes captured Bolt traffic: the handshake, the chunk
+// boundaries and the messages of every connection.
+//
+// The capture is either a pcap file, e.g. from tcpdump -w, or the raw bytes
+// a client sent. The raw bytes the server sent back can be given with
+// -server; captures that start after the handshake are decoded with the
+// version given by -version.
+//
+//	bolt-dump capture.pcap
+//	bolt-dump -type HELLO,LOGON,FAILURE -json capture.pcap
+//	bolt-dump -server server.bin client.bin
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"neo4j-proxy/pkg/bolt"
+	"neo4j-proxy/pkg/dump"
+)
+
+func main() {
+	var (
+		jsonOut     = flag.Bool("json", false, "write one JSON object per event")
+		types       = flag.String("type", "", "comma separated message types to show, e.g. RUN,PULL,FAILURE (also HANDSHAKE and NOOP)")
+		serverFile  = flag.String("server", "", "raw capture of the bytes the server sent")
+		version     = flag.String("version", "", "Bolt version of captures that start after the handshake, e.g. 5.4")
+		port        = flag.Int("port", 0, "only decode pcap connections to this server port; by default connections that start with a Bolt handshake")
+		credentials = flag.Bool("show-credentials", false, "show credentials instead of redacting them")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [capture]\n\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "Decodes a pcap capture or raw client bytes, read from stdin if capture is - or omitted.\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	opts := dump.Options{ShowCredentials: *credentials}
+	if *version != "" {
+		v, err := bolt.ParseVersion(*version)
+		if err != nil {
+			fatal(err)
+		}
+		opts.Version = v
+	}
+
+	conns, err := readCapture(flag.Arg(0), *serverFile, *port)
+	if err != nil {
+		fatal(err)
+	}
+
+	var filter []string
+	if *types != "" {
+		filter = strings.Split(*types, ",")
+	}
+	out := bufio.NewWriter(os.Stdout)
+	for _, conn := range conns {
+		events := dump.Filter(dump.Decode(conn, opts), filter)
+		if *jsonOut {
+			err = dump.WriteJSON(out, events)
+		} else {
+			err = dump.WriteText(out, events)
+		}
+		if err != nil {
+			fatal(err)
+		}
+	}
+	if err := out.Flush(); err != nil {
+		fatal(err)
+	}
+}
+
+// readCapture loads the connections to decode
+func readCapture(name, serverFile string, port int) ([]*dump.Conn, error) {
+	var client []byte
+	if name != "" || serverFile == "" {
+		data, err := readFile(name)
+		if err != nil {
+			return nil, err
+		}
+		client = data
+	}
+
+	if dump.IsPcap(client) {
+		if serverFile != "" {
+			return nil, fmt.Errorf("-server only applies to raw captures")
+		}
+		all, err := dump.ReadPcap(bytes.NewReader(client))
+		if err != nil {
+			return nil, err
+		}
+		var conns []*dump.Conn
+		for _, conn := range all {
+			if port == 0 && conn.HasHandshake() || port != 0 && strings.HasSuffix(conn.Server, fmt.Sprintf(":%d", port)) {
+				conns = append(conns, conn)
+			}
+		}
+		return conns, nil
+	}
+
+	conn := &dump.Conn{ClientData: []dump.Segment{{Data: client}}}
+	if serverFile != "" {
+		server, err := readFile(serverFile)
+		if err != nil {
+			return nil, err
+		}
+		conn.ServerData = []dump.Segment{{Data: server}}
+	}
+	return []*dump.Conn{conn}, nil
+}
+
+func readFile(name string) ([]byte, error) {
+	if name == "" || name == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(name)
+}
+
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "bolt-dump: %v\n", err)
+	os.Exit(1)
+}
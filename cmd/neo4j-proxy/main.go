@@ -0,0 +1,59 @@
+// Command neo4j-proxy runs the multi-tenant Bolt proxy. The configuration
+// is read from the file named by the CONFIG_FILE environment variable.
+//
+// "neo4j-proxy hash-password" instead reads a password from standard input
+// and prints the hash to put in a tenant's users table.
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"neo4j-proxy/internal/auth"
+	"neo4j-proxy/pkg/config"
+	"neo4j-proxy/pkg/proxy"
+)
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "hash-password" {
+		hashPassword()
+		return
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	p := proxy.New(cfg)
+	if err := p.Start(ctx); err != nil {
+		log.Fatalf("Proxy failed: %v", err)
+	}
+
+	log.Printf("Shutting down, waiting for open connections")
+	if err := p.Stop(); err != nil {
+		log.Fatalf("Failed to stop proxy: %v", err)
+	}
+}
+
+// hashPassword prints the hash of the first line of standard input
+func hashPassword() {
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		log.Fatalf("Failed to read password: %v", err)
+	}
+	hash, err := auth.HashPassword(strings.TrimRight(line, "\r\n"))
+	if err != nil {
+		log.Fatalf("Failed to hash password: %v", err)
+	}
+	fmt.Println(hash)
+}
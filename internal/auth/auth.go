@@ -10,6 +10,13 @@ type TenantExtractor interface {
 	ExtractTenantID(username, password string, metadata map[string]interface{}) (string, error)
 }
 
+// UserExtractor is a TenantExtractor that also determines the user a
+// login names, e.g. without the tenant prefix of tenant@user
+type UserExtractor interface {
+	TenantExtractor
+	ExtractTenantAndUser(username, password string, metadata map[string]interface{}) (tenantID, user string, err error)
+}
+
 // UsernameBasedExtractor extracts tenant ID from username prefix
 type UsernameBasedExtractor struct{}
 
@@ -18,27 +25,41 @@ func NewUsernameBasedExtractor() *UsernameBasedExtractor {
 	return &UsernameBasedExtractor{}
 }
 
+// SplitUsername splits a username of the form tenantID@user. ok is false
+// when the username has no tenant prefix.
+func SplitUsername(username string) (tenantID, user string, ok bool) {
+	tenantID, user, found := strings.Cut(username, "@")
+	if !found || tenantID == "" {
+		return "", username, false
+	}
+	return tenantID, user, true
+}
+
 // ExtractTenantID extracts tenant ID from username using format: tenantID@username
 func (e *UsernameBasedExtractor) ExtractTenantID(username, password string, metadata map[string]interface{}) (string, error) {
+	tenantID, _, err := e.ExtractTenantAndUser(username, password, metadata)
+	return tenantID, err
+}
+
+// ExtractTenantAndUser extracts tenant ID and user from username using
+// format: tenantID@username. Usernames without a tenant prefix are the user.
+func (e *UsernameBasedExtractor) ExtractTenantAndUser(username, password string, metadata map[string]interface{}) (string, string, error) {
 	if username == "" {
-		return "", errors.New("username is required")
+		return "", "", errors.New("username is required")
 	}
 
 	// Check if username contains tenant prefix (format: tenant@user)
-	if strings.Contains(username, "@") {
-		parts := strings.SplitN(username, "@", 2)
-		if len(parts) == 2 && parts[0] != "" {
-			return parts[0], nil
-		}
+	if tenantID, user, ok := SplitUsername(username); ok {
+		return tenantID, user, nil
 	}
 
 	// If no tenant prefix, try to extract from metadata or use default
 	if tenantID, ok := metadata["tenant_id"].(string); ok && tenantID != "" {
-		return tenantID, nil
+		return tenantID, username, nil
 	}
 
 	// Default to tenant1 if no explicit tenant specified
-	return "tenant1", nil
+	return "tenant1", username, nil
 }
 
 // DatabaseBasedExtractor extracts tenant ID from database name
@@ -51,21 +72,28 @@ func NewDatabaseBasedExtractor() *DatabaseBasedExtractor {
 
 // ExtractTenantID extracts tenant ID from database name in metadata
 func (e *DatabaseBasedExtractor) ExtractTenantID(username, password string, metadata map[string]interface{}) (string, error) {
+	tenantID, _, err := e.ExtractTenantAndUser(username, password, metadata)
+	return tenantID, err
+}
+
+// ExtractTenantAndUser extracts tenant ID from database name in metadata,
+// leaving the username as the user
+func (e *DatabaseBasedExtractor) ExtractTenantAndUser(username, password string, metadata map[string]interface{}) (string, string, error) {
 	if database, ok := metadata["database"].(string); ok && database != "" {
 		// Map database names to tenant IDs
 		switch database {
 		case "db1", "database1":
-			return "tenant1", nil
+			return "tenant1", username, nil
 		case "db2", "database2":
-			return "tenant2", nil
+			return "tenant2", username, nil
 		default:
-			return database, nil
+			return database, username, nil
 		}
 	}
 
 	// Fall back to username-based extraction
 	extractor := NewUsernameBasedExtractor()
-	return extractor.ExtractTenantID(username, password, metadata)
+	return extractor.ExtractTenantAndUser(username, password, metadata)
 }
 
 // Authenticator handles authentication and tenant routing
@@ -86,4 +114,15 @@ func New(extractor TenantExtractor) *Authenticator {
 // AuthenticateAndRoute authenticates the user and determines tenant routing
 func (a *Authenticator) AuthenticateAndRoute(username, password string, metadata map[string]interface{}) (string, error) {
 	return a.extractor.ExtractTenantID(username, password, metadata)
-}
\ No newline at end of file
+}
+
+// AuthenticateAndRouteUser is AuthenticateAndRoute that also returns the
+// user the login names. Extractors that are not a UserExtractor name the
+// username itself.
+func (a *Authenticator) AuthenticateAndRouteUser(username, password string, metadata map[string]interface{}) (string, string, error) {
+	if extractor, ok := a.extractor.(UserExtractor); ok {
+		return extractor.ExtractTenantAndUser(username, password, metadata)
+	}
+	tenantID, err := a.extractor.ExtractTenantID(username, password, metadata)
+	return tenantID, username, err
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// pbkdf2Prefix marks passwords stored as
+// "pbkdf2-sha256:<iterations>:<salt>:<key>", salt and key in unpadded base64
+const pbkdf2Prefix = "pbkdf2-sha256:"
+
+// pbkdf2Iterations is the work factor of new hashes, as recommended by
+// OWASP for PBKDF2-HMAC-SHA256
+const pbkdf2Iterations = 600000
+
+// HashPassword returns the salted PBKDF2-SHA256 hash of password to store
+// in a tenant's users table
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, pbkdf2Iterations, sha256.Size)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s%d:%s:%s", pbkdf2Prefix, pbkdf2Iterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// PasswordMatches compares a password with a stored one: a HashPassword
+// hash, "sha256:" and the hex digest of the password, or the password in
+// clear. Malformed hashes match no password.
+func PasswordMatches(stored, password string) bool {
+	if hash, ok := strings.CutPrefix(stored, pbkdf2Prefix); ok {
+		return pbkdf2Matches(hash, password)
+	}
+	if digest, ok := strings.CutPrefix(stored, "sha256:"); ok {
+		sum := sha256.Sum256([]byte(password))
+		stored, password = strings.ToLower(digest), hex.EncodeToString(sum[:])
+	}
+	return subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+}
+
+// pbkdf2Matches checks password against the fields of a PBKDF2 hash
+func pbkdf2Matches(hash, password string) bool {
+	fields := strings.Split(hash, ":")
+	if len(fields) != 3 {
+		return false
+	}
+	iterations, err := strconv.Atoi(fields[0])
+	if err != nil || iterations <= 0 {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return false
+	}
+	want, err := base64.RawStdEncoding.DecodeString(fields[2])
+	if err != nil || len(want) == 0 {
+		return false
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(want))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(key, want) == 1
+}
@@ -0,0 +1,299 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"neo4j-proxy/pkg/bolt"
+	"neo4j-proxy/pkg/config"
+)
+
+// resetTimeout bounds the RESET round trip that cleans a connection on
+// release and checks that it is alive on reuse
+const resetTimeout = 5 * time.Second
+
+// reapInterval is how often idle connections are checked against the idle
+// timeout and the maximum lifetime
+const reapInterval = time.Second
+
+// errPoolClosed is returned when acquiring from a closed pool
+var errPoolClosed = errors.New("connection pool is closed")
+
+// PooledConn is a backend connection that has logged in and can be handed
+// to later clients whose login has the same key
+type PooledConn struct {
+	*bolt.Connection
+	key string
+	// Login holds the backend's replies to the login, which are replayed to
+	// clients reusing the connection in place of logging in again
+	Login     []*bolt.Message
+	created   time.Time
+	idleSince time.Time
+	// counted is the pool whose open connections include this one, for
+	// connections opened by Acquire
+	counted *Pool
+}
+
+// Close closes the connection, making room for another if it counted
+// against the pool's open connections
+func (c *PooledConn) Close() error {
+	if p := c.counted; p != nil {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return p.discardLocked(c)
+	}
+	return c.Connection.Close()
+}
+
+// NewPooledConn wraps a backend connection that logged in with a login of
+// the given key, receiving the login replies
+func NewPooledConn(conn *bolt.Connection, key string, login []*bolt.Message) *PooledConn {
+	return &PooledConn{Connection: conn, key: key, Login: login, created: time.Now()}
+}
+
+// Pool keeps the idle backend connections of one tenant
+type Pool struct {
+	cfg    config.PoolConfig
+	mu     sync.Mutex
+	idle   []*PooledConn // least recently released first
+	open   int           // connections opened by Acquire and not closed
+	freed  chan struct{} // closed when a connection is released or closed
+	closed bool
+	stop   chan struct{}
+}
+
+// newPool creates a pool and starts reaping its idle connections if they
+// can time out
+func newPool(cfg config.PoolConfig) *Pool {
+	p := &Pool{cfg: cfg, freed: make(chan struct{}), stop: make(chan struct{})}
+	if cfg.IdleTimeout > 0 || cfg.MaxLifetime > 0 {
+		go p.reap()
+	}
+	return p
+}
+
+// Get takes an idle connection whose login had the given key, or returns
+// nil if there is none. Connections idle longer than the liveness check
+// interval are checked with RESET first.
+func (p *Pool) Get(key string) *PooledConn {
+	for {
+		p.mu.Lock()
+		i := slices.IndexFunc(p.idle, func(c *PooledConn) bool { return c.key == key })
+		if i < 0 {
+			p.mu.Unlock()
+			return nil
+		}
+		// Prefer the most recently released connection
+		for j := len(p.idle) - 1; j > i; j-- {
+			if p.idle[j].key == key {
+				i = j
+				break
+			}
+		}
+		c := p.idle[i]
+		p.idle = slices.Delete(p.idle, i, i+1)
+		p.mu.Unlock()
+
+		now := time.Now()
+		if p.expired(c, now) {
+			c.Close()
+			continue
+		}
+		if now.Sub(c.idleSince) >= time.Duration(p.cfg.LivenessCheck) {
+			if err := reset(c.Connection); err != nil {
+				c.Close()
+				continue
+			}
+		}
+		return c
+	}
+}
+
+// Put resets a connection whose client has left and keeps it for reuse,
+// or closes it if it fails to reset, has expired or the pool is full
+func (p *Pool) Put(c *PooledConn) {
+	if p.expired(c, time.Now()) || reset(c.Connection) != nil {
+		c.Close()
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keepLocked(c)
+}
+
+// Acquire takes an idle connection whose login had the given key, or opens
+// one with dial. When MaxOpen connections are open it waits for one to be
+// released or closed, closing idle connections of other logins to make room.
+func (p *Pool) Acquire(ctx context.Context, key string, dial func() (*PooledConn, error)) (*PooledConn, error) {
+	for {
+		p.mu.Lock()
+		freed := p.freed
+		p.mu.Unlock()
+		if c := p.Get(key); c != nil {
+			return c, nil
+		}
+
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, errPoolClosed
+		}
+		if p.cfg.MaxOpen > 0 && p.open >= p.cfg.MaxOpen && len(p.idle) > 0 {
+			p.discardLocked(p.idle[0])
+			p.idle = p.idle[1:]
+		}
+		if p.cfg.MaxOpen <= 0 || p.open < p.cfg.MaxOpen {
+			p.open++
+			p.mu.Unlock()
+			c, err := dial()
+			if err != nil {
+				p.mu.Lock()
+				p.open--
+				p.signalLocked()
+				p.mu.Unlock()
+				return nil, err
+			}
+			c.counted = p
+			return c, nil
+		}
+		p.mu.Unlock()
+
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Return keeps a connection that is known to be ready for the next request,
+// without resetting it, or closes it if it has expired or the pool is full
+func (p *Pool) Return(c *PooledConn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.expired(c, time.Now()) {
+		p.discardLocked(c)
+		return
+	}
+	p.keepLocked(c)
+}
+
+// keepLocked adds a connection to the idle ones unless the pool is full or
+// closed; p.mu must be held
+func (p *Pool) keepLocked(c *PooledConn) {
+	if p.closed || len(p.idle) >= p.cfg.MaxIdle {
+		p.discardLocked(c)
+		return
+	}
+	c.idleSince = time.Now()
+	p.idle = append(p.idle, c)
+	p.signalLocked()
+}
+
+// discardLocked closes a connection; p.mu must be held
+func (p *Pool) discardLocked(c *PooledConn) error {
+	if c.counted == p {
+		c.counted = nil
+		p.open--
+		p.signalLocked()
+	}
+	return c.Connection.Close()
+}
+
+// signalLocked wakes the callers waiting in Acquire; p.mu must be held
+func (p *Pool) signalLocked() {
+	close(p.freed)
+	p.freed = make(chan struct{})
+}
+
+// Idle returns the number of idle connections
+func (p *Pool) Idle() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.idle)
+}
+
+// Close closes the idle connections. Connections put back afterwards are
+// closed as well.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	p.closed = true
+	close(p.stop)
+	for _, c := range p.idle {
+		p.discardLocked(c)
+	}
+	p.idle = nil
+	p.signalLocked()
+}
+
+// expired reports whether a connection has outlived the maximum lifetime
+func (p *Pool) expired(c *PooledConn, now time.Time) bool {
+	return p.cfg.MaxLifetime > 0 && now.Sub(c.created) >= time.Duration(p.cfg.MaxLifetime)
+}
+
+// reap closes expired connections and those idle past the idle timeout,
+// keeping RetainIdle of the most recently released ones, until the pool closes
+func (p *Pool) reap() {
+	ticker := time.NewTicker(reapInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case now := <-ticker.C:
+			p.mu.Lock()
+			var kept []*PooledConn
+			for i, c := range p.idle {
+				timedOut := p.cfg.IdleTimeout > 0 && now.Sub(c.idleSince) >= time.Duration(p.cfg.IdleTimeout) &&
+					len(p.idle)-i > p.cfg.RetainIdle
+				if timedOut || p.expired(c, now) {
+					p.discardLocked(c)
+					continue
+				}
+				kept = append(kept, c)
+			}
+			p.idle = kept
+			p.mu.Unlock()
+		}
+	}
+}
+
+// reset sends RESET and waits for its SUCCESS, leaving the connection
+// ready for a new client
+func reset(conn *bolt.Connection) error {
+	v := conn.GetVersion()
+	msg, err := (&bolt.Reset{}).Encode(v)
+	if err != nil {
+		return err
+	}
+	netConn := conn.NetConn()
+	netConn.SetDeadline(time.Now().Add(resetTimeout))
+	defer netConn.SetDeadline(time.Time{})
+
+	if err := conn.WriteMessage(msg); err != nil {
+		return err
+	}
+	for {
+		reply, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		switch reply.Signature {
+		case bolt.MsgSuccess:
+			return nil
+		case bolt.MsgRecord, bolt.MsgIgnored:
+			// Left over from requests the client abandoned
+			continue
+		}
+		return fmt.Errorf("unexpected reply %s to RESET", bolt.MessageName(reply.Signature, v))
+	}
+}
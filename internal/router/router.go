@@ -1,44 +1,139 @@
 package router
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net"
+	"slices"
+	"strconv"
 	"sync"
+	"time"
 
+	"golang.org/x/net/websocket"
+
+	"neo4j-proxy/pkg/bolt"
 	"neo4j-proxy/pkg/config"
 )
 
+// connectTimeout bounds connecting to a backend and each of the TCP, TLS
+// and Bolt handshakes
+const connectTimeout = 10 * time.Second
+
 // Router handles routing connections to appropriate Neo4j backends
 type Router struct {
 	config *config.Config
 	mu     sync.RWMutex
+	pools  map[string]*Pool // tenant ID -> pool, created on first use
 }
 
 // New creates a new router instance
 func New(cfg *config.Config) *Router {
 	return &Router{
 		config: cfg,
+		pools:  make(map[string]*Pool),
 	}
 }
 
 // RouteConnection establishes connection to the appropriate backend for the tenant
-func (r *Router) RouteConnection(tenantID string) (net.Conn, error) {
+// and performs the client side of the Bolt handshake with it. The backend is
+// offered the given versions, restricted to the tenant's pinned version if it
+// has one. An empty list is rejected rather than widened to every version.
+func (r *Router) RouteConnection(tenantID string, versions []bolt.Version) (*bolt.Connection, error) {
+	// The lock is not held while connecting, so a slow backend cannot stall
+	// configuration changes or routing to other tenants
 	r.mu.RLock()
-	defer r.mu.RUnlock()
-
 	tenantConfig, exists := r.config.Tenants[tenantID]
+	r.mu.RUnlock()
 	if !exists {
 		return nil, fmt.Errorf("tenant %s not found", tenantID)
 	}
 
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("tenant %s: no versions to offer the backend: %w", tenantID, bolt.ErrNoCompatibleVersion)
+	}
+	if tenantConfig.BoltVersion != "" {
+		pinned, err := bolt.ParseVersion(tenantConfig.BoltVersion)
+		if err != nil {
+			return nil, fmt.Errorf("tenant %s: %w", tenantID, err)
+		}
+		if !slices.Contains(versions, pinned) {
+			return nil, fmt.Errorf("tenant %s is pinned to Bolt %s which was not negotiated: %w", tenantID, pinned, bolt.ErrNoCompatibleVersion)
+		}
+		versions = []bolt.Version{pinned}
+	}
+
 	// Connect to the backend Neo4j instance
-	address := fmt.Sprintf("%s:%d", tenantConfig.Host, tenantConfig.Port)
-	conn, err := net.Dial("tcp", address)
+	address := net.JoinHostPort(tenantConfig.Host, strconv.Itoa(tenantConfig.Port))
+	tlsConfig, err := backendTLS(tenantConfig.TLS, tenantConfig.Host)
+	if err != nil {
+		return nil, fmt.Errorf("tenant %s: %w", tenantID, err)
+	}
+	conn, err := dial(tenantConfig.Transport, address, tlsConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to backend %s: %w", address, err)
 	}
 
-	return conn, nil
+	backend := bolt.NewConnection(conn)
+	backend.SetSupportedVersions(versions)
+	conn.SetDeadline(time.Now().Add(connectTimeout))
+	if err := backend.ClientHandshake(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("bolt handshake with backend %s failed: %w", address, err)
+	}
+	conn.SetDeadline(time.Time{})
+
+	return backend, nil
+}
+
+// dial opens the transport to a backend at address, encrypted with
+// tlsConfig unless it is nil
+func dial(transport, address string, tlsConfig *tls.Config) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: connectTimeout}
+	switch transport {
+	case "", config.TransportTCP:
+		if tlsConfig != nil {
+			return tls.DialWithDialer(dialer, "tcp", address, tlsConfig)
+		}
+		return dialer.Dial("tcp", address)
+	case config.TransportWebSocket:
+		scheme, origin := "ws://", "http://"
+		if tlsConfig != nil {
+			scheme, origin = "wss://", "https://"
+		}
+		wsConfig, err := websocket.NewConfig(scheme+address+"/", origin+address)
+		if err != nil {
+			return nil, err
+		}
+		wsConfig.TlsConfig = tlsConfig
+		wsConfig.Dialer = dialer
+		ws, err := websocket.DialConfig(wsConfig)
+		if err != nil {
+			return nil, err
+		}
+		ws.PayloadType = websocket.BinaryFrame
+		return ws, nil
+	}
+	return nil, fmt.Errorf("unknown transport %q", transport)
+}
+
+// PinnedVersions returns the Bolt versions tenants are pinned to. It returns
+// nil unless every tenant is pinned, since any unpinned tenant may accept
+// whatever version the client negotiates.
+func (r *Router) PinnedVersions() []bolt.Version {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var pinned []bolt.Version
+	for _, tenantConfig := range r.config.Tenants {
+		v, err := bolt.ParseVersion(tenantConfig.BoltVersion)
+		if tenantConfig.BoltVersion == "" || err != nil {
+			return nil
+		}
+		if !slices.Contains(pinned, v) {
+			pinned = append(pinned, v)
+		}
+	}
+	return pinned
 }
 
 // GetTenantConfig returns configuration for a specific tenant
@@ -62,12 +157,14 @@ func (r *Router) ListTenants() []string {
 	return tenants
 }
 
-// UpdateTenantConfig updates configuration for a tenant
+// UpdateTenantConfig updates configuration for a tenant, closing the idle
+// connections pooled under the old configuration
 func (r *Router) UpdateTenantConfig(tenantID string, cfg config.TenantConfig) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	r.config.Tenants[tenantID] = cfg
+	r.closePool(tenantID)
 }
 
 // RemoveTenant removes a tenant configuration
@@ -76,4 +173,41 @@ func (r *Router) RemoveTenant(tenantID string) {
 	defer r.mu.Unlock()
 
 	delete(r.config.Tenants, tenantID)
+	r.closePool(tenantID)
+}
+
+// Pool returns the pool of idle backend connections of a tenant, or nil if
+// the tenant does not pool connections
+func (r *Router) Pool(tenantID string) *Pool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if pool, ok := r.pools[tenantID]; ok {
+		return pool
+	}
+	tenantConfig, exists := r.config.Tenants[tenantID]
+	if !exists || tenantConfig.Pool.MaxIdle <= 0 {
+		return nil
+	}
+	pool := newPool(tenantConfig.Pool)
+	r.pools[tenantID] = pool
+	return pool
+}
+
+// Close closes every pool's idle connections
+func (r *Router) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for tenantID := range r.pools {
+		r.closePool(tenantID)
+	}
+}
+
+// closePool closes and forgets a tenant's pool; r.mu must be held
+func (r *Router) closePool(tenantID string) {
+	if pool, ok := r.pools[tenantID]; ok {
+		pool.Close()
+		delete(r.pools, tenantID)
+	}
 }
\ No newline at end of file
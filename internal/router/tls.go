@@ -0,0 +1,72 @@
+package router
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	"neo4j-proxy/pkg/config"
+)
+
+// errPinMismatch is returned when no certificate of the backend's chain
+// matches the tenant's pinned keys
+var errPinMismatch = errors.New("backend certificate does not match any pinned key")
+
+// backendTLS builds the TLS configuration for a tenant's backend at host,
+// or returns nil when TLS is not enabled. Files are read on every call so
+// that replaced CA bundles and client certificates apply to new connections.
+func backendTLS(cfg config.BackendTLS, host string) (*tls.Config, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: cfg.SkipVerify,
+	}
+	if cfg.ServerName != "" {
+		tlsConfig.ServerName = cfg.ServerName
+	}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", cfg.CAFile)
+		}
+	}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if len(cfg.PinnedSPKI) > 0 {
+		pins := cfg.PinnedSPKI
+		// VerifyConnection also runs when verification is skipped
+		tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+			for _, cert := range state.PeerCertificates {
+				if slices.Contains(pins, spkiDigest(cert)) {
+					return nil
+				}
+			}
+			return errPinMismatch
+		}
+	}
+	return tlsConfig, nil
+}
+
+// spkiDigest returns the base64 SHA-256 digest of a certificate's subject
+// public key info, as pinned in config.BackendTLS.PinnedSPKI
+func spkiDigest(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
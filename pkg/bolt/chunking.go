@@ -0,0 +1,66 @@
+package bolt
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// MaxChunkSize is the largest payload a single Bolt chunk can carry
+const MaxChunkSize = 0xFFFF
+
+// readChunks reads chunks until an end-of-message marker and returns the
+// reassembled message data. Zero-size chunks that arrive before any data
+// are NOOPs (keep-alives) and are skipped. Messages larger than maxSize
+// fail with a *LimitError before their data is read, unless maxSize is zero.
+func readChunks(r io.Reader, maxSize int) ([]byte, error) {
+	var (
+		header [2]byte
+		data   []byte
+	)
+	for {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if err == io.EOF && len(data) > 0 {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+
+		size := int(binary.BigEndian.Uint16(header[:]))
+		if size == 0 {
+			if len(data) == 0 {
+				// NOOP chunk between messages
+				continue
+			}
+			return data, nil
+		}
+
+		if err := checkLimit(LimitMessageSize, len(data)+size, maxSize); err != nil {
+			return nil, err
+		}
+		start := len(data)
+		data = append(data, make([]byte, size)...)
+		if _, err := io.ReadFull(r, data[start:]); err != nil {
+			if err == io.EOF {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+	}
+}
+
+// writeChunks writes data as a sequence of chunks terminated by an
+// end-of-message marker, using a single write on the underlying writer
+func writeChunks(w io.Writer, data []byte) error {
+	chunks := (len(data) + MaxChunkSize - 1) / MaxChunkSize
+	buf := make([]byte, 0, len(data)+2*chunks+2)
+	for len(data) > 0 {
+		size := min(len(data), MaxChunkSize)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(size))
+		buf = append(buf, data[:size]...)
+		data = data[size:]
+	}
+	buf = append(buf, 0x00, 0x00)
+
+	_, err := w.Write(buf)
+	return err
+}
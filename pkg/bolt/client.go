@@ -0,0 +1,363 @@
+package bolt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultUserAgent identifies a Client to the server unless configured otherwise
+const DefaultUserAgent = "neo4j-proxy/1.0"
+
+// ClientConfig configures a Client
+type ClientConfig struct {
+	// Versions are the versions proposed to the server;
+	// DefaultSupportedVersions when empty
+	Versions []Version
+	// UserAgent identifies the client, DefaultUserAgent when empty
+	UserAgent string
+	// Auth is the authentication token, e.g. from BasicAuth; the "none"
+	// scheme when nil
+	Auth AuthToken
+	// Routing is the routing context sent in HELLO, nil for a direct connection
+	Routing map[string]interface{}
+	// Limits bound the messages read from the server
+	Limits Limits
+}
+
+// BasicAuth returns the token for user name and password authentication
+func BasicAuth(username, password string) AuthToken {
+	return AuthToken{"scheme": "basic", "principal": username, "credentials": password}
+}
+
+// ServerError is a FAILURE the server answered a request with
+type ServerError struct {
+	Code    string
+	Message string
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// Result holds the outcome of a query
+type Result struct {
+	// Keys are the names of the result columns
+	Keys []string
+	// Records hold the values of each row, with graph and temporal values decoded
+	Records [][]interface{}
+	// Summary is the metadata of the final SUCCESS, e.g. bookmark and stats
+	Summary map[string]interface{}
+}
+
+// Client is a minimal Bolt client for talking to a server on the proxy's
+// own behalf, e.g. for health checks and warmup queries. It runs one
+// request at a time and is safe for concurrent use.
+type Client struct {
+	mu     sync.Mutex
+	conn   *Connection
+	server map[string]interface{}
+	// err is the I/O or protocol error that made the connection unusable
+	err error
+}
+
+// Dial connects to the server at address over TCP, then handshakes and
+// authenticates as NewClient does
+func Dial(ctx context.Context, address string, cfg ClientConfig) (*Client, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	client, err := NewClient(ctx, conn, cfg)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// NewClient performs the client handshake on an established connection and
+// authenticates with HELLO, or HELLO and LOGON from Bolt 5.1. A rejected
+// authentication is returned as a *ServerError.
+func NewClient(ctx context.Context, conn net.Conn, cfg ClientConfig) (*Client, error) {
+	c := &Client{conn: NewConnection(conn)}
+	if len(cfg.Versions) > 0 {
+		c.conn.SetSupportedVersions(cfg.Versions)
+	}
+	c.conn.SetLimits(cfg.Limits)
+
+	stop := c.watch(ctx)
+	defer stop()
+
+	if err := c.conn.ClientHandshake(); err != nil {
+		return nil, c.ioError(ctx, err)
+	}
+	if err := c.hello(ctx, cfg); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// hello authenticates and records the server's metadata
+func (c *Client) hello(ctx context.Context, cfg ClientConfig) error {
+	v := c.conn.GetVersion()
+	userAgent := cfg.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+	auth := cfg.Auth
+	if auth == nil {
+		auth = AuthToken{"scheme": "none"}
+	}
+
+	var requests []TypedMessage
+	switch {
+	case !v.AtLeast(3, 0):
+		requests = append(requests, &Init{UserAgent: userAgent, Auth: auth})
+	case v.AtLeast(5, 1):
+		hello := &Hello{UserAgent: userAgent, Routing: cfg.Routing}
+		requests = append(requests, hello, &Logon{Auth: auth})
+	default:
+		hello := &Hello{UserAgent: userAgent, Routing: cfg.Routing, Auth: auth}
+		if v == (Version{Major: 4, Minor: 4}) {
+			hello.Extra = map[string]interface{}{"patch_bolt": []interface{}{"utc"}}
+		}
+		requests = append(requests, hello)
+	}
+
+	summaries, _, err := c.roundTrip(ctx, requests...)
+	if err != nil {
+		return err
+	}
+	if err := summaryError(summaries); err != nil {
+		// The server closes the connection after a failed authentication
+		c.err = err
+		c.conn.Close()
+		return err
+	}
+
+	c.server = summaries[0].(*Success).Metadata
+	patches, _ := c.server["patch_bolt"].([]interface{})
+	c.conn.SetUTCPatch(slices.Contains(patches, interface{}("utc")))
+	return nil
+}
+
+// Version returns the negotiated Bolt version
+func (c *Client) Version() Version {
+	return c.conn.GetVersion()
+}
+
+// ServerInfo returns the metadata the server sent in reply to HELLO, such
+// as "server" and "connection_id"
+func (c *Client) ServerInfo() map[string]interface{} {
+	return c.server
+}
+
+// Run runs a query and pulls all of its records. A FAILURE is returned as a
+// *ServerError after the connection has been reset, so the client stays usable.
+func (c *Client) Run(ctx context.Context, query string, params map[string]interface{}, extra TxExtra) (*Result, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.usable(); err != nil {
+		return nil, err
+	}
+	stop := c.watch(ctx)
+	defer stop()
+
+	run := &Run{Query: query, Parameters: params, Extra: extra}
+	summaries, records, err := c.roundTrip(ctx, run, &Pull{N: -1, QID: -1})
+	if err != nil {
+		return nil, err
+	}
+	if err := summaryError(summaries); err != nil {
+		return nil, c.afterFailure(ctx, err)
+	}
+
+	header := summaries[0].(*Success).Metadata
+	return &Result{
+		Keys:    stringList(header["fields"]),
+		Records: records,
+		Summary: summaries[1].(*Success).Metadata,
+	}, nil
+}
+
+// Route fetches the routing table of database db, or of the default
+// database when db is empty (Bolt 4.3+)
+func (c *Client) Route(ctx context.Context, routing map[string]interface{}, bookmarks []string, db string) (map[string]interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.usable(); err != nil {
+		return nil, err
+	}
+	if !c.conn.GetVersion().AtLeast(4, 3) {
+		return nil, fmt.Errorf("routing tables need Bolt 4.3, connected with Bolt %s", c.conn.GetVersion())
+	}
+	stop := c.watch(ctx)
+	defer stop()
+
+	summaries, _, err := c.roundTrip(ctx, &Route{Routing: routing, Bookmarks: bookmarks, Database: db})
+	if err != nil {
+		return nil, err
+	}
+	if err := summaryError(summaries); err != nil {
+		return nil, c.afterFailure(ctx, err)
+	}
+	rt, _ := summaries[0].(*Success).Metadata["rt"].(map[string]interface{})
+	return rt, nil
+}
+
+// Reset returns the connection to a clean state, discarding any open
+// transaction
+func (c *Client) Reset(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.usable(); err != nil {
+		return err
+	}
+	stop := c.watch(ctx)
+	defer stop()
+	return c.reset(ctx)
+}
+
+// Close says GOODBYE where the version knows it and closes the connection
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil && c.conn.GetVersion().AtLeast(3, 0) {
+		if msg, err := (&Goodbye{}).Encode(c.conn.GetVersion()); err == nil {
+			c.conn.WriteMessage(msg)
+		}
+	}
+	if c.err == nil {
+		c.err = errClientClosed
+	}
+	return c.conn.Close()
+}
+
+var errClientClosed = errors.New("bolt client is closed")
+
+// usable returns the error that made the client unusable, if any
+func (c *Client) usable() error {
+	if c.err != nil {
+		return fmt.Errorf("bolt client is unusable: %w", c.err)
+	}
+	return nil
+}
+
+// afterFailure resets the connection after a FAILURE and returns the failure
+func (c *Client) afterFailure(ctx context.Context, failure error) error {
+	if err := c.reset(ctx); err != nil {
+		return err
+	}
+	return failure
+}
+
+func (c *Client) reset(ctx context.Context) error {
+	summaries, _, err := c.roundTrip(ctx, &Reset{})
+	if err != nil {
+		return err
+	}
+	if err := summaryError(summaries); err != nil {
+		// The server closes a connection it cannot reset
+		c.err = err
+		return err
+	}
+	return nil
+}
+
+// roundTrip sends pipelined requests and reads a summary for each, along
+// with the records streamed before them. I/O and protocol errors make the
+// client unusable.
+func (c *Client) roundTrip(ctx context.Context, requests ...TypedMessage) ([]TypedMessage, [][]interface{}, error) {
+	v := c.conn.GetVersion()
+	// Encode everything first so a request the version cannot express
+	// leaves nothing half sent
+	msgs := make([]*Message, len(requests))
+	for i, request := range requests {
+		msg, err := request.Encode(v)
+		if err != nil {
+			return nil, nil, err
+		}
+		msgs[i] = msg
+	}
+	for _, msg := range msgs {
+		if err := c.conn.WriteMessage(msg); err != nil {
+			return nil, nil, c.ioError(ctx, err)
+		}
+	}
+
+	var (
+		summaries []TypedMessage
+		records   [][]interface{}
+	)
+	for len(summaries) < len(requests) {
+		msg, err := c.conn.ReadMessage()
+		if err != nil {
+			return nil, nil, c.ioError(ctx, err)
+		}
+		typed, err := ParseMessage(msg, v)
+		if err != nil {
+			return nil, nil, c.ioError(ctx, err)
+		}
+		switch m := typed.(type) {
+		case *Record:
+			values, err := DecodeValue(m.Values, v)
+			if err != nil {
+				return nil, nil, c.ioError(ctx, err)
+			}
+			records = append(records, values.([]interface{}))
+		case *Success, *Failure, *Ignored:
+			summaries = append(summaries, typed)
+		default:
+			return nil, nil, c.ioError(ctx, fmt.Errorf("unexpected message 0x%02X from server", msg.Signature))
+		}
+	}
+	return summaries, records, nil
+}
+
+// summaryError returns the first FAILURE among summaries as a
+// *ServerError, or an error if a request was ignored without one
+func summaryError(summaries []TypedMessage) error {
+	for _, s := range summaries {
+		if f, ok := s.(*Failure); ok {
+			return &ServerError{Code: f.Code, Message: f.Message}
+		}
+	}
+	for _, s := range summaries {
+		if _, ok := s.(*Ignored); ok {
+			return errors.New("server ignored the request")
+		}
+	}
+	return nil
+}
+
+// ioError records err as making the client unusable, reporting the
+// context's error instead if it interrupted the request
+func (c *Client) ioError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		err = ctxErr
+	}
+	c.err = err
+	return err
+}
+
+// watch interrupts blocked I/O once the context is done, so that ioError
+// always finds the context's error; stop undoes it. The context's deadline
+// is deliberately not copied to the socket, whose timeout could fire before
+// the context reports it.
+func (c *Client) watch(ctx context.Context) (stop func()) {
+	conn := c.conn.NetConn()
+	stopAfter := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Unix(1, 0))
+	})
+	return func() {
+		if stopAfter() {
+			conn.SetDeadline(time.Time{})
+		}
+	}
+}
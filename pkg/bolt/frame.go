@@ -0,0 +1,176 @@
+package bolt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// frameBufferSize is the read buffer of a FrameReader, large enough for a
+// full chunk so most frames need a single read from the connection
+const frameBufferSize = 64 * 1024
+
+// Frame is a single chunked message exactly as it appeared on the wire
+type Frame struct {
+	// Raw holds the chunk headers, payloads and end marker
+	Raw []byte
+	// Signature is the message signature, peeked from the first bytes of
+	// the payload. It is 0 for NOOP frames.
+	Signature byte
+
+	limits Limits
+}
+
+// IsNoop reports whether the frame is a keep-alive NOOP chunk
+func (f *Frame) IsNoop() bool {
+	return len(f.Raw) == 2
+}
+
+// Payload reassembles the message data without chunk headers
+func (f *Frame) Payload() []byte {
+	data := make([]byte, 0, len(f.Raw))
+	for raw := f.Raw; len(raw) >= 2; {
+		size := int(binary.BigEndian.Uint16(raw))
+		data = append(data, raw[2:2+size]...)
+		raw = raw[2+size:]
+	}
+	return data
+}
+
+// Message fully decodes the frame within the limits of the reader that
+// read it; use it only for the frames that need it
+func (f *Frame) Message() (*Message, error) {
+	return decodeMessage(f.Payload(), f.limits)
+}
+
+// FrameReader splits a Bolt stream into frames without decoding them
+type FrameReader struct {
+	r      *bufio.Reader
+	buf    []byte
+	limits Limits
+}
+
+// NewFrameReader creates a frame reader on r
+func NewFrameReader(r io.Reader) *FrameReader {
+	return &FrameReader{r: bufio.NewReaderSize(r, frameBufferSize)}
+}
+
+// SetLimits bounds the frames the reader accepts. Only the message size is
+// checked while reading; the other limits apply when a frame is decoded.
+func (fr *FrameReader) SetLimits(l Limits) {
+	fr.limits = l
+}
+
+// ReadFrame reads the next message or NOOP chunk. The returned frame's Raw
+// buffer is reused and only valid until the next call.
+func (fr *FrameReader) ReadFrame() (*Frame, error) {
+	var (
+		head    [4]byte // first payload bytes, enough to find the signature
+		headLen int
+		size    int // payload bytes so far
+	)
+	raw := fr.buf[:0]
+	for {
+		start := len(raw)
+		raw = append(raw, 0, 0)
+		if _, err := io.ReadFull(fr.r, raw[start:]); err != nil {
+			if err == io.EOF && start > 0 {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+
+		chunk := int(binary.BigEndian.Uint16(raw[start:]))
+		if chunk == 0 {
+			fr.buf = raw
+			if start == 0 {
+				return &Frame{Raw: raw, limits: fr.limits}, nil
+			}
+			sig, err := peekSignature(head[:headLen])
+			if err != nil {
+				return nil, err
+			}
+			return &Frame{Raw: raw, Signature: sig, limits: fr.limits}, nil
+		}
+		size += chunk
+		if err := checkLimit(LimitMessageSize, size, fr.limits.MaxMessageSize); err != nil {
+			return nil, err
+		}
+
+		start = len(raw)
+		raw = slices.Grow(raw, chunk)[:start+chunk]
+		if _, err := io.ReadFull(fr.r, raw[start:]); err != nil {
+			if err == io.EOF {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		headLen += copy(head[headLen:], raw[start:])
+	}
+}
+
+// peekSignature returns the signature of a message from its first bytes
+func peekSignature(head []byte) (byte, error) {
+	if len(head) == 0 {
+		return 0, errors.New("empty message")
+	}
+	offset := 0
+	switch marker := head[0]; {
+	case marker&0xF0 == markerTinyStruct:
+		offset = 1
+	case marker == markerStruct8:
+		offset = 2
+	case marker == markerStruct16:
+		offset = 3
+	default:
+		return 0, fmt.Errorf("message must be a structure, got marker 0x%02X", marker)
+	}
+	if len(head) <= offset {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return head[offset], nil
+}
+
+// FrameWriter writes frames and messages to a Bolt stream
+type FrameWriter struct {
+	w        io.Writer
+	version  Version
+	utcPatch bool
+}
+
+// NewFrameWriter creates a frame writer on w
+func NewFrameWriter(w io.Writer) *FrameWriter {
+	return &FrameWriter{w: w}
+}
+
+// SetVersion sets the negotiated version that typed values in written
+// messages are laid out for
+func (fw *FrameWriter) SetVersion(v Version) {
+	fw.version = v
+}
+
+// SetUTCPatch records that the "utc" patch was agreed on the stream, so
+// date times written at Bolt 4.4 use the UTC layout
+func (fw *FrameWriter) SetUTCPatch(enabled bool) {
+	fw.utcPatch = enabled
+}
+
+// WriteFrame relays a frame byte for byte
+func (fw *FrameWriter) WriteFrame(f *Frame) error {
+	_, err := fw.w.Write(f.Raw)
+	return err
+}
+
+// WriteMessage chunks and writes a message, for replies the relay injects
+func (fw *FrameWriter) WriteMessage(msg *Message) error {
+	enc := NewEncoder()
+	enc.SetVersion(fw.version)
+	enc.SetUTCPatch(fw.utcPatch)
+	if err := enc.EncodeStructure(msg.Signature, msg.Fields); err != nil {
+		return err
+	}
+	return writeChunks(fw.w, enc.Bytes())
+}
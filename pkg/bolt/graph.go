@@ -0,0 +1,296 @@
+package bolt
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Graph structure tags
+const (
+	TagNode                byte = 0x4E
+	TagRelationship        byte = 0x52
+	TagUnboundRelationship byte = 0x72
+	TagPath                byte = 0x50
+)
+
+// Node is a graph node. ElementID is only carried on the wire from Bolt 5;
+// for older versions it is derived from ID when re-encoding for Bolt 5.
+type Node struct {
+	ID         int64
+	Labels     []string
+	Properties map[string]interface{}
+	ElementID  string
+}
+
+// Relationship is a graph relationship with its start and end nodes
+type Relationship struct {
+	ID                 int64
+	StartNodeID        int64
+	EndNodeID          int64
+	Type               string
+	Properties         map[string]interface{}
+	ElementID          string
+	StartNodeElementID string
+	EndNodeElementID   string
+}
+
+// UnboundRelationship is a relationship inside a Path, without node references
+type UnboundRelationship struct {
+	ID         int64
+	Type       string
+	Properties map[string]interface{}
+	ElementID  string
+}
+
+// Path is an alternating sequence of nodes and relationships. Indices
+// describe the traversal as in the Bolt specification: pairs of a
+// 1-based relationship index (negative when traversed backwards) and a
+// node index.
+type Path struct {
+	Nodes         []*Node
+	Relationships []*UnboundRelationship
+	Indices       []int64
+}
+
+// Structure encodes the node for version v
+func (n *Node) Structure(v Version, utc bool) (*Structure, error) {
+	labels := make([]interface{}, len(n.Labels))
+	for i, label := range n.Labels {
+		labels[i] = label
+	}
+	fields := []interface{}{n.ID, labels, nonNilMap(n.Properties)}
+	if v.AtLeast(5, 0) {
+		fields = append(fields, elementID(n.ElementID, n.ID))
+	}
+	return &Structure{Tag: TagNode, Fields: fields}, nil
+}
+
+// Structure encodes the relationship for version v
+func (r *Relationship) Structure(v Version, utc bool) (*Structure, error) {
+	fields := []interface{}{r.ID, r.StartNodeID, r.EndNodeID, r.Type, nonNilMap(r.Properties)}
+	if v.AtLeast(5, 0) {
+		fields = append(fields,
+			elementID(r.ElementID, r.ID),
+			elementID(r.StartNodeElementID, r.StartNodeID),
+			elementID(r.EndNodeElementID, r.EndNodeID))
+	}
+	return &Structure{Tag: TagRelationship, Fields: fields}, nil
+}
+
+// Structure encodes the unbound relationship for version v
+func (r *UnboundRelationship) Structure(v Version, utc bool) (*Structure, error) {
+	fields := []interface{}{r.ID, r.Type, nonNilMap(r.Properties)}
+	if v.AtLeast(5, 0) {
+		fields = append(fields, elementID(r.ElementID, r.ID))
+	}
+	return &Structure{Tag: TagUnboundRelationship, Fields: fields}, nil
+}
+
+// Structure encodes the path for version v
+func (p *Path) Structure(v Version, utc bool) (*Structure, error) {
+	nodes := make([]interface{}, len(p.Nodes))
+	for i, node := range p.Nodes {
+		nodes[i] = node
+	}
+	rels := make([]interface{}, len(p.Relationships))
+	for i, rel := range p.Relationships {
+		rels[i] = rel
+	}
+	indices := make([]interface{}, len(p.Indices))
+	for i, index := range p.Indices {
+		indices[i] = index
+	}
+	return &Structure{Tag: TagPath, Fields: []interface{}{nodes, rels, indices}}, nil
+}
+
+// elementID returns id, or the legacy numeric id as a string when the
+// entity came from a server that predates element ids
+func elementID(id string, legacy int64) string {
+	if id != "" {
+		return id
+	}
+	return strconv.FormatInt(legacy, 10)
+}
+
+func decodeNode(s *Structure, v Version) (*Node, error) {
+	f := structReader{s: s, v: v}
+	f.expect(3, 4)
+	node := &Node{
+		ID:         f.int(0),
+		Labels:     f.strings(1),
+		Properties: f.props(2),
+	}
+	if v.AtLeast(5, 0) {
+		node.ElementID = f.string(3)
+	}
+	return node, f.err
+}
+
+func decodeRelationship(s *Structure, v Version) (*Relationship, error) {
+	f := structReader{s: s, v: v}
+	f.expect(5, 8)
+	rel := &Relationship{
+		ID:          f.int(0),
+		StartNodeID: f.int(1),
+		EndNodeID:   f.int(2),
+		Type:        f.string(3),
+		Properties:  f.props(4),
+	}
+	if v.AtLeast(5, 0) {
+		rel.ElementID = f.string(5)
+		rel.StartNodeElementID = f.string(6)
+		rel.EndNodeElementID = f.string(7)
+	}
+	return rel, f.err
+}
+
+func decodeUnboundRelationship(s *Structure, v Version) (*UnboundRelationship, error) {
+	f := structReader{s: s, v: v}
+	f.expect(3, 4)
+	rel := &UnboundRelationship{
+		ID:         f.int(0),
+		Type:       f.string(1),
+		Properties: f.props(2),
+	}
+	if v.AtLeast(5, 0) {
+		rel.ElementID = f.string(3)
+	}
+	return rel, f.err
+}
+
+func decodePath(s *Structure, v Version) (*Path, error) {
+	f := structReader{s: s, v: v}
+	f.expect(3, 3)
+	if f.err != nil {
+		return nil, f.err
+	}
+	path := &Path{}
+	for _, item := range f.list(0) {
+		st, ok := item.(*Structure)
+		if !ok || st.Tag != TagNode {
+			return nil, fmt.Errorf("path nodes must be nodes, got %T", item)
+		}
+		node, err := decodeNode(st, v)
+		if err != nil {
+			return nil, err
+		}
+		path.Nodes = append(path.Nodes, node)
+	}
+	for _, item := range f.list(1) {
+		st, ok := item.(*Structure)
+		if !ok || st.Tag != TagUnboundRelationship {
+			return nil, fmt.Errorf("path relationships must be unbound relationships, got %T", item)
+		}
+		rel, err := decodeUnboundRelationship(st, v)
+		if err != nil {
+			return nil, err
+		}
+		path.Relationships = append(path.Relationships, rel)
+	}
+	for _, item := range f.list(2) {
+		index, ok := item.(int64)
+		if !ok {
+			return nil, fmt.Errorf("path indices must be integers, got %T", item)
+		}
+		path.Indices = append(path.Indices, index)
+	}
+	return path, f.err
+}
+
+// structReader reads typed structure fields, remembering the first error
+type structReader struct {
+	s   *Structure
+	v   Version
+	err error
+}
+
+// expect checks the field count, which is legacy before Bolt 5 and
+// current from Bolt 5
+func (f *structReader) expect(legacy, current int) {
+	want := legacy
+	if f.v.AtLeast(5, 0) {
+		want = current
+	}
+	f.count(want)
+}
+
+// count checks that the structure has exactly n fields
+func (f *structReader) count(n int) {
+	if len(f.s.Fields) != n && f.err == nil {
+		f.err = fmt.Errorf("structure 0x%02X must have %d fields in Bolt %s, got %d", f.s.Tag, n, f.v, len(f.s.Fields))
+	}
+}
+
+func (f *structReader) value(i int) interface{} {
+	if i >= len(f.s.Fields) {
+		return nil
+	}
+	return f.s.Fields[i]
+}
+
+func (f *structReader) fail(i int, want string) {
+	if f.err == nil {
+		f.err = fmt.Errorf("structure 0x%02X field %d must be %s, got %T", f.s.Tag, i, want, f.value(i))
+	}
+}
+
+func (f *structReader) int(i int) int64 {
+	n, ok := f.value(i).(int64)
+	if !ok {
+		f.fail(i, "an integer")
+	}
+	return n
+}
+
+func (f *structReader) float(i int) float64 {
+	x, ok := f.value(i).(float64)
+	if !ok {
+		f.fail(i, "a float")
+	}
+	return x
+}
+
+func (f *structReader) string(i int) string {
+	s, ok := f.value(i).(string)
+	if !ok {
+		f.fail(i, "a string")
+	}
+	return s
+}
+
+func (f *structReader) list(i int) []interface{} {
+	l, ok := f.value(i).([]interface{})
+	if !ok {
+		f.fail(i, "a list")
+	}
+	return l
+}
+
+func (f *structReader) strings(i int) []string {
+	list := f.list(i)
+	strs := make([]string, 0, len(list))
+	for _, item := range list {
+		s, ok := item.(string)
+		if !ok {
+			f.fail(i, "a list of strings")
+			return nil
+		}
+		strs = append(strs, s)
+	}
+	return strs
+}
+
+// props reads a property map, decoding any typed values inside it
+func (f *structReader) props(i int) map[string]interface{} {
+	m, ok := f.value(i).(map[string]interface{})
+	if !ok {
+		f.fail(i, "a map")
+		return nil
+	}
+	decoded, err := DecodeValue(m, f.v)
+	if err != nil && f.err == nil {
+		f.err = err
+	}
+	props, _ := decoded.(map[string]interface{})
+	return props
+}
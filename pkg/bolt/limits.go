@@ -0,0 +1,58 @@
+package bolt
+
+import "fmt"
+
+// Limits bound the resources spent on a single incoming message, so a peer
+// cannot make the proxy allocate arbitrary amounts of memory. Zero fields
+// are unlimited.
+type Limits struct {
+	// MaxMessageSize is the largest message in bytes, across all its chunks
+	MaxMessageSize int
+	// MaxDepth is the deepest nesting of lists, maps and structures,
+	// counting the message structure itself
+	MaxDepth int
+	// MaxCollectionLength is the most entries a list, map or structure
+	// may declare
+	MaxCollectionLength int
+	// MaxStringLength is the longest string or byte array in bytes
+	MaxStringLength int
+}
+
+// DefaultLimits are the limits applied to client messages unless
+// configured otherwise
+var DefaultLimits = Limits{
+	MaxMessageSize:      64 << 20,
+	MaxDepth:            64,
+	MaxCollectionLength: 1 << 20,
+	MaxStringLength:     16 << 20,
+}
+
+// Names of the limits reported by LimitError
+const (
+	LimitMessageSize      = "message size"
+	LimitDepth            = "nesting depth"
+	LimitCollectionLength = "collection length"
+	LimitStringLength     = "string length"
+)
+
+// LimitError reports a message that exceeds one of the Limits. The rest
+// of the message is not read, so the connection cannot be used afterwards.
+type LimitError struct {
+	// Limit is the name of the exceeded limit, e.g. LimitMessageSize
+	Limit string
+	Max   int
+	// Size is the size the message declared or reached
+	Size int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s %d exceeds the limit of %d", e.Limit, e.Size, e.Max)
+}
+
+// checkLimit returns a *LimitError if size exceeds max, unless max is zero
+func checkLimit(limit string, size, max int) error {
+	if max > 0 && size > max {
+		return &LimitError{Limit: limit, Max: max, Size: size}
+	}
+	return nil
+}
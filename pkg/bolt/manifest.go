@@ -0,0 +1,175 @@
+package bolt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// ManifestV1 is the handshake proposal for manifest negotiation (Bolt 5.7+).
+// A server that accepts it answers with the full list of versions it offers
+// and a capability bitmask, and the client confirms its choice.
+const ManifestV1 uint32 = 0x000001FF
+
+// maxManifestOffers bounds the version list read from a server's manifest
+const maxManifestOffers = 64
+
+// Manifest is what a server that accepted ManifestV1 sends: the versions
+// it offers, as encoded version ranges, and its capability bitmask
+type Manifest struct {
+	Offers       []uint32
+	Capabilities uint64
+}
+
+// ReadManifest reads the manifest that follows a server's ManifestV1 answer
+func ReadManifest(r io.Reader) (*Manifest, error) {
+	count, err := readVarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if count > maxManifestOffers {
+		return nil, fmt.Errorf("server manifest offers %d versions, more than %d", count, maxManifestOffers)
+	}
+	m := &Manifest{Offers: make([]uint32, count)}
+	if err := binary.Read(r, binary.BigEndian, m.Offers); err != nil {
+		return nil, err
+	}
+	if m.Capabilities, err = readVarint(r); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ReadManifestConfirmation reads the client's reply to a manifest: the
+// encoded version it chose, zero if none, and the capabilities it wants
+func ReadManifestConfirmation(r io.Reader) (chosen uint32, capabilities uint64, err error) {
+	if err := binary.Read(r, binary.BigEndian, &chosen); err != nil {
+		return 0, 0, err
+	}
+	if capabilities, err = readVarint(r); err != nil {
+		return 0, 0, err
+	}
+	return chosen, capabilities, nil
+}
+
+// PrefersManifest reports whether the client proposed the manifest ahead of
+// every plain proposal that matches a supported version
+func PrefersManifest(proposals []uint32, supported []Version) bool {
+	if len(supported) == 0 {
+		return false
+	}
+	for _, proposal := range proposals {
+		if proposal == ManifestV1 {
+			return true
+		}
+		if proposal == 0 {
+			continue
+		}
+		if _, err := SelectVersion([]uint32{proposal}, supported); err == nil {
+			return false
+		}
+	}
+	return false
+}
+
+// AnswerProposals answers the client's proposals with one of the offered
+// versions, using manifest negotiation when the client prefers it
+func (c *Connection) AnswerProposals(proposals []uint32, offered []Version) error {
+	if PrefersManifest(proposals, offered) {
+		return c.answerManifest(offered)
+	}
+	// A zero version tells the client that nothing it proposed is acceptable
+	selected, _ := SelectVersion(proposals, offered)
+	return c.AnswerHandshake(selected)
+}
+
+// answerManifest sends the manifest of offered versions and reads the
+// version the client confirms. The proxy offers no capabilities.
+func (c *Connection) answerManifest(offered []Version) error {
+	buf := binary.BigEndian.AppendUint32(nil, ManifestV1)
+	offers := foldVersions(offered)
+	buf = binary.AppendUvarint(buf, uint64(len(offers)))
+	for _, offer := range offers {
+		buf = binary.BigEndian.AppendUint32(buf, offer)
+	}
+	buf = binary.AppendUvarint(buf, 0)
+	if _, err := c.conn.Write(buf); err != nil {
+		return err
+	}
+
+	chosen, _, err := ReadManifestConfirmation(c.conn)
+	if err != nil {
+		return err
+	}
+	if chosen == 0 {
+		return ErrNoCompatibleVersion
+	}
+	v := DecodeVersionRange(chosen).Max
+	if !slices.Contains(offered, v) {
+		return fmt.Errorf("client chose Bolt version %s which was not offered", v)
+	}
+
+	c.version = v
+	return nil
+}
+
+// confirmManifest reads the server's manifest after it accepted ManifestV1
+// and confirms the newest offered version this connection supports
+func (c *Connection) confirmManifest() error {
+	manifest, err := ReadManifest(c.conn)
+	if err != nil {
+		return err
+	}
+
+	var selected Version
+	for _, v := range AcceptedVersions(manifest.Offers, c.supported) {
+		if v.Compare(selected) > 0 {
+			selected = v
+		}
+	}
+
+	// The confirmation is the chosen version followed by the capabilities
+	// we want, of which the proxy requests none
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, selected.Encode())
+	buf.Write(binary.AppendUvarint(nil, 0))
+	if _, err := c.conn.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	if selected.IsZero() {
+		return ErrNoCompatibleVersion
+	}
+
+	c.version = selected
+	return nil
+}
+
+// clientProposals returns the proposals sent to a server, leading with the
+// manifest when a version that knows it (5.7+) is supported
+func (c *Connection) clientProposals() []uint32 {
+	if !slices.ContainsFunc(c.supported, func(v Version) bool { return v.AtLeast(5, 7) }) {
+		return ProposeVersions(c.supported)
+	}
+	return append([]uint32{ManifestV1}, proposeVersions(c.supported, 3)...)
+}
+
+// readVarint reads an unsigned LEB128 integer as used by the manifest
+func readVarint(r io.Reader) (uint64, error) {
+	var (
+		value uint64
+		b     [1]byte
+	)
+	for shift := 0; shift < 64; shift += 7 {
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return 0, err
+		}
+		value |= uint64(b[0]&0x7F) << shift
+		if b[0]&0x80 == 0 {
+			return value, nil
+		}
+	}
+	return 0, errors.New("handshake varint is too long")
+}
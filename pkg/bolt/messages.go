@@ -0,0 +1,660 @@
+package bolt
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+)
+
+// Message signatures introduced after Bolt v1. Several share a signature
+// with an older message and are told apart by the negotiated version.
+const (
+	MsgHello      byte = 0x01 // INIT before Bolt 3
+	MsgGoodbye    byte = 0x02
+	MsgAckFailure byte = 0x0E // Bolt 1 and 2 only
+	MsgBegin      byte = 0x11
+	MsgCommit     byte = 0x12
+	MsgRollback   byte = 0x13
+	MsgDiscard    byte = 0x2F // DISCARD_ALL before Bolt 4
+	MsgPull       byte = 0x3F // PULL_ALL before Bolt 4
+	MsgTelemetry  byte = 0x54
+	MsgRoute      byte = 0x66
+	MsgLogon      byte = 0x6A
+	MsgLogoff     byte = 0x6B
+)
+
+// TypedMessage is implemented by the typed Bolt messages
+type TypedMessage interface {
+	// Encode converts the typed message to a generic one using the field layout of version v
+	Encode(v Version) (*Message, error)
+}
+
+// AuthToken holds authentication entries such as scheme, principal and credentials
+type AuthToken map[string]interface{}
+
+// authTokenKeys are the HELLO entries that belong to the auth token in
+// Bolt 3.0 to 5.0, before authentication moved to LOGON
+var authTokenKeys = []string{"scheme", "principal", "credentials", "realm", "parameters"}
+
+// Scheme returns the authentication scheme, e.g. "basic"
+func (a AuthToken) Scheme() string {
+	s, _ := a["scheme"].(string)
+	return s
+}
+
+// Principal returns the user name
+func (a AuthToken) Principal() string {
+	s, _ := a["principal"].(string)
+	return s
+}
+
+// Credentials returns the password or token
+func (a AuthToken) Credentials() string {
+	s, _ := a["credentials"].(string)
+	return s
+}
+
+// TxExtra holds the extra entries of RUN and BEGIN
+type TxExtra map[string]interface{}
+
+// Database returns the target database, or "" for the default database
+func (e TxExtra) Database() string {
+	s, _ := e["db"].(string)
+	return s
+}
+
+// Mode returns the access mode, "r" for read or "w" (the default) for write
+func (e TxExtra) Mode() string {
+	if s, ok := e["mode"].(string); ok {
+		return s
+	}
+	return "w"
+}
+
+// ImpersonatedUser returns the user to impersonate, if any
+func (e TxExtra) ImpersonatedUser() string {
+	s, _ := e["imp_user"].(string)
+	return s
+}
+
+// Bookmarks returns the bookmarks the transaction must wait for
+func (e TxExtra) Bookmarks() []string {
+	return stringList(e["bookmarks"])
+}
+
+// TxMetadata returns the user supplied transaction metadata
+func (e TxExtra) TxMetadata() map[string]interface{} {
+	m, _ := e["tx_metadata"].(map[string]interface{})
+	return m
+}
+
+// Init is the INIT message of Bolt 1 and 2
+type Init struct {
+	UserAgent string
+	Auth      AuthToken
+}
+
+// Hello is the HELLO message of Bolt 3 and later. Before Bolt 5.1 the
+// auth token travels inside HELLO and is split out into Auth.
+type Hello struct {
+	UserAgent string
+	Auth      AuthToken
+	// Routing is the routing context, nil when the client is not routing
+	Routing map[string]interface{}
+	// Extra holds all remaining entries, e.g. bolt_agent and patch_bolt
+	Extra map[string]interface{}
+}
+
+// Logon carries authentication in Bolt 5.1 and later
+type Logon struct {
+	Auth AuthToken
+}
+
+// Logoff ends the authenticated session (Bolt 5.1+)
+type Logoff struct{}
+
+// Goodbye announces that the client is closing the connection
+type Goodbye struct{}
+
+// Reset returns the connection to a clean state
+type Reset struct{}
+
+// AckFailure acknowledges a FAILURE in Bolt 1 and 2
+type AckFailure struct{}
+
+// Run submits a query
+type Run struct {
+	Query      string
+	Parameters map[string]interface{}
+	Extra      TxExtra
+}
+
+// Begin opens an explicit transaction
+type Begin struct {
+	Extra TxExtra
+}
+
+// Commit commits the open transaction
+type Commit struct{}
+
+// Rollback rolls back the open transaction
+type Rollback struct{}
+
+// Pull requests records. Before Bolt 4 only PULL_ALL exists, which is
+// represented with N set to -1.
+type Pull struct {
+	N   int64
+	QID int64
+}
+
+// Discard drops records. Before Bolt 4 only DISCARD_ALL exists, which is
+// represented with N set to -1.
+type Discard struct {
+	N   int64
+	QID int64
+}
+
+// Route requests a routing table (Bolt 4.3+)
+type Route struct {
+	Routing          map[string]interface{}
+	Bookmarks        []string
+	Database         string
+	ImpersonatedUser string
+}
+
+// Telemetry reports which driver API was used (Bolt 5.4+)
+type Telemetry struct {
+	API int64
+}
+
+// Success reports a successful request
+type Success struct {
+	Metadata map[string]interface{}
+}
+
+// Failure reports a failed request
+type Failure struct {
+	Code    string
+	Message string
+	// Extra holds all remaining entries, e.g. the GQL status fields of Bolt 5.7+
+	Extra map[string]interface{}
+}
+
+// Record carries one result row
+type Record struct {
+	Values []interface{}
+}
+
+// Ignored reports a request that was skipped because of an earlier failure
+type Ignored struct{}
+
+// ParseMessage converts a generic message into its typed form for version v
+func ParseMessage(msg *Message, v Version) (TypedMessage, error) {
+	f := fieldReader{msg: msg}
+	var typed TypedMessage
+	switch msg.Signature {
+	case MsgHello:
+		if !v.AtLeast(3, 0) {
+			typed = &Init{UserAgent: f.string(0), Auth: AuthToken(f.mapAt(1))}
+			break
+		}
+		typed = parseHello(f.mapAt(0), v)
+	case MsgLogon:
+		typed = &Logon{Auth: AuthToken(f.mapAt(0))}
+	case MsgLogoff:
+		typed = &Logoff{}
+	case MsgGoodbye:
+		typed = &Goodbye{}
+	case MsgReset:
+		typed = &Reset{}
+	case MsgAckFailure:
+		typed = &AckFailure{}
+	case MsgRun:
+		run := &Run{Query: f.string(0), Parameters: f.mapAt(1)}
+		if v.AtLeast(3, 0) {
+			run.Extra = TxExtra(f.mapAt(2))
+		}
+		typed = run
+	case MsgBegin:
+		typed = &Begin{Extra: TxExtra(f.mapAt(0))}
+	case MsgCommit:
+		typed = &Commit{}
+	case MsgRollback:
+		typed = &Rollback{}
+	case MsgPull:
+		n, qid := parsePullExtra(&f, v)
+		typed = &Pull{N: n, QID: qid}
+	case MsgDiscard:
+		n, qid := parsePullExtra(&f, v)
+		typed = &Discard{N: n, QID: qid}
+	case MsgRoute:
+		route := &Route{Routing: f.mapAt(0), Bookmarks: stringList(f.value(1))}
+		if v.AtLeast(4, 4) {
+			extra := f.mapAt(2)
+			route.Database, _ = extra["db"].(string)
+			route.ImpersonatedUser, _ = extra["imp_user"].(string)
+		} else {
+			route.Database = f.string(2)
+		}
+		typed = route
+	case MsgTelemetry:
+		typed = &Telemetry{API: f.int(0)}
+	case MsgSuccess:
+		typed = &Success{Metadata: f.mapAt(0)}
+	case MsgFailure:
+		typed = parseFailure(f.mapAt(0))
+	case MsgRecord:
+		typed = &Record{Values: f.list(0)}
+	case MsgIgnored:
+		typed = &Ignored{}
+	default:
+		return nil, fmt.Errorf("unknown message signature 0x%02X", msg.Signature)
+	}
+
+	if f.err != nil {
+		return nil, f.err
+	}
+	return typed, nil
+}
+
+// MessageName returns the name the Bolt specification gives the message
+// with signature sig in version v
+func MessageName(sig byte, v Version) string {
+	switch sig {
+	case MsgHello:
+		if !v.AtLeast(3, 0) {
+			return "INIT"
+		}
+		return "HELLO"
+	case MsgGoodbye:
+		return "GOODBYE"
+	case MsgAckFailure:
+		return "ACK_FAILURE"
+	case MsgReset:
+		return "RESET"
+	case MsgRun:
+		return "RUN"
+	case MsgBegin:
+		return "BEGIN"
+	case MsgCommit:
+		return "COMMIT"
+	case MsgRollback:
+		return "ROLLBACK"
+	case MsgDiscard:
+		if !v.AtLeast(4, 0) {
+			return "DISCARD_ALL"
+		}
+		return "DISCARD"
+	case MsgPull:
+		if !v.AtLeast(4, 0) {
+			return "PULL_ALL"
+		}
+		return "PULL"
+	case MsgTelemetry:
+		return "TELEMETRY"
+	case MsgRoute:
+		return "ROUTE"
+	case MsgLogon:
+		return "LOGON"
+	case MsgLogoff:
+		return "LOGOFF"
+	case MsgSuccess:
+		return "SUCCESS"
+	case MsgRecord:
+		return "RECORD"
+	case MsgIgnored:
+		return "IGNORED"
+	case MsgFailure:
+		return "FAILURE"
+	}
+	return fmt.Sprintf("0x%02X", sig)
+}
+
+func parseHello(extra map[string]interface{}, v Version) *Hello {
+	hello := &Hello{Extra: maps.Clone(extra)}
+	hello.UserAgent, _ = hello.Extra["user_agent"].(string)
+	delete(hello.Extra, "user_agent")
+	if routing, ok := hello.Extra["routing"].(map[string]interface{}); ok {
+		hello.Routing = routing
+		delete(hello.Extra, "routing")
+	}
+	if !v.AtLeast(5, 1) {
+		hello.Auth = AuthToken{}
+		for _, key := range authTokenKeys {
+			if value, ok := hello.Extra[key]; ok {
+				hello.Auth[key] = value
+				delete(hello.Extra, key)
+			}
+		}
+	}
+	return hello
+}
+
+func parseFailure(metadata map[string]interface{}) *Failure {
+	failure := &Failure{Extra: maps.Clone(metadata)}
+	failure.Message, _ = failure.Extra["message"].(string)
+	delete(failure.Extra, "message")
+	for _, key := range []string{"code", "neo4j_code"} {
+		if code, ok := failure.Extra[key].(string); ok {
+			failure.Code = code
+			delete(failure.Extra, key)
+		}
+	}
+	return failure
+}
+
+func parsePullExtra(f *fieldReader, v Version) (int64, int64) {
+	if !v.AtLeast(4, 0) {
+		return -1, -1
+	}
+	extra := f.mapAt(0)
+	n, qid := int64(-1), int64(-1)
+	if value, ok := extra["n"].(int64); ok {
+		n = value
+	}
+	if value, ok := extra["qid"].(int64); ok {
+		qid = value
+	}
+	return n, qid
+}
+
+// Encode encodes INIT
+func (m *Init) Encode(v Version) (*Message, error) {
+	if v.AtLeast(3, 0) {
+		return nil, fmt.Errorf("INIT is not part of Bolt %s, use HELLO", v)
+	}
+	return &Message{Signature: MsgInit, Fields: []interface{}{m.UserAgent, nonNilMap(m.Auth)}}, nil
+}
+
+// Encode encodes HELLO
+func (m *Hello) Encode(v Version) (*Message, error) {
+	if !v.AtLeast(3, 0) {
+		return nil, fmt.Errorf("HELLO is not part of Bolt %s, use INIT", v)
+	}
+	extra := maps.Clone(nonNilMap(m.Extra))
+	extra["user_agent"] = m.UserAgent
+	if m.Routing != nil {
+		extra["routing"] = m.Routing
+	}
+	if len(m.Auth) > 0 {
+		if v.AtLeast(5, 1) {
+			return nil, fmt.Errorf("HELLO cannot carry credentials in Bolt %s, use LOGON", v)
+		}
+		maps.Copy(extra, m.Auth)
+	}
+	return &Message{Signature: MsgHello, Fields: []interface{}{extra}}, nil
+}
+
+// Encode encodes LOGON
+func (m *Logon) Encode(v Version) (*Message, error) {
+	if !v.AtLeast(5, 1) {
+		return nil, fmt.Errorf("LOGON is not part of Bolt %s", v)
+	}
+	return &Message{Signature: MsgLogon, Fields: []interface{}{nonNilMap(m.Auth)}}, nil
+}
+
+// Encode encodes LOGOFF
+func (m *Logoff) Encode(v Version) (*Message, error) {
+	if !v.AtLeast(5, 1) {
+		return nil, fmt.Errorf("LOGOFF is not part of Bolt %s", v)
+	}
+	return &Message{Signature: MsgLogoff, Fields: []interface{}{}}, nil
+}
+
+// Encode encodes GOODBYE
+func (m *Goodbye) Encode(v Version) (*Message, error) {
+	return &Message{Signature: MsgGoodbye, Fields: []interface{}{}}, nil
+}
+
+// Encode encodes RESET
+func (m *Reset) Encode(v Version) (*Message, error) {
+	return &Message{Signature: MsgReset, Fields: []interface{}{}}, nil
+}
+
+// Encode encodes ACK_FAILURE
+func (m *AckFailure) Encode(v Version) (*Message, error) {
+	if v.AtLeast(3, 0) {
+		return nil, fmt.Errorf("ACK_FAILURE is not part of Bolt %s, use RESET", v)
+	}
+	return &Message{Signature: MsgAckFailure, Fields: []interface{}{}}, nil
+}
+
+// Encode encodes RUN
+func (m *Run) Encode(v Version) (*Message, error) {
+	fields := []interface{}{m.Query, nonNilMap(m.Parameters)}
+	if v.AtLeast(3, 0) {
+		fields = append(fields, nonNilMap(m.Extra))
+	} else if len(m.Extra) > 0 {
+		return nil, fmt.Errorf("RUN cannot carry extra entries in Bolt %s", v)
+	}
+	return &Message{Signature: MsgRun, Fields: fields}, nil
+}
+
+// Encode encodes BEGIN
+func (m *Begin) Encode(v Version) (*Message, error) {
+	if !v.AtLeast(3, 0) {
+		return nil, fmt.Errorf("BEGIN is not part of Bolt %s", v)
+	}
+	return &Message{Signature: MsgBegin, Fields: []interface{}{nonNilMap(m.Extra)}}, nil
+}
+
+// Encode encodes COMMIT
+func (m *Commit) Encode(v Version) (*Message, error) {
+	if !v.AtLeast(3, 0) {
+		return nil, fmt.Errorf("COMMIT is not part of Bolt %s", v)
+	}
+	return &Message{Signature: MsgCommit, Fields: []interface{}{}}, nil
+}
+
+// Encode encodes ROLLBACK
+func (m *Rollback) Encode(v Version) (*Message, error) {
+	if !v.AtLeast(3, 0) {
+		return nil, fmt.Errorf("ROLLBACK is not part of Bolt %s", v)
+	}
+	return &Message{Signature: MsgRollback, Fields: []interface{}{}}, nil
+}
+
+// Encode encodes PULL, or PULL_ALL before Bolt 4
+func (m *Pull) Encode(v Version) (*Message, error) {
+	fields, err := pullFields("PULL", m.N, m.QID, v)
+	if err != nil {
+		return nil, err
+	}
+	return &Message{Signature: MsgPull, Fields: fields}, nil
+}
+
+// Encode encodes DISCARD, or DISCARD_ALL before Bolt 4
+func (m *Discard) Encode(v Version) (*Message, error) {
+	fields, err := pullFields("DISCARD", m.N, m.QID, v)
+	if err != nil {
+		return nil, err
+	}
+	return &Message{Signature: MsgDiscard, Fields: fields}, nil
+}
+
+func pullFields(name string, n, qid int64, v Version) ([]interface{}, error) {
+	if !v.AtLeast(4, 0) {
+		if n != -1 || qid != -1 {
+			return nil, fmt.Errorf("%s n/qid are not part of Bolt %s", name, v)
+		}
+		return []interface{}{}, nil
+	}
+	extra := map[string]interface{}{"n": n}
+	if qid != -1 {
+		extra["qid"] = qid
+	}
+	return []interface{}{extra}, nil
+}
+
+// Encode encodes ROUTE
+func (m *Route) Encode(v Version) (*Message, error) {
+	if !v.AtLeast(4, 3) {
+		return nil, fmt.Errorf("ROUTE is not part of Bolt %s", v)
+	}
+	bookmarks := make([]interface{}, len(m.Bookmarks))
+	for i, bookmark := range m.Bookmarks {
+		bookmarks[i] = bookmark
+	}
+	fields := []interface{}{nonNilMap(m.Routing), bookmarks}
+
+	if v.AtLeast(4, 4) {
+		extra := map[string]interface{}{}
+		if m.Database != "" {
+			extra["db"] = m.Database
+		}
+		if m.ImpersonatedUser != "" {
+			extra["imp_user"] = m.ImpersonatedUser
+		}
+		fields = append(fields, extra)
+	} else {
+		if m.ImpersonatedUser != "" {
+			return nil, fmt.Errorf("ROUTE cannot impersonate users in Bolt %s", v)
+		}
+		var db interface{}
+		if m.Database != "" {
+			db = m.Database
+		}
+		fields = append(fields, db)
+	}
+	return &Message{Signature: MsgRoute, Fields: fields}, nil
+}
+
+// Encode encodes TELEMETRY
+func (m *Telemetry) Encode(v Version) (*Message, error) {
+	if !v.AtLeast(5, 4) {
+		return nil, fmt.Errorf("TELEMETRY is not part of Bolt %s", v)
+	}
+	return &Message{Signature: MsgTelemetry, Fields: []interface{}{m.API}}, nil
+}
+
+// Encode encodes SUCCESS
+func (m *Success) Encode(v Version) (*Message, error) {
+	return &Message{Signature: MsgSuccess, Fields: []interface{}{nonNilMap(m.Metadata)}}, nil
+}
+
+// gqlStatuses are the GQL statuses of Neo4j status codes, by code prefix,
+// for failures that carry none: ISO GQL conditions without a subclass,
+// and Neo4j's unexpected error for database errors
+var gqlStatuses = []struct{ prefix, status, condition string }{
+	{"Neo.ClientError.Security.", "42000", "syntax error or access rule violation"},
+	{"Neo.ClientError.Statement.SyntaxError", "42000", "syntax error or access rule violation"},
+	{"Neo.ClientError.Transaction.", "25000", "invalid transaction state"},
+	{"Neo.ClientError.Request.", "08000", "connection exception"},
+	{"Neo.TransientError.Transaction.", "40000", "transaction rollback"},
+	{"Neo.DatabaseError.", "50N42", "general processing exception - unexpected error"},
+}
+
+// Encode encodes FAILURE. Bolt 5.7 renamed "code" to "neo4j_code" and
+// added GQL status fields, which are derived from the code when missing
+// and left out for codes without a known GQL counterpart.
+func (m *Failure) Encode(v Version) (*Message, error) {
+	metadata := maps.Clone(nonNilMap(m.Extra))
+	metadata["message"] = m.Message
+	if v.AtLeast(5, 7) {
+		metadata["neo4j_code"] = m.Code
+		if _, ok := metadata["gql_status"]; !ok {
+			for _, gql := range gqlStatuses {
+				if strings.HasPrefix(m.Code, gql.prefix) {
+					metadata["gql_status"] = gql.status
+					metadata["description"] = "error: " + gql.condition + ". " + m.Message
+					break
+				}
+			}
+		}
+	} else {
+		metadata["code"] = m.Code
+	}
+	return &Message{Signature: MsgFailure, Fields: []interface{}{metadata}}, nil
+}
+
+// Encode encodes RECORD
+func (m *Record) Encode(v Version) (*Message, error) {
+	values := m.Values
+	if values == nil {
+		values = []interface{}{}
+	}
+	return &Message{Signature: MsgRecord, Fields: []interface{}{values}}, nil
+}
+
+// Encode encodes IGNORED
+func (m *Ignored) Encode(v Version) (*Message, error) {
+	return &Message{Signature: MsgIgnored, Fields: []interface{}{}}, nil
+}
+
+// fieldReader reads typed message fields, remembering the first error
+type fieldReader struct {
+	msg *Message
+	err error
+}
+
+func (f *fieldReader) value(i int) interface{} {
+	if i >= len(f.msg.Fields) {
+		if f.err == nil {
+			f.err = fmt.Errorf("message 0x%02X is missing field %d", f.msg.Signature, i)
+		}
+		return nil
+	}
+	return f.msg.Fields[i]
+}
+
+func (f *fieldReader) string(i int) string {
+	v := f.value(i)
+	s, ok := v.(string)
+	if !ok && v != nil && f.err == nil {
+		f.err = fmt.Errorf("message 0x%02X field %d must be a string, got %T", f.msg.Signature, i, v)
+	}
+	return s
+}
+
+func (f *fieldReader) int(i int) int64 {
+	v := f.value(i)
+	n, ok := v.(int64)
+	if !ok && f.err == nil {
+		f.err = fmt.Errorf("message 0x%02X field %d must be an integer, got %T", f.msg.Signature, i, v)
+	}
+	return n
+}
+
+func (f *fieldReader) mapAt(i int) map[string]interface{} {
+	v := f.value(i)
+	m, ok := v.(map[string]interface{})
+	if !ok && v != nil && f.err == nil {
+		f.err = fmt.Errorf("message 0x%02X field %d must be a map, got %T", f.msg.Signature, i, v)
+	}
+	if m == nil {
+		m = map[string]interface{}{}
+	}
+	return m
+}
+
+func (f *fieldReader) list(i int) []interface{} {
+	v := f.value(i)
+	l, ok := v.([]interface{})
+	if !ok && v != nil && f.err == nil {
+		f.err = fmt.Errorf("message 0x%02X field %d must be a list, got %T", f.msg.Signature, i, v)
+	}
+	if l == nil {
+		l = []interface{}{}
+	}
+	return l
+}
+
+// stringList converts a decoded list of strings, ignoring other values
+func stringList(v interface{}) []string {
+	list, _ := v.([]interface{})
+	strs := make([]string, 0, len(list))
+	for _, item := range list {
+		if s, ok := item.(string); ok {
+			strs = append(strs, s)
+		}
+	}
+	return strs
+}
+
+// nonNilMap returns m as a plain map, substituting an empty map for nil
+func nonNilMap[M ~map[string]interface{}](m M) map[string]interface{} {
+	if m == nil {
+		return map[string]interface{}{}
+	}
+	return m
+}
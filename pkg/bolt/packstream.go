@@ -0,0 +1,598 @@
+package bolt
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// PackStream markers
+const (
+	markerTinyString = 0x80
+	markerTinyList   = 0x90
+	markerTinyMap    = 0xA0
+	markerTinyStruct = 0xB0
+
+	markerNull    = 0xC0
+	markerFloat64 = 0xC1
+	markerFalse   = 0xC2
+	markerTrue    = 0xC3
+
+	markerInt8  = 0xC8
+	markerInt16 = 0xC9
+	markerInt32 = 0xCA
+	markerInt64 = 0xCB
+
+	markerBytes8  = 0xCC
+	markerBytes16 = 0xCD
+	markerBytes32 = 0xCE
+
+	markerString8  = 0xD0
+	markerString16 = 0xD1
+	markerString32 = 0xD2
+
+	markerList8  = 0xD4
+	markerList16 = 0xD5
+	markerList32 = 0xD6
+
+	markerMap8  = 0xD8
+	markerMap16 = 0xD9
+	markerMap32 = 0xDA
+
+	markerStruct8  = 0xDC
+	markerStruct16 = 0xDD
+)
+
+var (
+	// ErrUnexpectedEOF is returned when PackStream data ends in the middle of a value
+	ErrUnexpectedEOF = errors.New("unexpected end of PackStream data")
+)
+
+// Structure represents a PackStream structure that has no more specific Go type
+type Structure struct {
+	Tag    byte
+	Fields []interface{}
+}
+
+// Encoder serializes Go values into PackStream
+type Encoder struct {
+	buf      []byte
+	version  Version
+	utcPatch bool
+}
+
+// Structurer is implemented by typed values, such as graph entities, whose
+// PackStream structure layout depends on the Bolt version
+type Structurer interface {
+	// Structure lays out the value for version v. utc reports whether date
+	// times use the UTC layout (Bolt 5, or Bolt 4.4 with the "utc" patch).
+	Structure(v Version, utc bool) (*Structure, error)
+}
+
+// NewEncoder creates a new PackStream encoder
+func NewEncoder() *Encoder {
+	return &Encoder{}
+}
+
+// SetVersion sets the Bolt version used to lay out Structurer values
+func (e *Encoder) SetVersion(v Version) {
+	e.version = v
+}
+
+// SetUTCPatch records whether the "utc" patch was negotiated on Bolt 4.4
+func (e *Encoder) SetUTCPatch(enabled bool) {
+	e.utcPatch = enabled
+}
+
+// Bytes returns the encoded data
+func (e *Encoder) Bytes() []byte {
+	return e.buf
+}
+
+// Reset discards any encoded data
+func (e *Encoder) Reset() {
+	e.buf = e.buf[:0]
+}
+
+// Encode appends the PackStream representation of v
+func (e *Encoder) Encode(v interface{}) error {
+	switch x := v.(type) {
+	case nil:
+		e.buf = append(e.buf, markerNull)
+	case bool:
+		if x {
+			e.buf = append(e.buf, markerTrue)
+		} else {
+			e.buf = append(e.buf, markerFalse)
+		}
+	case int:
+		e.encodeInt(int64(x))
+	case int8:
+		e.encodeInt(int64(x))
+	case int16:
+		e.encodeInt(int64(x))
+	case int32:
+		e.encodeInt(int64(x))
+	case int64:
+		e.encodeInt(x)
+	case uint8:
+		e.encodeInt(int64(x))
+	case uint16:
+		e.encodeInt(int64(x))
+	case uint32:
+		e.encodeInt(int64(x))
+	case uint:
+		if uint64(x) > math.MaxInt64 {
+			return fmt.Errorf("integer %d overflows PackStream int64", x)
+		}
+		e.encodeInt(int64(x))
+	case uint64:
+		if x > math.MaxInt64 {
+			return fmt.Errorf("integer %d overflows PackStream int64", x)
+		}
+		e.encodeInt(int64(x))
+	case float32:
+		e.encodeFloat(float64(x))
+	case float64:
+		e.encodeFloat(x)
+	case []byte:
+		return e.encodeBytes(x)
+	case string:
+		return e.encodeString(x)
+	case []interface{}:
+		if err := e.encodeHeader(len(x), markerTinyList, markerList8, markerList16, markerList32); err != nil {
+			return err
+		}
+		for _, item := range x {
+			if err := e.Encode(item); err != nil {
+				return err
+			}
+		}
+	case []string:
+		if err := e.encodeHeader(len(x), markerTinyList, markerList8, markerList16, markerList32); err != nil {
+			return err
+		}
+		for _, item := range x {
+			if err := e.encodeString(item); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		if err := e.encodeHeader(len(x), markerTinyMap, markerMap8, markerMap16, markerMap32); err != nil {
+			return err
+		}
+		for key, value := range x {
+			if err := e.encodeString(key); err != nil {
+				return err
+			}
+			if err := e.Encode(value); err != nil {
+				return err
+			}
+		}
+	case map[string]string:
+		if err := e.encodeHeader(len(x), markerTinyMap, markerMap8, markerMap16, markerMap32); err != nil {
+			return err
+		}
+		for key, value := range x {
+			if err := e.encodeString(key); err != nil {
+				return err
+			}
+			if err := e.encodeString(value); err != nil {
+				return err
+			}
+		}
+	case *Structure:
+		return e.EncodeStructure(x.Tag, x.Fields)
+	case Structure:
+		return e.EncodeStructure(x.Tag, x.Fields)
+	case Structurer:
+		if e.version.IsZero() {
+			return fmt.Errorf("a Bolt version is required to encode %T", v)
+		}
+		st, err := x.Structure(e.version, e.utcPatch || e.version.AtLeast(5, 0))
+		if err != nil {
+			return err
+		}
+		return e.EncodeStructure(st.Tag, st.Fields)
+	default:
+		return fmt.Errorf("unsupported PackStream type %T", v)
+	}
+	return nil
+}
+
+// EncodeStructure appends a structure with the given tag and fields
+func (e *Encoder) EncodeStructure(tag byte, fields []interface{}) error {
+	size := len(fields)
+	switch {
+	case size < 0x10:
+		e.buf = append(e.buf, markerTinyStruct|byte(size))
+	case size <= math.MaxUint8:
+		e.buf = append(e.buf, markerStruct8, byte(size))
+	case size <= math.MaxUint16:
+		e.buf = append(e.buf, markerStruct16)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(size))
+	default:
+		return fmt.Errorf("structure with %d fields is too large", size)
+	}
+	e.buf = append(e.buf, tag)
+	for _, field := range fields {
+		if err := e.Encode(field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Encoder) encodeInt(i int64) {
+	switch {
+	case i >= -16 && i <= math.MaxInt8:
+		e.buf = append(e.buf, byte(int8(i)))
+	case i >= math.MinInt8 && i <= math.MaxInt8:
+		e.buf = append(e.buf, markerInt8, byte(int8(i)))
+	case i >= math.MinInt16 && i <= math.MaxInt16:
+		e.buf = append(e.buf, markerInt16)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(int16(i)))
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		e.buf = append(e.buf, markerInt32)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(int32(i)))
+	default:
+		e.buf = append(e.buf, markerInt64)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, uint64(i))
+	}
+}
+
+func (e *Encoder) encodeFloat(f float64) {
+	e.buf = append(e.buf, markerFloat64)
+	e.buf = binary.BigEndian.AppendUint64(e.buf, math.Float64bits(f))
+}
+
+func (e *Encoder) encodeBytes(b []byte) error {
+	size := len(b)
+	switch {
+	case size <= math.MaxUint8:
+		e.buf = append(e.buf, markerBytes8, byte(size))
+	case size <= math.MaxUint16:
+		e.buf = append(e.buf, markerBytes16)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(size))
+	case uint64(size) <= math.MaxUint32:
+		e.buf = append(e.buf, markerBytes32)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(size))
+	default:
+		return fmt.Errorf("byte array of %d bytes is too large", size)
+	}
+	e.buf = append(e.buf, b...)
+	return nil
+}
+
+func (e *Encoder) encodeString(s string) error {
+	if err := e.encodeHeader(len(s), markerTinyString, markerString8, markerString16, markerString32); err != nil {
+		return err
+	}
+	e.buf = append(e.buf, s...)
+	return nil
+}
+
+// encodeHeader writes the marker and size for strings, lists and maps
+func (e *Encoder) encodeHeader(size int, tiny, m8, m16, m32 byte) error {
+	switch {
+	case size < 0x10:
+		e.buf = append(e.buf, tiny|byte(size))
+	case size <= math.MaxUint8:
+		e.buf = append(e.buf, m8, byte(size))
+	case size <= math.MaxUint16:
+		e.buf = append(e.buf, m16)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(size))
+	case uint64(size) <= math.MaxUint32:
+		e.buf = append(e.buf, m32)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(size))
+	default:
+		return fmt.Errorf("value of size %d is too large", size)
+	}
+	return nil
+}
+
+// Decoder deserializes PackStream data into Go values.
+// Integers decode as int64, floats as float64, lists as []interface{},
+// maps as map[string]interface{} and structures as *Structure.
+type Decoder struct {
+	data   []byte
+	pos    int
+	limits Limits
+	depth  int
+}
+
+// NewDecoder creates a new PackStream decoder over data
+func NewDecoder(data []byte) *Decoder {
+	return &Decoder{data: data}
+}
+
+// SetLimits bounds the nesting and the sizes the decoder accepts; values
+// exceeding them fail with a *LimitError
+func (d *Decoder) SetLimits(l Limits) {
+	d.limits = l
+}
+
+// Remaining returns the number of undecoded bytes
+func (d *Decoder) Remaining() int {
+	return len(d.data) - d.pos
+}
+
+// Decode decodes the next value
+func (d *Decoder) Decode() (interface{}, error) {
+	marker, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case marker < 0x80:
+		return int64(marker), nil
+	case marker >= 0xF0:
+		return int64(int8(marker)), nil
+	case marker&0xF0 == markerTinyString:
+		return d.readString(int(marker & 0x0F))
+	case marker&0xF0 == markerTinyList:
+		return d.readList(int(marker & 0x0F))
+	case marker&0xF0 == markerTinyMap:
+		return d.readMap(int(marker & 0x0F))
+	case marker&0xF0 == markerTinyStruct:
+		return d.readStructure(int(marker & 0x0F))
+	}
+
+	switch marker {
+	case markerNull:
+		return nil, nil
+	case markerFalse:
+		return false, nil
+	case markerTrue:
+		return true, nil
+	case markerFloat64:
+		b, err := d.readN(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	case markerInt8:
+		b, err := d.readN(1)
+		if err != nil {
+			return nil, err
+		}
+		return int64(int8(b[0])), nil
+	case markerInt16:
+		b, err := d.readN(2)
+		if err != nil {
+			return nil, err
+		}
+		return int64(int16(binary.BigEndian.Uint16(b))), nil
+	case markerInt32:
+		b, err := d.readN(4)
+		if err != nil {
+			return nil, err
+		}
+		return int64(int32(binary.BigEndian.Uint32(b))), nil
+	case markerInt64:
+		b, err := d.readN(8)
+		if err != nil {
+			return nil, err
+		}
+		return int64(binary.BigEndian.Uint64(b)), nil
+	case markerBytes8, markerBytes16, markerBytes32:
+		size, err := d.readSize(marker - markerBytes8)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkLimit(LimitStringLength, size, d.limits.MaxStringLength); err != nil {
+			return nil, err
+		}
+		b, err := d.readN(size)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), b...), nil
+	case markerString8, markerString16, markerString32:
+		size, err := d.readSize(marker - markerString8)
+		if err != nil {
+			return nil, err
+		}
+		return d.readString(size)
+	case markerList8, markerList16, markerList32:
+		size, err := d.readSize(marker - markerList8)
+		if err != nil {
+			return nil, err
+		}
+		return d.readList(size)
+	case markerMap8, markerMap16, markerMap32:
+		size, err := d.readSize(marker - markerMap8)
+		if err != nil {
+			return nil, err
+		}
+		return d.readMap(size)
+	case markerStruct8, markerStruct16:
+		size, err := d.readSize(marker - markerStruct8)
+		if err != nil {
+			return nil, err
+		}
+		return d.readStructure(size)
+	}
+
+	return nil, fmt.Errorf("unknown PackStream marker 0x%02X", marker)
+}
+
+// readSize reads a 1, 2 or 4 byte unsigned size depending on width (0, 1, 2)
+func (d *Decoder) readSize(width byte) (int, error) {
+	switch width {
+	case 0:
+		b, err := d.readN(1)
+		if err != nil {
+			return 0, err
+		}
+		return int(b[0]), nil
+	case 1:
+		b, err := d.readN(2)
+		if err != nil {
+			return 0, err
+		}
+		return int(binary.BigEndian.Uint16(b)), nil
+	default:
+		b, err := d.readN(4)
+		if err != nil {
+			return 0, err
+		}
+		return int(binary.BigEndian.Uint32(b)), nil
+	}
+}
+
+func (d *Decoder) readString(size int) (string, error) {
+	if err := checkLimit(LimitStringLength, size, d.limits.MaxStringLength); err != nil {
+		return "", err
+	}
+	b, err := d.readN(size)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (d *Decoder) readList(size int) ([]interface{}, error) {
+	if err := d.enter(size); err != nil {
+		return nil, err
+	}
+	defer d.leave()
+	// Every item takes at least one byte, so never preallocate past the input
+	list := make([]interface{}, 0, min(size, d.Remaining()))
+	for i := 0; i < size; i++ {
+		item, err := d.Decode()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, item)
+	}
+	return list, nil
+}
+
+func (d *Decoder) readMap(size int) (map[string]interface{}, error) {
+	if err := d.enter(size); err != nil {
+		return nil, err
+	}
+	defer d.leave()
+	m := make(map[string]interface{}, min(size, d.Remaining()/2))
+	for i := 0; i < size; i++ {
+		key, err := d.Decode()
+		if err != nil {
+			return nil, err
+		}
+		keyStr, ok := key.(string)
+		if !ok {
+			return nil, fmt.Errorf("map key must be a string, got %T", key)
+		}
+		value, err := d.Decode()
+		if err != nil {
+			return nil, err
+		}
+		m[keyStr] = value
+	}
+	return m, nil
+}
+
+func (d *Decoder) readStructure(size int) (*Structure, error) {
+	tag, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+	// The fields count as the structure's own nesting level
+	fields, err := d.readList(size)
+	if err != nil {
+		return nil, err
+	}
+	return &Structure{Tag: tag, Fields: fields}, nil
+}
+
+// enter checks a collection of size entries against the limits before it
+// is read, one nesting level below the current one
+func (d *Decoder) enter(size int) error {
+	if err := checkLimit(LimitCollectionLength, size, d.limits.MaxCollectionLength); err != nil {
+		return err
+	}
+	d.depth++
+	return checkLimit(LimitDepth, d.depth, d.limits.MaxDepth)
+}
+
+func (d *Decoder) leave() {
+	d.depth--
+}
+
+func (d *Decoder) readByte() (byte, error) {
+	if d.pos >= len(d.data) {
+		return 0, ErrUnexpectedEOF
+	}
+	b := d.data[d.pos]
+	d.pos++
+	return b, nil
+}
+
+func (d *Decoder) readN(n int) ([]byte, error) {
+	if n < 0 || n > d.Remaining() {
+		return nil, ErrUnexpectedEOF
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+// Marshal encodes a single value into PackStream
+func Marshal(v interface{}) ([]byte, error) {
+	enc := NewEncoder()
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return enc.Bytes(), nil
+}
+
+// Unmarshal decodes a single PackStream value, rejecting trailing data
+func Unmarshal(data []byte) (interface{}, error) {
+	dec := NewDecoder(data)
+	v, err := dec.Decode()
+	if err != nil {
+		return nil, err
+	}
+	if dec.Remaining() != 0 {
+		return nil, fmt.Errorf("%d trailing bytes after PackStream value", dec.Remaining())
+	}
+	return v, nil
+}
+
+// EncodeMessage serializes a message as a PackStream structure
+func EncodeMessage(msg *Message) ([]byte, error) {
+	enc := NewEncoder()
+	if err := enc.EncodeStructure(msg.Signature, msg.Fields); err != nil {
+		return nil, err
+	}
+	return enc.Bytes(), nil
+}
+
+// DecodeMessage deserializes a message from its PackStream structure
+func DecodeMessage(data []byte) (*Message, error) {
+	return decodeMessage(data, Limits{})
+}
+
+// decodeMessage deserializes a message within the given limits
+func decodeMessage(data []byte, limits Limits) (*Message, error) {
+	if err := checkLimit(LimitMessageSize, len(data), limits.MaxMessageSize); err != nil {
+		return nil, err
+	}
+	dec := NewDecoder(data)
+	dec.SetLimits(limits)
+	v, err := dec.Decode()
+	if err != nil {
+		return nil, err
+	}
+	if dec.Remaining() != 0 {
+		return nil, fmt.Errorf("%d trailing bytes after PackStream value", dec.Remaining())
+	}
+	s, ok := v.(*Structure)
+	if !ok {
+		return nil, fmt.Errorf("message must be a structure, got %T", v)
+	}
+	return &Message{Signature: s.Tag, Fields: s.Fields}, nil
+}
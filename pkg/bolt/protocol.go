@@ -1,28 +1,34 @@
 package bolt
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
-	"io"
+	"fmt"
 	"net"
+	"slices"
 )
 
 const (
 	// Bolt protocol magic number
-	BoltMagicPreamble = 0x6060B017
-	
-	// Message types
-	MsgInit     = 0x01
-	MsgRun      = 0x10
-	MsgRecord   = 0x71
-	MsgSuccess  = 0x70
-	MsgFailure  = 0x7F
-	MsgIgnored  = 0x7E
-	MsgPullAll  = 0x3F
-	MsgDiscardAll = 0x2F
-	MsgReset    = 0x0F
-	MsgBye      = 0x02
-	
+	BoltMagicPreamble uint32 = 0x6060B017
+)
+
+// Message types
+const (
+	MsgInit       byte = 0x01
+	MsgRun        byte = 0x10
+	MsgRecord     byte = 0x71
+	MsgSuccess    byte = 0x70
+	MsgFailure    byte = 0x7F
+	MsgIgnored    byte = 0x7E
+	MsgPullAll    byte = 0x3F
+	MsgDiscardAll byte = 0x2F
+	MsgReset      byte = 0x0F
+	MsgBye        byte = 0x02
+)
+
+const (
 	// Bolt versions
 	Version1 = 1
 	Version2 = 2
@@ -38,115 +44,141 @@ type Message struct {
 
 // Connection represents a Bolt protocol connection
 type Connection struct {
-	conn    net.Conn
-	version int
+	conn      net.Conn
+	version   Version
+	supported []Version
+	utcPatch  bool
+	limits    Limits
 }
 
 // NewConnection creates a new Bolt connection wrapper
 func NewConnection(conn net.Conn) *Connection {
 	return &Connection{
-		conn: conn,
+		conn:      conn,
+		supported: DefaultSupportedVersions,
 	}
 }
 
-// Handshake performs the Bolt protocol handshake
+// SetSupportedVersions restricts the versions accepted during the handshake
+func (c *Connection) SetSupportedVersions(versions []Version) {
+	c.supported = versions
+}
+
+// Handshake performs the server side of the Bolt protocol handshake
 func (c *Connection) Handshake() error {
+	proposals, err := c.ReadHandshake()
+	if err != nil {
+		return err
+	}
+	
+	// Choose the first proposal we support, taking minor version ranges and
+	// the manifest into account
+	return c.AnswerProposals(proposals, c.supported)
+}
+
+// ReadHandshake reads the client's magic preamble and version proposals
+// without answering, so the caller can consult a backend before choosing
+func (c *Connection) ReadHandshake() ([]uint32, error) {
 	// Read the magic preamble
 	var magic uint32
 	if err := binary.Read(c.conn, binary.BigEndian, &magic); err != nil {
-		return err
+		return nil, err
 	}
 	
 	if magic != BoltMagicPreamble {
-		return errors.New("invalid Bolt magic preamble")
+		return nil, errors.New("invalid Bolt magic preamble")
 	}
 	
 	// Read supported versions (4 x uint32)
-	versions := make([]uint32, 4)
-	for i := 0; i < 4; i++ {
-		if err := binary.Read(c.conn, binary.BigEndian, &versions[i]); err != nil {
-			return err
-		}
+	proposals := make([]uint32, 4)
+	if err := binary.Read(c.conn, binary.BigEndian, proposals); err != nil {
+		return nil, err
 	}
 	
-	// Choose the highest supported version (for now, support version 4)
-	selectedVersion := uint32(0)
-	for _, version := range versions {
-		if version <= Version4 && version > selectedVersion {
-			selectedVersion = version
-		}
+	return proposals, nil
+}
+
+// AnswerHandshake sends the chosen version to the client. A zero version
+// tells the client that none of its proposals are acceptable.
+func (c *Connection) AnswerHandshake(v Version) error {
+	if err := binary.Write(c.conn, binary.BigEndian, v.Encode()); err != nil {
+		return err
 	}
-	
-	if selectedVersion == 0 {
-		selectedVersion = Version1
+	if v.IsZero() {
+		return ErrNoCompatibleVersion
 	}
 	
-	c.version = int(selectedVersion)
-	
-	// Send back the selected version
-	return binary.Write(c.conn, binary.BigEndian, selectedVersion)
+	c.version = v
+	return nil
 }
 
-// ReadMessage reads a message from the connection
-func (c *Connection) ReadMessage() (*Message, error) {
-	// Read chunk size
-	var chunkSize uint16
-	if err := binary.Read(c.conn, binary.BigEndian, &chunkSize); err != nil {
-		return nil, err
+// SetUTCPatch records that the "utc" patch was agreed in HELLO, so date
+// times written on this Bolt 4.4 connection use the UTC layout
+func (c *Connection) SetUTCPatch(enabled bool) {
+	c.utcPatch = enabled
+}
+
+// SetLimits bounds the messages ReadMessage accepts; messages exceeding
+// them fail with a *LimitError
+func (c *Connection) SetLimits(l Limits) {
+	c.limits = l
+}
+
+// ClientHandshake performs the client side of the Bolt handshake, as used
+// by the proxy when connecting to a backend: it sends the magic preamble and
+// version proposals and reads the version chosen by the server
+func (c *Connection) ClientHandshake() error {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, BoltMagicPreamble)
+	binary.Write(&buf, binary.BigEndian, c.clientProposals())
+	if _, err := c.conn.Write(buf.Bytes()); err != nil {
+		return err
 	}
 	
-	if chunkSize == 0 {
-		return nil, errors.New("empty chunk")
+	var agreed uint32
+	if err := binary.Read(c.conn, binary.BigEndian, &agreed); err != nil {
+		return err
 	}
-	
-	// Read chunk data
-	data := make([]byte, chunkSize)
-	if _, err := io.ReadFull(c.conn, data); err != nil {
-		return nil, err
+	if agreed == ManifestV1 {
+		return c.confirmManifest()
 	}
 	
-	// Parse message (simplified - in production would need full PackStream parser)
-	if len(data) < 1 {
-		return nil, errors.New("invalid message format")
+	selected := DecodeVersionRange(agreed).Max
+	if agreed == 0 {
+		return ErrNoCompatibleVersion
 	}
-	
-	msg := &Message{
-		Signature: data[0],
-		Fields:    []interface{}{}, // Simplified for now
+	if !slices.Contains(c.supported, selected) {
+		return fmt.Errorf("server selected unsupported Bolt version %s", selected)
 	}
 	
-	return msg, nil
+	c.version = selected
+	return nil
 }
 
-// WriteMessage writes a message to the connection
-func (c *Connection) WriteMessage(msg *Message) error {
-	// Simplified message writing (in production would need full PackStream serializer)
-	data := []byte{msg.Signature}
-	
-	// Write chunk size
-	chunkSize := uint16(len(data))
-	if err := binary.Write(c.conn, binary.BigEndian, chunkSize); err != nil {
-		return err
+// ReadMessage reads a message from the connection, reassembling it from
+// as many chunks as the sender used and skipping NOOP chunks between messages
+func (c *Connection) ReadMessage() (*Message, error) {
+	data, err := readChunks(c.conn, c.limits.MaxMessageSize)
+	if err != nil {
+		return nil, err
 	}
 	
-	// Write chunk data
-	_, err := c.conn.Write(data)
-	return err
+	return decodeMessage(data, c.limits)
 }
 
-// ExtractTenantID extracts tenant identifier from the connection
-// This is a simplified implementation - in practice you might extract from
-// authentication credentials, connection parameters, or other metadata
-func (c *Connection) ExtractTenantID(msg *Message) (string, error) {
-	// For now, we'll use a simple round-robin approach
-	// In production, this would extract from authentication or connection metadata
-	if msg.Signature == MsgInit {
-		// For demo purposes, assume tenant ID is in connection metadata
-		// This would be extracted from the INIT message fields in a real implementation
-		return "tenant1", nil // Simplified
-	}
-	
-	return "", errors.New("unable to determine tenant ID")
+// WriteMessage writes a message to the connection, splitting it into
+// chunks of at most MaxChunkSize bytes followed by an end-of-message marker
+func (c *Connection) WriteMessage(msg *Message) error {
+	// Typed values in the fields are laid out for the negotiated version
+	writer := NewFrameWriter(c.conn)
+	writer.SetVersion(c.version)
+	writer.SetUTCPatch(c.utcPatch)
+	return writer.WriteMessage(msg)
+}
+
+// NetConn returns the underlying network connection
+func (c *Connection) NetConn() net.Conn {
+	return c.conn
 }
 
 // Close closes the underlying connection
@@ -155,6 +187,6 @@ func (c *Connection) Close() error {
 }
 
 // GetVersion returns the negotiated protocol version
-func (c *Connection) GetVersion() int {
+func (c *Connection) GetVersion() Version {
 	return c.version
-}
\ No newline at end of file
+}
@@ -0,0 +1,310 @@
+package bolt
+
+import (
+	"fmt"
+	"sync"
+)
+
+// State is the state of a Bolt connection as seen by the server
+type State int
+
+// Connection states from the Bolt server state machine
+const (
+	StateConnected State = iota
+	// StateAuthentication waits for LOGON (Bolt 5.1+)
+	StateAuthentication
+	StateReady
+	StateStreaming
+	StateTxReady
+	StateTxStreaming
+	StateFailed
+	StateInterrupted
+	StateDefunct
+)
+
+var stateNames = [...]string{
+	StateConnected:      "CONNECTED",
+	StateAuthentication: "AUTHENTICATION",
+	StateReady:          "READY",
+	StateStreaming:      "STREAMING",
+	StateTxReady:        "TX_READY",
+	StateTxStreaming:    "TX_STREAMING",
+	StateFailed:         "FAILED",
+	StateInterrupted:    "INTERRUPTED",
+	StateDefunct:        "DEFUNCT",
+}
+
+// String returns the state name used in the Bolt specification
+func (s State) String() string {
+	if s < 0 || int(s) >= len(stateNames) {
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+	return stateNames[s]
+}
+
+// TransitionError reports a request that is not allowed in the current state
+type TransitionError struct {
+	State     State
+	Signature byte
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("message 0x%02X is not allowed in state %s", e.Signature, e.State)
+}
+
+// stateSet is a set of states, used to follow pipelined requests whose
+// outcome is not known yet
+type stateSet uint16
+
+func (s stateSet) has(state State) bool {
+	return s&(1<<state) != 0
+}
+
+func setOf(states ...State) stateSet {
+	var s stateSet
+	for _, state := range states {
+		s |= 1 << state
+	}
+	return s
+}
+
+// StateMachine follows the state of a Bolt connection from the requests a
+// client sends and the responses the server returns. It is safe for use by
+// the two relay directions at once.
+type StateMachine struct {
+	mu      sync.Mutex
+	version Version
+	state   State
+	streams int    // open results inside a transaction
+	pending []byte // requests awaiting a summary, oldest first
+	idle    chan struct{}
+}
+
+// NewStateMachine creates a state machine for a connection speaking version v
+func NewStateMachine(v Version) *StateMachine {
+	idle := make(chan struct{})
+	close(idle)
+	return &StateMachine{version: v, idle: idle}
+}
+
+// State returns the state confirmed by the server's responses so far
+func (m *StateMachine) State() State {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state
+}
+
+// Pending returns the number of requests still awaiting a summary
+func (m *StateMachine) Pending() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.pending)
+}
+
+// Idle returns a channel that is closed once no requests are pending
+func (m *StateMachine) Idle() <-chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.idle
+}
+
+// Request records a client request. Pipelined requests are checked against
+// every state the connection may be in once the earlier requests succeed,
+// and a *TransitionError is returned if none of them allows the request.
+func (m *StateMachine) Request(sig byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	possible := setOf(m.state)
+	for _, earlier := range m.pending {
+		possible = m.successors(possible, earlier)
+	}
+	if m.successors(possible, sig) == 0 {
+		return &TransitionError{State: m.state, Signature: sig}
+	}
+
+	switch sig {
+	case MsgGoodbye:
+		// GOODBYE has no response; the server closes the connection
+		m.state = StateDefunct
+		return nil
+	case MsgReset:
+		// The server interrupts the current work as soon as RESET arrives
+		m.state = StateInterrupted
+	}
+	if len(m.pending) == 0 {
+		m.idle = make(chan struct{})
+	}
+	m.pending = append(m.pending, sig)
+	return nil
+}
+
+// Response records a server response. metadata is the SUCCESS metadata
+// and may be nil for other responses.
+func (m *StateMachine) Response(sig byte, metadata map[string]interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if sig == MsgRecord || len(m.pending) == 0 {
+		return
+	}
+	request := m.pending[0]
+	m.pending = m.pending[1:]
+	if len(m.pending) == 0 {
+		close(m.idle)
+	}
+
+	switch sig {
+	case MsgSuccess:
+		m.succeeded(request, metadata)
+	case MsgFailure:
+		switch {
+		case request == MsgReset, request == MsgHello, request == MsgLogon:
+			m.state = StateDefunct
+		case m.state != StateInterrupted && m.state != StateDefunct:
+			m.state = StateFailed
+		}
+	}
+	// IGNORED leaves the state unchanged
+}
+
+// succeeded applies the transition for a successful request
+func (m *StateMachine) succeeded(request byte, metadata map[string]interface{}) {
+	if m.state == StateDefunct {
+		return
+	}
+	if m.state == StateInterrupted && request != MsgReset {
+		// Work that completed before the RESET arrived
+		return
+	}
+
+	hasMore, _ := metadata["has_more"].(bool)
+	switch request {
+	case MsgHello:
+		m.state = StateReady
+		if m.version.AtLeast(5, 1) {
+			m.state = StateAuthentication
+		}
+	case MsgLogon, MsgReset, MsgAckFailure:
+		m.state = StateReady
+		m.streams = 0
+	case MsgLogoff:
+		m.state = StateAuthentication
+	case MsgBegin:
+		m.state = StateTxReady
+	case MsgCommit, MsgRollback:
+		m.state = StateReady
+		m.streams = 0
+	case MsgRun:
+		switch m.state {
+		case StateReady:
+			m.state = StateStreaming
+		case StateTxReady, StateTxStreaming:
+			m.state = StateTxStreaming
+			m.streams++
+		}
+	case MsgPull, MsgDiscard:
+		if hasMore {
+			return
+		}
+		switch m.state {
+		case StateStreaming:
+			m.state = StateReady
+		case StateTxStreaming:
+			if m.streams--; m.streams <= 0 {
+				m.state = StateTxReady
+				m.streams = 0
+			}
+		}
+	}
+}
+
+// successors returns the states reachable from any of the states in from
+// when sig succeeds, or an empty set if no state allows sig
+func (m *StateMachine) successors(from stateSet, sig byte) stateSet {
+	var to stateSet
+	for state := StateConnected; state <= StateDefunct; state++ {
+		if from.has(state) {
+			to |= m.next(state, sig)
+		}
+	}
+	return to
+}
+
+// next returns the states a successful sig leads to from state
+func (m *StateMachine) next(state State, sig byte) stateSet {
+	v := m.version
+	switch {
+	case state == StateDefunct, !isRequest(sig):
+		return 0
+	case sig == MsgReset:
+		return setOf(StateReady)
+	case sig == MsgGoodbye && v.AtLeast(3, 0):
+		return setOf(StateDefunct)
+	case state == StateFailed || state == StateInterrupted:
+		// The server answers IGNORED to anything but RESET (or ACK_FAILURE)
+		if sig == MsgAckFailure && !v.AtLeast(3, 0) && state == StateFailed {
+			return setOf(StateReady)
+		}
+		return setOf(state)
+	}
+
+	switch state {
+	case StateConnected:
+		if sig == MsgHello {
+			if v.AtLeast(5, 1) {
+				return setOf(StateAuthentication)
+			}
+			return setOf(StateReady)
+		}
+	case StateAuthentication:
+		if sig == MsgLogon {
+			return setOf(StateReady)
+		}
+	case StateReady:
+		switch {
+		case sig == MsgRun:
+			return setOf(StateStreaming)
+		case sig == MsgBegin && v.AtLeast(3, 0):
+			return setOf(StateTxReady)
+		case sig == MsgRoute && v.AtLeast(4, 3):
+			return setOf(StateReady)
+		case sig == MsgTelemetry && v.AtLeast(5, 4):
+			return setOf(StateReady)
+		case sig == MsgLogoff && v.AtLeast(5, 1):
+			return setOf(StateAuthentication)
+		}
+	case StateStreaming:
+		if sig == MsgPull || sig == MsgDiscard {
+			return setOf(StateStreaming, StateReady)
+		}
+	case StateTxReady:
+		switch sig {
+		case MsgRun:
+			return setOf(StateTxStreaming)
+		case MsgCommit, MsgRollback:
+			return setOf(StateReady)
+		}
+	case StateTxStreaming:
+		switch sig {
+		case MsgRun:
+			return setOf(StateTxStreaming)
+		case MsgPull, MsgDiscard:
+			return setOf(StateTxStreaming, StateTxReady)
+		case MsgCommit, MsgRollback:
+			// The server discards open results when the transaction ends
+			return setOf(StateReady)
+		}
+	}
+	return 0
+}
+
+// isRequest reports whether sig is a message clients send
+func isRequest(sig byte) bool {
+	switch sig {
+	case MsgHello, MsgGoodbye, MsgAckFailure, MsgReset, MsgRun, MsgBegin, MsgCommit,
+		MsgRollback, MsgDiscard, MsgPull, MsgTelemetry, MsgRoute, MsgLogon, MsgLogoff:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,218 @@
+package bolt
+
+import (
+	"fmt"
+	"time"
+
+	// Zone ids must resolve even on hosts without a time zone database
+	_ "time/tzdata"
+)
+
+// Temporal and spatial structure tags
+const (
+	TagDate                 byte = 0x44
+	TagTime                 byte = 0x54
+	TagLocalTime            byte = 0x74
+	TagDateTime             byte = 0x49
+	TagDateTimeZoneID       byte = 0x69
+	TagLegacyDateTime       byte = 0x46
+	TagLegacyDateTimeZoneID byte = 0x66
+	TagLocalDateTime        byte = 0x64
+	TagDuration             byte = 0x45
+	TagPoint2D              byte = 0x58
+	TagPoint3D              byte = 0x59
+)
+
+// Date is a calendar date without time zone
+type Date struct {
+	Days int64 // days since the Unix epoch
+}
+
+// Time is a time of day with a fixed UTC offset
+type Time struct {
+	Nanoseconds   int64 // nanoseconds since midnight, local time
+	OffsetSeconds int64
+}
+
+// LocalTime is a time of day without time zone
+type LocalTime struct {
+	Nanoseconds int64 // nanoseconds since midnight
+}
+
+// DateTime is an instant with a fixed UTC offset
+type DateTime struct {
+	Seconds       int64 // seconds since the Unix epoch, UTC
+	Nanoseconds   int64
+	OffsetSeconds int64
+}
+
+// DateTimeZoneID is an instant in a named time zone
+type DateTimeZoneID struct {
+	Seconds     int64 // seconds since the Unix epoch, UTC
+	Nanoseconds int64
+	ZoneID      string
+}
+
+// LocalDateTime is a date and time without time zone
+type LocalDateTime struct {
+	Seconds     int64 // seconds since the Unix epoch, wall clock
+	Nanoseconds int64
+}
+
+// Duration is a temporal amount
+type Duration struct {
+	Months      int64
+	Days        int64
+	Seconds     int64
+	Nanoseconds int64
+}
+
+// Point2D is a two-dimensional point in the coordinate system SRID
+type Point2D struct {
+	SRID int64
+	X, Y float64
+}
+
+// Point3D is a three-dimensional point in the coordinate system SRID
+type Point3D struct {
+	SRID    int64
+	X, Y, Z float64
+}
+
+// Time returns the date as midnight UTC
+func (d *Date) Time() time.Time {
+	return time.Unix(d.Days*86400, 0).UTC()
+}
+
+// Time returns the instant in its fixed offset zone
+func (d *DateTime) Time() time.Time {
+	return time.Unix(d.Seconds, d.Nanoseconds).In(time.FixedZone("", int(d.OffsetSeconds)))
+}
+
+// Time returns the instant in its named zone
+func (d *DateTimeZoneID) Time() (time.Time, error) {
+	loc, err := time.LoadLocation(d.ZoneID)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unknown time zone %q: %w", d.ZoneID, err)
+	}
+	return time.Unix(d.Seconds, d.Nanoseconds).In(loc), nil
+}
+
+// Time returns the wall clock time with a UTC location
+func (d *LocalDateTime) Time() time.Time {
+	return time.Unix(d.Seconds, d.Nanoseconds).UTC()
+}
+
+// Structure encodes the date
+func (d *Date) Structure(v Version, utc bool) (*Structure, error) {
+	return &Structure{Tag: TagDate, Fields: []interface{}{d.Days}}, nil
+}
+
+// Structure encodes the time
+func (t *Time) Structure(v Version, utc bool) (*Structure, error) {
+	return &Structure{Tag: TagTime, Fields: []interface{}{t.Nanoseconds, t.OffsetSeconds}}, nil
+}
+
+// Structure encodes the local time
+func (t *LocalTime) Structure(v Version, utc bool) (*Structure, error) {
+	return &Structure{Tag: TagLocalTime, Fields: []interface{}{t.Nanoseconds}}, nil
+}
+
+// Structure encodes the date time, using local seconds in the legacy layout
+func (d *DateTime) Structure(v Version, utc bool) (*Structure, error) {
+	if utc {
+		return &Structure{Tag: TagDateTime, Fields: []interface{}{d.Seconds, d.Nanoseconds, d.OffsetSeconds}}, nil
+	}
+	return &Structure{Tag: TagLegacyDateTime, Fields: []interface{}{d.Seconds + d.OffsetSeconds, d.Nanoseconds, d.OffsetSeconds}}, nil
+}
+
+// Structure encodes the date time, using local seconds in the legacy layout
+func (d *DateTimeZoneID) Structure(v Version, utc bool) (*Structure, error) {
+	if utc {
+		return &Structure{Tag: TagDateTimeZoneID, Fields: []interface{}{d.Seconds, d.Nanoseconds, d.ZoneID}}, nil
+	}
+	t, err := d.Time()
+	if err != nil {
+		return nil, err
+	}
+	_, offset := t.Zone()
+	return &Structure{Tag: TagLegacyDateTimeZoneID, Fields: []interface{}{d.Seconds + int64(offset), d.Nanoseconds, d.ZoneID}}, nil
+}
+
+// Structure encodes the local date time
+func (d *LocalDateTime) Structure(v Version, utc bool) (*Structure, error) {
+	return &Structure{Tag: TagLocalDateTime, Fields: []interface{}{d.Seconds, d.Nanoseconds}}, nil
+}
+
+// Structure encodes the duration
+func (d *Duration) Structure(v Version, utc bool) (*Structure, error) {
+	return &Structure{Tag: TagDuration, Fields: []interface{}{d.Months, d.Days, d.Seconds, d.Nanoseconds}}, nil
+}
+
+// Structure encodes the point
+func (p *Point2D) Structure(v Version, utc bool) (*Structure, error) {
+	return &Structure{Tag: TagPoint2D, Fields: []interface{}{p.SRID, p.X, p.Y}}, nil
+}
+
+// Structure encodes the point
+func (p *Point3D) Structure(v Version, utc bool) (*Structure, error) {
+	return &Structure{Tag: TagPoint3D, Fields: []interface{}{p.SRID, p.X, p.Y, p.Z}}, nil
+}
+
+// decodeTemporal converts temporal and spatial structures; ok is false for other tags
+func decodeTemporal(s *Structure, v Version) (value interface{}, ok bool, err error) {
+	f := structReader{s: s, v: v}
+	switch s.Tag {
+	case TagDate:
+		f.count(1)
+		value = &Date{Days: f.int(0)}
+	case TagTime:
+		f.count(2)
+		value = &Time{Nanoseconds: f.int(0), OffsetSeconds: f.int(1)}
+	case TagLocalTime:
+		f.count(1)
+		value = &LocalTime{Nanoseconds: f.int(0)}
+	case TagDateTime:
+		f.count(3)
+		value = &DateTime{Seconds: f.int(0), Nanoseconds: f.int(1), OffsetSeconds: f.int(2)}
+	case TagLegacyDateTime:
+		f.count(3)
+		offset := f.int(2)
+		value = &DateTime{Seconds: f.int(0) - offset, Nanoseconds: f.int(1), OffsetSeconds: offset}
+	case TagDateTimeZoneID:
+		f.count(3)
+		value = &DateTimeZoneID{Seconds: f.int(0), Nanoseconds: f.int(1), ZoneID: f.string(2)}
+	case TagLegacyDateTimeZoneID:
+		f.count(3)
+		local, nanos, zone := f.int(0), f.int(1), f.string(2)
+		if f.err != nil {
+			return nil, true, f.err
+		}
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			return nil, true, fmt.Errorf("unknown time zone %q: %w", zone, err)
+		}
+		// Interpret the local wall clock seconds in the zone to find the instant
+		wall := time.Unix(local, 0).UTC()
+		instant := time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), wall.Second(), 0, loc)
+		value = &DateTimeZoneID{Seconds: instant.Unix(), Nanoseconds: nanos, ZoneID: zone}
+	case TagLocalDateTime:
+		f.count(2)
+		value = &LocalDateTime{Seconds: f.int(0), Nanoseconds: f.int(1)}
+	case TagDuration:
+		f.count(4)
+		value = &Duration{Months: f.int(0), Days: f.int(1), Seconds: f.int(2), Nanoseconds: f.int(3)}
+	case TagPoint2D:
+		f.count(3)
+		value = &Point2D{SRID: f.int(0), X: f.float(1), Y: f.float(2)}
+	case TagPoint3D:
+		f.count(4)
+		value = &Point3D{SRID: f.int(0), X: f.float(1), Y: f.float(2), Z: f.float(3)}
+	default:
+		return nil, false, nil
+	}
+	if f.err != nil {
+		return nil, true, f.err
+	}
+	return value, true, nil
+}
@@ -0,0 +1,334 @@
+package bolt
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync/atomic"
+)
+
+// TranslationFailureCode is the FAILURE code returned for requests that
+// cannot be expressed in the backend's Bolt version
+const TranslationFailureCode = "Neo.ClientError.Request.Invalid"
+
+// Translator converts messages between a client and a backend that
+// negotiated different Bolt versions. Requests the backend cannot express
+// are answered with FAILURE by the translator itself, and the replies it
+// makes are queued so the client sees every response in request order.
+//
+// A Translator is not safe for concurrent use; the relay serializes calls.
+type Translator struct {
+	client  Version
+	backend Version
+
+	replies []*reply // expected replies, oldest first
+	failed  bool     // a translation FAILURE was sent, IGNORE until RESET
+	// skip counts backend summaries still due for a reply that was already
+	// finished by an earlier FAILURE or IGNORED
+	skip int
+
+	hello     *Hello // HELLO held back until LOGON, for backends before 5.1
+	wantUTC   bool   // the Bolt 4.4 client asked for the "utc" patch
+	clientUTC bool
+}
+
+// reply describes how the client is answered for one request
+type reply struct {
+	// summaries is the number of backend summaries that answer the request;
+	// zero means the translator answers with synthetic
+	summaries int
+	synthetic TypedMessage
+	// hello marks the reply to HELLO, which acknowledges patches
+	hello bool
+	// merged collects the summaries of a request the backend answers twice
+	merged []TypedMessage
+}
+
+// NewTranslator creates a translator for a client speaking version client
+// and a backend speaking version backend
+func NewTranslator(client, backend Version) *Translator {
+	return &Translator{client: client, backend: backend}
+}
+
+// ClientUTC reports whether date times sent to the client use the UTC layout
+func (t *Translator) ClientUTC() bool {
+	return t.clientUTC
+}
+
+// Request translates a client request into the messages to send to the
+// backend. Requests that cannot be translated produce no messages; their
+// FAILURE is returned by the next Flush.
+func (t *Translator) Request(msg *Message) ([]*Message, error) {
+	typed, err := ParseMessage(msg, t.client)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.failed {
+		switch typed.(type) {
+		case *Reset:
+			t.failed = false
+		case *Goodbye:
+		default:
+			t.answer(&Ignored{})
+			return nil, nil
+		}
+	}
+
+	queued := len(t.replies)
+	msgs, err := t.translateRequest(typed)
+	if err != nil {
+		// Drop the replies queued for the request and answer it here
+		t.replies = t.replies[:queued]
+		t.failed = true
+		t.answer(&Failure{
+			Code:    TranslationFailureCode,
+			Message: fmt.Sprintf("cannot translate from Bolt %s to Bolt %s: %v", t.client, t.backend, err),
+		})
+		return nil, nil
+	}
+	return msgs, nil
+}
+
+// translateRequest translates and encodes a request for the backend
+func (t *Translator) translateRequest(typed TypedMessage) ([]*Message, error) {
+	out, err := t.translate(typed)
+	if err != nil {
+		return nil, err
+	}
+	msgs := make([]*Message, 0, len(out))
+	for _, m := range out {
+		encoded, err := m.Encode(t.backend)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, encoded)
+	}
+	return msgs, nil
+}
+
+// translate maps a client request onto backend requests and queues the
+// expected reply
+func (t *Translator) translate(typed TypedMessage) ([]TypedMessage, error) {
+	switch m := typed.(type) {
+	case *Hello:
+		return t.translateHello(m)
+	case *Logon:
+		if t.hello != nil {
+			// Send the HELLO held back for a backend without LOGON; its
+			// SUCCESS answers the LOGON
+			hello := t.hello
+			t.hello = nil
+			hello.Auth = m.Auth
+			t.expect(1)
+			return []TypedMessage{hello}, nil
+		}
+	case *Logoff:
+		if !t.backend.AtLeast(5, 1) {
+			return nil, errors.New("LOGOFF needs Bolt 5.1")
+		}
+	case *Telemetry:
+		if !t.backend.AtLeast(5, 4) {
+			// Telemetry is advisory, so older backends simply skip it
+			t.answer(&Success{Metadata: map[string]interface{}{}})
+			return nil, nil
+		}
+	case *Run:
+		if err := t.checkExtra(m.Extra); err != nil {
+			return nil, err
+		}
+		params, err := DecodeValue(nonNilMap(m.Parameters), t.client)
+		if err != nil {
+			return nil, err
+		}
+		m.Parameters = params.(map[string]interface{})
+	case *Begin:
+		if err := t.checkExtra(m.Extra); err != nil {
+			return nil, err
+		}
+	case *Pull:
+		if !t.backend.AtLeast(4, 0) && m.QID == -1 {
+			// PULL_ALL streams everything, which satisfies any batch size
+			m.N = -1
+		}
+	case *Discard:
+		if !t.backend.AtLeast(4, 0) && m.QID == -1 {
+			m.N = -1
+		}
+	case *Goodbye:
+		// GOODBYE has no reply
+		return []TypedMessage{m}, nil
+	}
+	t.expect(1)
+	return []TypedMessage{typed}, nil
+}
+
+// translateHello splits or holds back authentication, which moved from
+// HELLO to LOGON in Bolt 5.1
+func (t *Translator) translateHello(hello *Hello) ([]TypedMessage, error) {
+	if patches, _ := hello.Extra["patch_bolt"].([]interface{}); slices.Contains(patches, interface{}("utc")) {
+		t.wantUTC = t.client == (Version{Major: 4, Minor: 4})
+	}
+	// The translator handles date time layouts itself
+	hello.Extra = maps.Clone(hello.Extra)
+	delete(hello.Extra, "patch_bolt")
+
+	switch {
+	case !t.client.AtLeast(5, 1) && t.backend.AtLeast(5, 1):
+		logon := &Logon{Auth: hello.Auth}
+		hello.Auth = nil
+		t.replies = append(t.replies, &reply{summaries: 2, hello: true})
+		return []TypedMessage{hello, logon}, nil
+	case t.client.AtLeast(5, 1) && !t.backend.AtLeast(5, 1):
+		t.hello = hello
+		t.replies = append(t.replies, &reply{synthetic: EarlyHelloSuccess(t.backend), hello: true})
+		return nil, nil
+	}
+	t.replies = append(t.replies, &reply{summaries: 1, hello: true})
+	return []TypedMessage{hello}, nil
+}
+
+// earlyHellos numbers the HELLO replies made by EarlyHelloSuccess
+var earlyHellos atomic.Uint64
+
+// EarlyHelloSuccess answers a Bolt 5.1+ HELLO that must be answered before
+// the backend has: the client waits for the reply to send LOGON, and the
+// backend cannot be logged in, or for a proxy even chosen, until then. The
+// server agent names the proxy and the Bolt version v rather than a Neo4j
+// release, and every reply has its own connection id. The backend's own
+// reply to the login answers LOGON.
+func EarlyHelloSuccess(v Version) *Success {
+	return &Success{Metadata: map[string]interface{}{
+		"server":        "neo4j-proxy (Bolt " + v.String() + ")",
+		"connection_id": fmt.Sprintf("bolt-proxy-%d", earlyHellos.Add(1)),
+	}}
+}
+
+// checkExtra rejects transaction options the backend does not understand
+func (t *Translator) checkExtra(extra TxExtra) error {
+	if extra.Database() != "" && !t.backend.AtLeast(4, 0) {
+		return errors.New("database selection needs Bolt 4.0")
+	}
+	if extra.ImpersonatedUser() != "" && !t.backend.AtLeast(4, 4) {
+		return errors.New("impersonation needs Bolt 4.4")
+	}
+	return nil
+}
+
+// expect queues a reply answered by n backend summaries
+func (t *Translator) expect(n int) {
+	t.replies = append(t.replies, &reply{summaries: n})
+}
+
+// answer queues a reply the translator makes itself
+func (t *Translator) answer(m TypedMessage) {
+	t.replies = append(t.replies, &reply{synthetic: m})
+}
+
+// Response translates a backend response into the messages to send to the
+// client, followed by any queued replies that became due
+func (t *Translator) Response(msg *Message) ([]*Message, error) {
+	typed, err := ParseMessage(msg, t.backend)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []TypedMessage
+	switch m := typed.(type) {
+	case *Record:
+		values, err := DecodeValue(m.Values, t.backend)
+		if err != nil {
+			return nil, err
+		}
+		m.Values = values.([]interface{})
+		out = append(out, m)
+	case *Success, *Failure, *Ignored:
+		if t.skip > 0 {
+			t.skip--
+			return nil, nil
+		}
+		if len(t.replies) == 0 || t.replies[0].summaries == 0 {
+			return nil, fmt.Errorf("unexpected response 0x%02X from backend", msg.Signature)
+		}
+		head := t.replies[0]
+		head.merged = append(head.merged, typed)
+		_, success := typed.(*Success)
+		if len(head.merged) == head.summaries || !success {
+			// A request that failed in part has failed, so the client hears
+			// of it at once rather than after the backend's remaining
+			// summaries, which may never come
+			t.replies = t.replies[1:]
+			t.skip = head.summaries - len(head.merged)
+			out = append(out, t.reply(head, mergeSummaries(head.merged)))
+		}
+	default:
+		return nil, fmt.Errorf("unexpected message 0x%02X from backend", msg.Signature)
+	}
+
+	msgs, err := t.encode(out)
+	if err != nil {
+		return nil, err
+	}
+	return append(msgs, t.Flush()...), nil
+}
+
+// Flush returns the replies the translator makes itself that are next in
+// line for the client
+func (t *Translator) Flush() []*Message {
+	var out []TypedMessage
+	for len(t.replies) > 0 && t.replies[0].summaries == 0 {
+		head := t.replies[0]
+		t.replies = t.replies[1:]
+		out = append(out, t.reply(head, head.synthetic))
+	}
+	// Synthetic replies only hold metadata the client version can express
+	msgs, _ := t.encode(out)
+	return msgs
+}
+
+// reply finishes the client's view of a reply, acknowledging the "utc"
+// patch on a successful HELLO
+func (t *Translator) reply(r *reply, m TypedMessage) TypedMessage {
+	success, ok := m.(*Success)
+	if !ok || !r.hello {
+		return m
+	}
+	metadata := maps.Clone(nonNilMap(success.Metadata))
+	delete(metadata, "patch_bolt")
+	if t.wantUTC {
+		metadata["patch_bolt"] = []interface{}{"utc"}
+		t.clientUTC = true
+	}
+	return &Success{Metadata: metadata}
+}
+
+func (t *Translator) encode(typed []TypedMessage) ([]*Message, error) {
+	msgs := make([]*Message, 0, len(typed))
+	for _, m := range typed {
+		encoded, err := m.Encode(t.client)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, encoded)
+	}
+	return msgs, nil
+}
+
+// mergeSummaries combines the summaries of one client request that the
+// backend answered in several parts: the first non-SUCCESS wins, otherwise
+// the metadata is merged
+func mergeSummaries(summaries []TypedMessage) TypedMessage {
+	if len(summaries) == 1 {
+		return summaries[0]
+	}
+	metadata := map[string]interface{}{}
+	for _, s := range summaries {
+		success, ok := s.(*Success)
+		if !ok {
+			return s
+		}
+		maps.Copy(metadata, success.Metadata)
+	}
+	return &Success{Metadata: metadata}
+}
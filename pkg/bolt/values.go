@@ -0,0 +1,50 @@
+package bolt
+
+// DecodeValue converts the graph, temporal and spatial structures inside a
+// decoded PackStream value into their typed Go representations for version
+// v, descending into lists and maps. Structures with unknown tags are left as *Structure.
+func DecodeValue(value interface{}, v Version) (interface{}, error) {
+	switch x := value.(type) {
+	case []interface{}:
+		list := make([]interface{}, len(x))
+		for i, item := range x {
+			decoded, err := DecodeValue(item, v)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = decoded
+		}
+		return list, nil
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(x))
+		for key, item := range x {
+			decoded, err := DecodeValue(item, v)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = decoded
+		}
+		return m, nil
+	case *Structure:
+		return decodeStructure(x, v)
+	}
+	return value, nil
+}
+
+// decodeStructure converts a single structure into its typed value
+func decodeStructure(s *Structure, v Version) (interface{}, error) {
+	switch s.Tag {
+	case TagNode:
+		return decodeNode(s, v)
+	case TagRelationship:
+		return decodeRelationship(s, v)
+	case TagUnboundRelationship:
+		return decodeUnboundRelationship(s, v)
+	case TagPath:
+		return decodePath(s, v)
+	}
+	if value, ok, err := decodeTemporal(s, v); ok {
+		return value, err
+	}
+	return s, nil
+}
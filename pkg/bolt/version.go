@@ -0,0 +1,204 @@
+package bolt
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ErrNoCompatibleVersion is returned when none of the proposed versions are supported
+var ErrNoCompatibleVersion = errors.New("no compatible Bolt version")
+
+// Version is a Bolt protocol version
+type Version struct {
+	Major byte
+	Minor byte
+}
+
+// DefaultSupportedVersions lists the versions the proxy accepts, newest first
+var DefaultSupportedVersions = []Version{
+	{5, 8}, {5, 7}, {5, 6}, {5, 5}, {5, 4}, {5, 3}, {5, 2}, {5, 1}, {5, 0},
+	{4, 4}, {4, 3}, {4, 2}, {4, 1}, {4, 0},
+	{3, 0},
+}
+
+// ParseVersion parses a version written as "major.minor" or "major"
+func ParseVersion(s string) (Version, error) {
+	majorStr, minorStr, hasMinor := strings.Cut(strings.TrimSpace(s), ".")
+	major, err := strconv.ParseUint(majorStr, 10, 8)
+	if err != nil {
+		return Version{}, fmt.Errorf("invalid Bolt version %q", s)
+	}
+	var minor uint64
+	if hasMinor {
+		minor, err = strconv.ParseUint(minorStr, 10, 8)
+		if err != nil {
+			return Version{}, fmt.Errorf("invalid Bolt version %q", s)
+		}
+	}
+	return Version{Major: byte(major), Minor: byte(minor)}, nil
+}
+
+// String returns the version as "major.minor"
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+// IsZero reports whether no version has been negotiated
+func (v Version) IsZero() bool {
+	return v == Version{}
+}
+
+// Compare returns -1, 0 or 1 depending on whether v is older than,
+// equal to or newer than other
+func (v Version) Compare(other Version) int {
+	switch {
+	case v.Major != other.Major:
+		if v.Major < other.Major {
+			return -1
+		}
+		return 1
+	case v.Minor != other.Minor:
+		if v.Minor < other.Minor {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
+
+// AtLeast reports whether v is the given major.minor or newer
+func (v Version) AtLeast(major, minor byte) bool {
+	return v.Compare(Version{Major: major, Minor: minor}) >= 0
+}
+
+// Encode returns the four-byte handshake encoding of the version
+func (v Version) Encode() uint32 {
+	return uint32(v.Minor)<<8 | uint32(v.Major)
+}
+
+// VersionRange is a single handshake proposal covering Max and the Range
+// minor versions below it (Bolt 4.3+ range proposals)
+type VersionRange struct {
+	Max   Version
+	Range byte
+}
+
+// DecodeVersionRange decodes a four-byte handshake proposal
+func DecodeVersionRange(proposal uint32) VersionRange {
+	return VersionRange{
+		Max: Version{
+			Major: byte(proposal),
+			Minor: byte(proposal >> 8),
+		},
+		Range: byte(proposal >> 16),
+	}
+}
+
+// Encode returns the four-byte handshake encoding of the range
+func (r VersionRange) Encode() uint32 {
+	return uint32(r.Range)<<16 | r.Max.Encode()
+}
+
+// String returns the range as "min-max", or just the version without a range
+func (r VersionRange) String() string {
+	if r.Range == 0 || r.Range > r.Max.Minor {
+		return r.Max.String()
+	}
+	low := Version{Major: r.Max.Major, Minor: r.Max.Minor - r.Range}
+	return low.String() + "-" + r.Max.String()
+}
+
+// Contains reports whether v falls within the range
+func (r VersionRange) Contains(v Version) bool {
+	if v.Major != r.Max.Major || v.Minor > r.Max.Minor {
+		return false
+	}
+	return int(v.Minor) >= int(r.Max.Minor)-int(r.Range)
+}
+
+// SelectVersion picks the version to use for a set of client proposals.
+// Proposals are considered in the client's order of preference and the
+// newest supported version inside the first matching proposal wins.
+func SelectVersion(proposals []uint32, supported []Version) (Version, error) {
+	for _, proposal := range proposals {
+		if proposal == 0 {
+			continue
+		}
+		r := DecodeVersionRange(proposal)
+		var best Version
+		for _, v := range supported {
+			if r.Contains(v) && v.Compare(best) > 0 {
+				best = v
+			}
+		}
+		if !best.IsZero() {
+			return best, nil
+		}
+	}
+	return Version{}, ErrNoCompatibleVersion
+}
+
+// AcceptedVersions returns the supported versions covered by any of the
+// proposals. A client proposing the manifest may confirm any of them.
+func AcceptedVersions(proposals []uint32, supported []Version) []Version {
+	if slices.Contains(proposals, ManifestV1) {
+		return slices.Clone(supported)
+	}
+	var accepted []Version
+	for _, v := range supported {
+		for _, proposal := range proposals {
+			if proposal != 0 && DecodeVersionRange(proposal).Contains(v) {
+				accepted = append(accepted, v)
+				break
+			}
+		}
+	}
+	return accepted
+}
+
+// ProposeVersions builds the four handshake proposals a client sends for
+// the supported versions, newest first, folding consecutive minor versions
+// into ranges where the server understands them. Versions that do not fit
+// are dropped from just above the oldest supported one, which stays
+// proposed: servers that only speak the dropped versions also speak it,
+// as every Neo4j 4.x accepts Bolt 3.0.
+func ProposeVersions(supported []Version) []uint32 {
+	return proposeVersions(supported, 4)
+}
+
+// proposeVersions builds slots proposals for the supported versions
+func proposeVersions(supported []Version, slots int) []uint32 {
+	proposals := foldVersions(supported)
+	if len(proposals) > slots {
+		proposals = append(proposals[:slots-1], proposals[len(proposals)-1])
+	}
+	for len(proposals) < slots {
+		proposals = append(proposals, 0)
+	}
+	return proposals
+}
+
+// foldVersions encodes the supported versions newest first, folding
+// consecutive minor versions into ranges
+func foldVersions(supported []Version) []uint32 {
+	sorted := slices.Clone(supported)
+	slices.SortFunc(sorted, func(a, b Version) int { return b.Compare(a) })
+
+	var proposals []uint32
+	for i := 0; i < len(sorted); {
+		r := VersionRange{Max: sorted[i]}
+		i++
+		// Only servers speaking 4.3+ understand ranges, so older versions
+		// are always proposed exactly
+		for i < len(sorted) && sorted[i].AtLeast(4, 3) &&
+			sorted[i].Major == r.Max.Major && int(sorted[i].Minor) == int(r.Max.Minor)-int(r.Range)-1 {
+			r.Range++
+			i++
+		}
+		proposals = append(proposals, r.Encode())
+	}
+	return proposals
+}
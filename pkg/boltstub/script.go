@@ -0,0 +1,246 @@
+// Package boltstub provides a scriptable fake Bolt server for tests. A
+// Script lists the requests a client is expected to send, in order, and
+// the responses to each; a Server plays the script on every connection.
+//
+//	script := boltstub.NewScript().
+//		Expect(bolt.MsgHello).Success(boltstub.Metadata{"server": "Neo4j/5.26.0"}).
+//		Expect(bolt.MsgLogon, boltstub.Principal("alice")).Success(nil).
+//		Expect(bolt.MsgRun, boltstub.Query("RETURN 1 AS n")).Success(boltstub.Fields("n")).
+//		Expect(bolt.MsgPull).Record(int64(1)).Success(nil).
+//		Expect(bolt.MsgGoodbye)
+package boltstub
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+
+	"neo4j-proxy/pkg/bolt"
+)
+
+// Metadata is the metadata of a SUCCESS reply
+type Metadata = map[string]interface{}
+
+// Fields returns the RUN metadata announcing the result columns
+func Fields(names ...string) Metadata {
+	fields := make([]interface{}, len(names))
+	for i, name := range names {
+		fields[i] = name
+	}
+	return Metadata{"fields": fields}
+}
+
+// Matcher checks a request against the script, returning an error that
+// describes the mismatch
+type Matcher func(bolt.TypedMessage) error
+
+// Script is a scripted conversation. Build it with NewScript and Expect;
+// the reply methods add responses to the most recent expectation. A script
+// built out of order is rejected by NewServer.
+type Script struct {
+	steps []*step
+	auto  map[byte]bool
+	err   error // the first mistake made building the script
+}
+
+// errReplyBeforeExpect is recorded for replies added before any Expect
+var errReplyBeforeExpect = errors.New("boltstub: reply added before any Expect")
+
+type step struct {
+	signature byte
+	matchers  []Matcher
+	replies   []bolt.TypedMessage
+	hangUp    bool
+}
+
+// NewScript creates an empty script
+func NewScript() *Script {
+	return &Script{auto: map[byte]bool{}}
+}
+
+// Expect adds a step expecting the request with signature sig, which must
+// satisfy every matcher
+func (s *Script) Expect(sig byte, matchers ...Matcher) *Script {
+	s.steps = append(s.steps, &step{signature: sig, matchers: matchers})
+	return s
+}
+
+// AutoSuccess answers the given requests with an empty SUCCESS wherever
+// they arrive, outside the scripted order, e.g. RESET or TELEMETRY
+func (s *Script) AutoSuccess(sigs ...byte) *Script {
+	for _, sig := range sigs {
+		s.auto[sig] = true
+	}
+	return s
+}
+
+// Success replies with SUCCESS; nil metadata is sent as an empty map
+func (s *Script) Success(metadata Metadata) *Script {
+	if metadata == nil {
+		metadata = Metadata{}
+	}
+	return s.reply(&bolt.Success{Metadata: metadata})
+}
+
+// Record replies with a RECORD of values
+func (s *Script) Record(values ...interface{}) *Script {
+	return s.reply(&bolt.Record{Values: values})
+}
+
+// Failure replies with FAILURE
+func (s *Script) Failure(code, message string) *Script {
+	return s.reply(&bolt.Failure{Code: code, Message: message})
+}
+
+// Ignored replies with IGNORED
+func (s *Script) Ignored() *Script {
+	return s.reply(&bolt.Ignored{})
+}
+
+// HangUp closes the connection after the replies of the current step
+func (s *Script) HangUp() *Script {
+	if last := s.last(); last != nil {
+		last.hangUp = true
+	}
+	return s
+}
+
+func (s *Script) reply(m bolt.TypedMessage) *Script {
+	if last := s.last(); last != nil {
+		last.replies = append(last.replies, m)
+	}
+	return s
+}
+
+// last returns the most recent step, or records the error and returns nil
+// if there is none yet
+func (s *Script) last() *step {
+	if len(s.steps) == 0 {
+		if s.err == nil {
+			s.err = errReplyBeforeExpect
+		}
+		return nil
+	}
+	return s.steps[len(s.steps)-1]
+}
+
+// check matches a request against a step
+func (st *step) check(m bolt.TypedMessage, sig byte, v bolt.Version) error {
+	if sig != st.signature {
+		return fmt.Errorf("expected %s, got %s", bolt.MessageName(st.signature, v), bolt.MessageName(sig, v))
+	}
+	for _, match := range st.matchers {
+		if err := match(m); err != nil {
+			return fmt.Errorf("%s: %w", bolt.MessageName(sig, v), err)
+		}
+	}
+	return nil
+}
+
+// Query matches RUN requests with exactly the query q
+func Query(q string) Matcher {
+	return func(m bolt.TypedMessage) error {
+		run, ok := m.(*bolt.Run)
+		if !ok || run.Query != q {
+			return fmt.Errorf("expected query %q, got %q", q, queryOf(m))
+		}
+		return nil
+	}
+}
+
+// QueryMatching matches RUN requests whose query matches the regular
+// expression pattern
+func QueryMatching(pattern string) Matcher {
+	re := regexp.MustCompile(pattern)
+	return func(m bolt.TypedMessage) error {
+		if !re.MatchString(queryOf(m)) {
+			return fmt.Errorf("expected query matching %q, got %q", pattern, queryOf(m))
+		}
+		return nil
+	}
+}
+
+// Param matches RUN requests whose parameter key equals value
+func Param(key string, value interface{}) Matcher {
+	return func(m bolt.TypedMessage) error {
+		run, ok := m.(*bolt.Run)
+		if !ok {
+			return fmt.Errorf("expected parameter %s on a RUN", key)
+		}
+		if got, ok := run.Parameters[key]; !ok || !reflect.DeepEqual(got, value) {
+			return fmt.Errorf("expected parameter %s = %v, got %v", key, value, got)
+		}
+		return nil
+	}
+}
+
+// Database matches RUN, BEGIN and ROUTE requests for database db
+func Database(db string) Matcher {
+	return func(m bolt.TypedMessage) error {
+		var got string
+		switch r := m.(type) {
+		case *bolt.Run:
+			got = r.Extra.Database()
+		case *bolt.Begin:
+			got = r.Extra.Database()
+		case *bolt.Route:
+			got = r.Database
+		}
+		if got != db {
+			return fmt.Errorf("expected database %q, got %q", db, got)
+		}
+		return nil
+	}
+}
+
+// Principal matches INIT, HELLO and LOGON requests authenticating as user
+func Principal(user string) Matcher {
+	return authMatcher("principal", user, bolt.AuthToken.Principal)
+}
+
+// Credentials matches INIT, HELLO and LOGON requests carrying credentials
+func Credentials(credentials string) Matcher {
+	return authMatcher("credentials", credentials, bolt.AuthToken.Credentials)
+}
+
+func authMatcher(name, want string, get func(bolt.AuthToken) string) Matcher {
+	return func(m bolt.TypedMessage) error {
+		var auth bolt.AuthToken
+		switch r := m.(type) {
+		case *bolt.Init:
+			auth = r.Auth
+		case *bolt.Hello:
+			auth = r.Auth
+		case *bolt.Logon:
+			auth = r.Auth
+		}
+		if got := get(auth); got != want {
+			return fmt.Errorf("expected %s %q, got %q", name, want, got)
+		}
+		return nil
+	}
+}
+
+// Has matches requests for which check returns true, for assertions the
+// other matchers do not cover; description names the expectation
+func Has(check func(bolt.TypedMessage) bool, description string) Matcher {
+	return func(m bolt.TypedMessage) error {
+		if !check(m) {
+			return fmt.Errorf("expected %s", description)
+		}
+		return nil
+	}
+}
+
+func queryOf(m bolt.TypedMessage) string {
+	if run, ok := m.(*bolt.Run); ok {
+		return run.Query
+	}
+	return ""
+}
+
+// isAuto reports whether sig is answered outside the scripted order
+func (s *Script) isAuto(sig byte) bool {
+	return s.auto[sig]
+}
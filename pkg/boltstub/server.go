@@ -0,0 +1,212 @@
+package boltstub
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"neo4j-proxy/pkg/bolt"
+)
+
+// unexpectedCode is the FAILURE code sent for requests that break the script
+const unexpectedCode = "Neo.ClientError.Request.Invalid"
+
+// Server is a fake Bolt server that plays a script on every connection it
+// accepts. Requests that break the script are answered with FAILURE, the
+// connection is closed and the mismatch is reported by Err.
+type Server struct {
+	listener net.Listener
+	script   *Script
+	versions []bolt.Version
+
+	mu        sync.Mutex
+	errs      []error
+	accepted  int
+	completed int
+	conns     map[net.Conn]bool
+	wg        sync.WaitGroup
+}
+
+// NewServer starts a server on a free local port that plays script,
+// negotiating any of versions or every supported version when none are
+// given. A script built out of order is returned as an error.
+func NewServer(script *Script, versions ...bolt.Version) (*Server, error) {
+	if script.err != nil {
+		return nil, script.err
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		versions = bolt.DefaultSupportedVersions
+	}
+	s := &Server{
+		listener: listener,
+		script:   script,
+		versions: versions,
+		conns:    map[net.Conn]bool{},
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr returns the address the server listens on, as host:port
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Port returns the port the server listens on
+func (s *Server) Port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+// Accepted returns the number of connections accepted so far
+func (s *Server) Accepted() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.accepted
+}
+
+// Completed returns the number of connections that played the whole script
+func (s *Server) Completed() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.completed
+}
+
+// Err returns every departure from the script seen so far, or nil
+func (s *Server) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return errors.Join(s.errs...)
+}
+
+// Close stops the server, closes open connections and waits for them
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.accepted++
+		s.conns[conn] = true
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer func() {
+				s.mu.Lock()
+				delete(s.conns, conn)
+				s.mu.Unlock()
+				conn.Close()
+			}()
+			if err := s.play(conn); err != nil {
+				s.fail(fmt.Errorf("connection from %s: %w", conn.RemoteAddr(), err))
+			}
+		}()
+	}
+}
+
+func (s *Server) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errs = append(s.errs, err)
+}
+
+// play runs the script on one connection
+func (s *Server) play(conn net.Conn) error {
+	server := bolt.NewConnection(conn)
+	server.SetSupportedVersions(s.versions)
+	if err := server.Handshake(); err != nil {
+		return fmt.Errorf("handshake: %w", err)
+	}
+	v := server.GetVersion()
+
+	next := 0
+	for {
+		msg, err := server.ReadMessage()
+		if err != nil {
+			if err != io.EOF {
+				return err
+			}
+			if next < len(s.script.steps) {
+				expected := bolt.MessageName(s.script.steps[next].signature, v)
+				return fmt.Errorf("connection closed at step %d, expected %s", next+1, expected)
+			}
+			return nil
+		}
+
+		if s.script.isAuto(msg.Signature) {
+			if err := write(server, v, &bolt.Success{Metadata: Metadata{}}); err != nil {
+				return err
+			}
+			continue
+		}
+		if next == len(s.script.steps) {
+			if msg.Signature == bolt.MsgGoodbye {
+				continue
+			}
+			err := fmt.Errorf("unexpected %s after the end of the script", bolt.MessageName(msg.Signature, v))
+			return s.reject(server, v, err)
+		}
+
+		st := s.script.steps[next]
+		typed, err := bolt.ParseMessage(msg, v)
+		if err == nil {
+			err = st.check(typed, msg.Signature, v)
+		}
+		if err != nil {
+			return s.reject(server, v, fmt.Errorf("step %d: %w", next+1, err))
+		}
+		next++
+		if next == len(s.script.steps) {
+			s.mu.Lock()
+			s.completed++
+			s.mu.Unlock()
+		}
+
+		if err := write(server, v, st.replies...); err != nil {
+			return err
+		}
+		if st.hangUp || msg.Signature == bolt.MsgGoodbye {
+			return nil
+		}
+	}
+}
+
+// reject answers a request that breaks the script and returns the mismatch
+func (s *Server) reject(server *bolt.Connection, v bolt.Version, err error) error {
+	write(server, v, &bolt.Failure{Code: unexpectedCode, Message: "boltstub: " + err.Error()})
+	return err
+}
+
+func write(server *bolt.Connection, v bolt.Version, replies ...bolt.TypedMessage) error {
+	for _, reply := range replies {
+		msg, err := reply.Encode(v)
+		if err != nil {
+			return err
+		}
+		if err := server.WriteMessage(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
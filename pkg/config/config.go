@@ -4,22 +4,256 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"time"
 )
 
 // Config represents the proxy configuration
 type Config struct {
 	ProxyPort int                      `json:"proxy_port"`
 	Tenants   map[string]TenantConfig  `json:"tenants"`
+
+	// WebSocketPort enables a Bolt over WebSocket listener for Neo4j Browser
+	// and browser drivers; disabled when zero
+	WebSocketPort int `json:"websocket_port,omitempty"`
+
+	// WebSocketOrigins lists the origins, e.g. "https://browser.example.com",
+	// of pages allowed to open WebSocket connections; "*" allows any. Only
+	// pages served from the proxy's own host are allowed when empty.
+	WebSocketOrigins []string `json:"websocket_origins,omitempty"`
+
+	// TLS terminates TLS (bolt+s) for Bolt clients when a certificate is set
+	TLS TLSConfig `json:"tls,omitzero"`
+
+	// BoltVersions restricts the Bolt versions offered to clients, e.g. ["5.4", "4.4"].
+	// All versions known to the proxy are accepted when empty.
+	BoltVersions []string `json:"bolt_versions,omitempty"`
+
+	// VersionNegotiation selects how the client's Bolt version is chosen,
+	// see NegotiateIndependent and NegotiateBackendFirst
+	VersionNegotiation string `json:"version_negotiation,omitempty"`
+
+	// VersionTranslation lets clients and backends speak different Bolt
+	// versions, with the proxy translating messages between them
+	VersionTranslation bool `json:"version_translation,omitempty"`
+
+	// DefaultTenant is the tenant whose backend is consulted when the version
+	// must be negotiated before the client has identified itself
+	DefaultTenant string `json:"default_tenant,omitempty"`
+
+	// MessageLimits bounds the messages clients may send
+	MessageLimits MessageLimits `json:"message_limits,omitzero"`
+
+	// FailureCodes overrides the Neo4j status code of the FAILURE sent to
+	// clients the proxy turns away, by reason (see the Failure constants)
+	FailureCodes map[string]string `json:"failure_codes,omitempty"`
+}
+
+// Reasons the proxy answers a client with FAILURE
+const (
+	// FailureUnauthorized is a login the proxy or its authenticator rejected
+	FailureUnauthorized = "unauthorized"
+	// FailureUnknownTenant is a login naming a tenant that is not configured
+	FailureUnknownTenant = "unknown_tenant"
+	// FailureBackendUnavailable is a backend that could not be reached
+	FailureBackendUnavailable = "backend_unavailable"
+	// FailureUnsupportedVersion is a backend that does not speak the
+	// client's Bolt version
+	FailureUnsupportedVersion = "unsupported_version"
+	// FailureInvalidRequest is a request the client may not send, or one
+	// over the message limits
+	FailureInvalidRequest = "invalid_request"
+	// FailureProxyError is a proxy misconfiguration
+	FailureProxyError = "proxy_error"
+)
+
+// MessageLimits bounds what a single client message may contain. Zero
+// fields keep the proxy's defaults and negative fields disable the limit.
+type MessageLimits struct {
+	// MaxMessageSize is the largest message in bytes, across all chunks
+	MaxMessageSize int `json:"max_message_size,omitempty"`
+	// MaxDepth is the deepest nesting of lists, maps and structures
+	MaxDepth int `json:"max_depth,omitempty"`
+	// MaxCollectionLength is the most entries in a list or map
+	MaxCollectionLength int `json:"max_collection_length,omitempty"`
+	// MaxStringLength is the longest string or byte array in bytes
+	MaxStringLength int `json:"max_string_length,omitempty"`
+}
+
+// TLSConfig configures TLS termination on the client listener
+type TLSConfig struct {
+	// CertFile and KeyFile hold the PEM certificate chain and private key;
+	// TLS is disabled when CertFile is empty. Both are reloaded when they
+	// change on disk.
+	CertFile string `json:"cert_file,omitempty"`
+	KeyFile  string `json:"key_file,omitempty"`
+	// MinVersion is the oldest TLS version accepted, "1.2" or "1.3";
+	// "1.2" when empty
+	MinVersion string `json:"min_version,omitempty"`
+	// CipherSuites restricts the TLS 1.2 and older cipher suites by their
+	// Go names, e.g. "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"
+	CipherSuites []string `json:"cipher_suites,omitempty"`
+	// Port serves TLS on a port of its own, leaving ProxyPort in plaintext.
+	// ProxyPort serves TLS only when zero.
+	Port int `json:"port,omitempty"`
 }
 
+// Version negotiation modes
+const (
+	// NegotiateIndependent answers the client's handshake from the proxy's own
+	// supported versions (restricted to pinned tenant versions, if any) and
+	// requires the backend to accept the same version once the tenant is known
+	NegotiateIndependent = "independent"
+
+	// NegotiateBackendFirst connects to the default tenant's backend before
+	// answering the client and passes on the version the backend picked
+	NegotiateBackendFirst = "backend_first"
+)
+
 // TenantConfig represents configuration for a single tenant
 type TenantConfig struct {
 	Host     string `json:"host"`
 	Port     int    `json:"port"`
+
+	// Username and Password are service credentials the proxy logs in to
+	// the backend with in place of the client's own. Clients then log in to
+	// the proxy as one of Users instead of to the backend.
 	Username string `json:"username,omitempty"`
 	Password string `json:"password,omitempty"`
+
+	// Users holds the password of each principal allowed to log in when
+	// service credentials are set: a salted "pbkdf2-sha256:" hash from
+	// "neo4j-proxy hash-password", or for compatibility "sha256:" followed
+	// by the hex SHA-256 digest. Clear text passwords are meant for tests.
+	Users map[string]string `json:"users,omitempty"`
+
+	// Principal rewrites the principal forwarded to the backend, which
+	// otherwise receives it as the client sent it
+	Principal PrincipalRewrite `json:"principal,omitzero"`
+
+	// BoltVersion pins the Bolt version spoken with this tenant's backend, e.g. "5.4"
+	BoltVersion string `json:"bolt_version,omitempty"`
+
+	// Transport is how the backend is reached, TransportTCP (the default) or
+	// TransportWebSocket
+	Transport string `json:"transport,omitempty"`
+
+	// TLS encrypts the connection to the backend
+	TLS BackendTLS `json:"tls,omitzero"`
+
+	// Pool keeps backend connections after their clients leave, for reuse
+	// by later clients logging in as the same backend user
+	Pool PoolConfig `json:"pool,omitzero"`
+
+	// PoolMode is PoolModeSession (the default) or PoolModeTransaction; it
+	// applies when Pool is enabled
+	PoolMode string `json:"pool_mode,omitempty"`
+}
+
+// BackendTLS configures TLS to a tenant's backend
+type BackendTLS struct {
+	// Enabled connects with TLS (bolt+s, or wss for TransportWebSocket)
+	Enabled bool `json:"enabled,omitempty"`
+	// CAFile is a PEM bundle of the CAs trusted to sign the backend's
+	// certificate; the system roots are trusted when empty
+	CAFile string `json:"ca_file,omitempty"`
+	// ServerName is the name the backend's certificate is verified against
+	// and sent in SNI; Host when empty
+	ServerName string `json:"server_name,omitempty"`
+	// SkipVerify accepts any certificate, e.g. a self-signed one (bolt+ssc).
+	// PinnedSPKI is still checked.
+	SkipVerify bool `json:"skip_verify,omitempty"`
+	// CertFile and KeyFile hold a PEM client certificate and key presented
+	// to backends that require one
+	CertFile string `json:"cert_file,omitempty"`
+	KeyFile  string `json:"key_file,omitempty"`
+	// PinnedSPKI holds base64 SHA-256 digests of subject public key infos;
+	// when set, a certificate in the backend's chain must match one of them
+	PinnedSPKI []string `json:"pinned_spki,omitempty"`
+}
+
+// Pool modes
+const (
+	// PoolModeSession binds a backend connection to a client for as long as
+	// the client stays connected
+	PoolModeSession = "session"
+
+	// PoolModeTransaction binds a backend connection to a client only for
+	// the duration of a transaction or auto-commit query, so many clients
+	// share few backend connections
+	PoolModeTransaction = "transaction"
+)
+
+// PoolConfig sizes a tenant's pool of idle backend connections. Pooling is
+// disabled when MaxIdle is zero.
+type PoolConfig struct {
+	// MaxIdle is the most idle connections kept
+	MaxIdle int `json:"max_idle,omitempty"`
+	// MaxOpen is the most connections open at once in PoolModeTransaction,
+	// beyond which clients wait for one to be released; unlimited when zero
+	MaxOpen int `json:"max_open,omitempty"`
+	// RetainIdle is how many of the most recently released idle connections
+	// IdleTimeout spares. It is a floor for closing connections, not a size
+	// the pool grows to: connections are only opened for clients.
+	RetainIdle int `json:"retain_idle,omitempty"`
+	// IdleTimeout closes connections idle for longer, down to RetainIdle;
+	// no timeout when zero
+	IdleTimeout Duration `json:"idle_timeout,omitempty"`
+	// MaxLifetime closes connections opened longer ago; no limit when zero
+	MaxLifetime Duration `json:"max_lifetime,omitempty"`
+	// LivenessCheck is how long a connection may be idle before it is
+	// checked with RESET on reuse; every reuse is checked when zero
+	LivenessCheck Duration `json:"liveness_check,omitempty"`
+}
+
+// Duration is a time.Duration written as a string such as "30s" or "5m"
+type Duration time.Duration
+
+// MarshalJSON writes the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
 }
 
+// UnmarshalJSON reads a duration string
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30s\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// PrincipalRewrite describes how a client's principal is turned into the
+// backend's user. It does not apply to tenants with service credentials.
+type PrincipalRewrite struct {
+	// Mode is PrincipalStripTenant, PrincipalTemplate or PrincipalMap
+	Mode string `json:"mode,omitempty"`
+	// Template is the backend principal for PrincipalTemplate, in which
+	// {tenant}, {user} and {principal} are replaced by the tenant, the user
+	// without the tenant prefix and the principal the client sent
+	Template string `json:"template,omitempty"`
+	// Map gives the backend principal of each user for PrincipalMap; users
+	// without an entry are rejected
+	Map map[string]string `json:"map,omitempty"`
+}
+
+// Principal rewrite modes
+const (
+	PrincipalStripTenant = "strip_tenant"
+	PrincipalTemplate    = "template"
+	PrincipalMap         = "map"
+)
+
+// Backend transports
+const (
+	TransportTCP       = "tcp"
+	TransportWebSocket = "websocket"
+)
+
 // Load loads configuration from environment variables and config file
 func Load() (*Config, error) {
 	cfg := &Config{
@@ -0,0 +1,460 @@
+// Package dump decodes captured Bolt traffic for debugging: the handshake,
+// the chunk boundaries of every message and the messages themselves.
+package dump
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"neo4j-proxy/pkg/bolt"
+)
+
+// Event kinds
+const (
+	KindHandshake = "handshake"
+	KindMessage   = "message"
+	KindNoop      = "noop"
+	KindError     = "error"
+)
+
+// Directions of an event
+const (
+	FromClient = "client"
+	FromServer = "server"
+)
+
+// redacted replaces credentials unless Options.ShowCredentials is set
+const redacted = "******"
+
+// Segment is a piece of one direction of a connection as it was captured
+type Segment struct {
+	Time time.Time
+	Data []byte
+}
+
+// Conn holds both directions of a captured Bolt connection. Either
+// direction may be empty, e.g. for a raw capture of a single direction.
+type Conn struct {
+	// Client and Server are the endpoint addresses, empty for raw captures
+	Client string
+	Server string
+
+	ClientData []Segment
+	ServerData []Segment
+}
+
+// Name identifies the connection in the output
+func (c *Conn) Name() string {
+	if c.Client == "" && c.Server == "" {
+		return ""
+	}
+	return c.Client + " > " + c.Server
+}
+
+// HasHandshake reports whether the client data starts with the Bolt magic
+// preamble, i.e. the capture covers the start of a Bolt connection
+func (c *Conn) HasHandshake() bool {
+	return newStream(c.ClientData).hasMagic()
+}
+
+// Options control how a capture is decoded
+type Options struct {
+	// Version is the Bolt version of captures that start after the
+	// handshake; the newest supported version is assumed when zero
+	Version bolt.Version
+	// ShowCredentials leaves the credentials of INIT, HELLO and LOGON in
+	// the output instead of redacting them
+	ShowCredentials bool
+}
+
+// Handshake describes one step of the version negotiation
+type Handshake struct {
+	// Proposals are the versions the client proposed
+	Proposals []string `json:"proposals,omitempty"`
+	// Offers are the versions listed in the server's manifest
+	Offers []string `json:"offers,omitempty"`
+	// Version is the version the server chose or the client confirmed
+	Version string `json:"version,omitempty"`
+	// Capabilities is the capability mask of a manifest or confirmation
+	Capabilities uint64 `json:"capabilities,omitempty"`
+}
+
+// Event is one decoded item of a Bolt conversation
+type Event struct {
+	Time      time.Time `json:"time,omitzero"`
+	Conn      string    `json:"conn,omitempty"`
+	Direction string    `json:"direction"`
+	// Offset is the position of the event in its direction's byte stream
+	Offset int    `json:"offset"`
+	Kind   string `json:"kind"`
+	// Type is the message name, e.g. "RUN", or "HANDSHAKE" and "NOOP"
+	Type      string     `json:"type,omitempty"`
+	Handshake *Handshake `json:"handshake,omitempty"`
+	// Chunks are the sizes of the chunks that carried the message
+	Chunks    []int             `json:"chunks,omitempty"`
+	Signature byte              `json:"signature,omitempty"`
+	Message   bolt.TypedMessage `json:"message,omitempty"`
+	// Fields hold the raw fields of messages that could not be parsed
+	Fields []interface{} `json:"fields,omitempty"`
+	Error  string        `json:"error,omitempty"`
+}
+
+// Decode decodes both directions of a connection into events, ordered by
+// capture time. Without timestamps the client's events come first.
+func Decode(c *Conn, opts Options) []Event {
+	d := &decoder{
+		conn:   c.Name(),
+		client: newStream(c.ClientData),
+		server: newStream(c.ServerData),
+		opts:   opts,
+	}
+
+	var events []Event
+	version, ok := d.handshake(&events)
+	if ok {
+		events = append(events, d.messages(d.client, FromClient, version)...)
+		events = append(events, d.messages(d.server, FromServer, version)...)
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Time.Before(events[j].Time)
+	})
+	return events
+}
+
+// Filter keeps the events whose type is one of types, compared without
+// regard to case, and all errors. It returns events unchanged when types
+// is empty.
+func Filter(events []Event, types []string) []Event {
+	if len(types) == 0 {
+		return events
+	}
+	var kept []Event
+	for _, e := range events {
+		for _, t := range types {
+			if e.Kind == KindError || strings.EqualFold(e.Type, strings.TrimSpace(t)) {
+				kept = append(kept, e)
+				break
+			}
+		}
+	}
+	return kept
+}
+
+type decoder struct {
+	conn   string
+	client *stream
+	server *stream
+	opts   Options
+}
+
+// handshake decodes the version negotiation and returns the version the
+// messages are decoded with. It reports false if no version was agreed.
+func (d *decoder) handshake(events *[]Event) (bolt.Version, bool) {
+	if !d.client.hasMagic() {
+		// A capture that starts after the handshake
+		v := d.opts.Version
+		if v.IsZero() {
+			v = bolt.DefaultSupportedVersions[0]
+		}
+		return v, true
+	}
+
+	var proposals [5]uint32 // magic preamble and four proposals
+	start := d.client.offset()
+	if err := binary.Read(d.client, binary.BigEndian, &proposals); err != nil {
+		*events = append(*events, d.fail(d.client, FromClient, start, fmt.Errorf("truncated handshake: %w", err)))
+		return bolt.Version{}, false
+	}
+	hs := &Handshake{}
+	for _, p := range proposals[1:] {
+		if p != 0 {
+			hs.Proposals = append(hs.Proposals, proposalString(p))
+		}
+	}
+	*events = append(*events, d.event(d.client, FromClient, start, hs))
+
+	if d.server.Len() == 0 {
+		// Only the client side was captured
+		if slices.Contains(proposals[1:], bolt.ManifestV1) && d.client.hasConfirmation() {
+			return d.confirmation(events)
+		}
+		if !d.opts.Version.IsZero() {
+			return d.opts.Version, true
+		}
+		// Assume the client's favourite version
+		for _, p := range proposals[1:] {
+			if p != 0 && p != bolt.ManifestV1 {
+				return bolt.DecodeVersionRange(p).Max, true
+			}
+		}
+		return bolt.Version{}, false
+	}
+
+	start = d.server.offset()
+	var answer uint32
+	if err := binary.Read(d.server, binary.BigEndian, &answer); err != nil {
+		*events = append(*events, d.fail(d.server, FromServer, start, fmt.Errorf("truncated handshake: %w", err)))
+		return bolt.Version{}, false
+	}
+	if answer != bolt.ManifestV1 {
+		if answer == 0 {
+			*events = append(*events, d.fail(d.server, FromServer, start, bolt.ErrNoCompatibleVersion))
+			return bolt.Version{}, false
+		}
+		v := bolt.DecodeVersionRange(answer).Max
+		*events = append(*events, d.event(d.server, FromServer, start, &Handshake{Version: v.String()}))
+		return v, true
+	}
+
+	manifest, err := d.readManifest()
+	if err != nil {
+		*events = append(*events, d.fail(d.server, FromServer, start, err))
+		return bolt.Version{}, false
+	}
+	*events = append(*events, d.event(d.server, FromServer, start, manifest))
+	return d.confirmation(events)
+}
+
+// confirmation decodes the version the client confirmed from the manifest
+func (d *decoder) confirmation(events *[]Event) (bolt.Version, bool) {
+	start := d.client.offset()
+	chosen, capabilities, err := bolt.ReadManifestConfirmation(d.client)
+	if err != nil {
+		*events = append(*events, d.fail(d.client, FromClient, start, fmt.Errorf("truncated manifest confirmation: %w", err)))
+		return bolt.Version{}, false
+	}
+	if chosen == 0 {
+		*events = append(*events, d.fail(d.client, FromClient, start, bolt.ErrNoCompatibleVersion))
+		return bolt.Version{}, false
+	}
+	v := bolt.DecodeVersionRange(chosen).Max
+	*events = append(*events, d.event(d.client, FromClient, start, &Handshake{Version: v.String(), Capabilities: capabilities}))
+	return v, true
+}
+
+// readManifest reads the server's manifest following the ManifestV1 answer
+func (d *decoder) readManifest() (*Handshake, error) {
+	manifest, err := bolt.ReadManifest(d.server)
+	if err != nil {
+		return nil, fmt.Errorf("truncated or invalid manifest: %w", err)
+	}
+
+	hs := &Handshake{Capabilities: manifest.Capabilities}
+	for _, offer := range manifest.Offers {
+		hs.Offers = append(hs.Offers, proposalString(offer))
+	}
+	return hs, nil
+}
+
+// messages decodes the chunked messages of one direction
+func (d *decoder) messages(s *stream, direction string, v bolt.Version) []Event {
+	var events []Event
+	reader := bolt.NewFrameReader(s)
+	offset := s.offset()
+	for {
+		frame, err := reader.ReadFrame()
+		if err != nil {
+			if err != io.EOF {
+				events = append(events, d.fail(s, direction, offset, err))
+			}
+			return events
+		}
+
+		e := Event{
+			Time:      s.timeAt(offset),
+			Conn:      d.conn,
+			Direction: direction,
+			Offset:    offset,
+			Kind:      KindNoop,
+			Type:      "NOOP",
+		}
+		offset += len(frame.Raw)
+		if frame.IsNoop() {
+			events = append(events, e)
+			continue
+		}
+
+		e.Kind = KindMessage
+		e.Signature = frame.Signature
+		e.Type = bolt.MessageName(frame.Signature, v)
+		e.Chunks = chunkSizes(frame.Raw)
+		msg, err := frame.Message()
+		if err != nil {
+			e.Error = err.Error()
+			events = append(events, e)
+			continue
+		}
+		e.Message, err = d.parse(msg, v)
+		if err != nil {
+			e.Fields = d.redactFields(msg)
+			e.Error = err.Error()
+		}
+		events = append(events, e)
+	}
+}
+
+// parse converts a message to its typed form with graph and temporal
+// values decoded and credentials redacted
+func (d *decoder) parse(msg *bolt.Message, v bolt.Version) (bolt.TypedMessage, error) {
+	typed, err := bolt.ParseMessage(msg, v)
+	if err != nil {
+		return nil, err
+	}
+	switch m := typed.(type) {
+	case *bolt.Init:
+		m.Auth = d.redact(m.Auth)
+	case *bolt.Hello:
+		m.Auth = d.redact(m.Auth)
+	case *bolt.Logon:
+		m.Auth = d.redact(m.Auth)
+	case *bolt.Run:
+		params, err := bolt.DecodeValue(m.Parameters, v)
+		if err != nil {
+			return nil, err
+		}
+		m.Parameters, _ = params.(map[string]interface{})
+	case *bolt.Record:
+		values, err := bolt.DecodeValue(m.Values, v)
+		if err != nil {
+			return nil, err
+		}
+		m.Values, _ = values.([]interface{})
+	}
+	return typed, nil
+}
+
+func (d *decoder) redact(auth bolt.AuthToken) bolt.AuthToken {
+	if d.opts.ShowCredentials || auth == nil {
+		return auth
+	}
+	if _, ok := auth["credentials"]; ok {
+		auth["credentials"] = redacted
+	}
+	return auth
+}
+
+// redactFields returns the raw fields of a message that could not be
+// parsed, with the credentials of INIT, HELLO and LOGON auth maps redacted
+func (d *decoder) redactFields(msg *bolt.Message) []interface{} {
+	if d.opts.ShowCredentials || (msg.Signature != bolt.MsgHello && msg.Signature != bolt.MsgLogon) {
+		return msg.Fields
+	}
+	fields := slices.Clone(msg.Fields)
+	for i, field := range fields {
+		if m, ok := field.(map[string]interface{}); ok {
+			fields[i] = map[string]interface{}(d.redact(maps.Clone(m)))
+		}
+	}
+	return fields
+}
+
+func (d *decoder) event(s *stream, direction string, offset int, hs *Handshake) Event {
+	return Event{
+		Time:      s.timeAt(offset),
+		Conn:      d.conn,
+		Direction: direction,
+		Offset:    offset,
+		Kind:      KindHandshake,
+		Type:      "HANDSHAKE",
+		Handshake: hs,
+	}
+}
+
+func (d *decoder) fail(s *stream, direction string, offset int, err error) Event {
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = fmt.Errorf("capture ends inside a message: %w", err)
+	}
+	return Event{
+		Time:      s.timeAt(offset),
+		Conn:      d.conn,
+		Direction: direction,
+		Offset:    offset,
+		Kind:      KindError,
+		Error:     err.Error(),
+	}
+}
+
+// proposalString describes a handshake proposal or manifest offer
+func proposalString(p uint32) string {
+	if p == bolt.ManifestV1 {
+		return "manifest/v1"
+	}
+	return bolt.DecodeVersionRange(p).String()
+}
+
+// chunkSizes returns the sizes of the data chunks in a raw frame
+func chunkSizes(raw []byte) []int {
+	var sizes []int
+	for len(raw) >= 2 {
+		size := int(binary.BigEndian.Uint16(raw))
+		if size == 0 {
+			break
+		}
+		sizes = append(sizes, size)
+		raw = raw[min(2+size, len(raw)):]
+	}
+	return sizes
+}
+
+// stream reads the concatenated data of a direction's segments while
+// remembering when each byte was captured
+type stream struct {
+	*bytes.Reader
+	starts []int // offset of each segment
+	times  []time.Time
+}
+
+func newStream(segments []Segment) *stream {
+	var (
+		data   []byte
+		starts []int
+		times  []time.Time
+	)
+	for _, seg := range segments {
+		starts = append(starts, len(data))
+		times = append(times, seg.Time)
+		data = append(data, seg.Data...)
+	}
+	return &stream{Reader: bytes.NewReader(data), starts: starts, times: times}
+}
+
+// offset returns the number of bytes read so far
+func (s *stream) offset() int {
+	return int(s.Size()) - s.Len()
+}
+
+// timeAt returns the capture time of the byte at offset
+func (s *stream) timeAt(offset int) time.Time {
+	i := sort.Search(len(s.starts), func(i int) bool { return s.starts[i] > offset })
+	if i == 0 {
+		return time.Time{}
+	}
+	return s.times[i-1]
+}
+
+// hasConfirmation reports whether the unread data starts with what looks
+// like a manifest confirmation of a known version rather than a message
+func (s *stream) hasConfirmation() bool {
+	var chosen [4]byte
+	n, _ := s.ReadAt(chosen[:], int64(s.offset()))
+	if n < 4 || chosen[0] != 0 || chosen[1] != 0 {
+		return false
+	}
+	v := bolt.DecodeVersionRange(binary.BigEndian.Uint32(chosen[:])).Max
+	return slices.Contains(bolt.DefaultSupportedVersions, v)
+}
+
+// hasMagic reports whether the stream starts with the Bolt magic preamble
+func (s *stream) hasMagic() bool {
+	var magic [4]byte
+	n, _ := s.ReadAt(magic[:], 0)
+	return n == 4 && binary.BigEndian.Uint32(magic[:]) == bolt.BoltMagicPreamble
+}
@@ -0,0 +1,93 @@
+package dump
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// WriteText writes events in a human readable form, one line per event
+// under a header for each connection
+func WriteText(w io.Writer, events []Event) error {
+	conn := ""
+	for _, e := range events {
+		if e.Conn != conn {
+			conn = e.Conn
+			if _, err := fmt.Fprintf(w, "== %s\n", conn); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintln(w, textLine(e)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func textLine(e Event) string {
+	var b strings.Builder
+	if !e.Time.IsZero() {
+		b.WriteString(e.Time.Format("15:04:05.000000 "))
+	}
+	arrow := "C>"
+	if e.Direction == FromServer {
+		arrow = "S>"
+	}
+	fmt.Fprintf(&b, "%s @%-6d ", arrow, e.Offset)
+
+	switch e.Kind {
+	case KindError:
+		fmt.Fprintf(&b, "error: %s", e.Error)
+	case KindNoop:
+		b.WriteString("NOOP")
+	case KindHandshake:
+		b.WriteString("HANDSHAKE")
+		hs := e.Handshake
+		if len(hs.Proposals) > 0 {
+			fmt.Fprintf(&b, " proposals=[%s]", strings.Join(hs.Proposals, " "))
+		}
+		if len(hs.Offers) > 0 {
+			fmt.Fprintf(&b, " offers=[%s]", strings.Join(hs.Offers, " "))
+		}
+		if hs.Version != "" {
+			fmt.Fprintf(&b, " version=%s", hs.Version)
+		}
+		if len(hs.Offers) > 0 || hs.Capabilities != 0 {
+			fmt.Fprintf(&b, " capabilities=0x%X", hs.Capabilities)
+		}
+	case KindMessage:
+		fmt.Fprintf(&b, "%s chunks=%v", e.Type, e.Chunks)
+		switch {
+		case e.Message != nil:
+			// The typed message without its pointer, e.g. {Query:RETURN 1 ...}
+			fmt.Fprintf(&b, " %+v", reflect.ValueOf(e.Message).Elem().Interface())
+		case e.Fields != nil:
+			fmt.Fprintf(&b, " fields=%v", e.Fields)
+		}
+		if e.Error != "" {
+			fmt.Fprintf(&b, " error: %s", e.Error)
+		}
+	}
+	return b.String()
+}
+
+// WriteJSON writes events as JSON, one object per line. Messages whose
+// values JSON cannot represent, such as NaN, are written without them.
+func WriteJSON(w io.Writer, events []Event) error {
+	for _, e := range events {
+		line, err := json.Marshal(e)
+		if err != nil {
+			e.Message, e.Fields = nil, nil
+			e.Error = fmt.Sprintf("cannot encode message as JSON: %v", err)
+			if line, err = json.Marshal(e); err != nil {
+				return err
+			}
+		}
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
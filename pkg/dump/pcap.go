@@ -0,0 +1,351 @@
+package dump
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"slices"
+	"time"
+)
+
+// Classic pcap file magic numbers, as written by the capturing host
+const (
+	pcapMagicMicros uint32 = 0xA1B2C3D4
+	pcapMagicNanos  uint32 = 0xA1B23C4D
+	pcapngMagic     uint32 = 0x0A0D0D0A
+)
+
+// Link layer types understood by ReadPcap
+const (
+	linkNull      = 0
+	linkEthernet  = 1
+	linkRaw       = 101
+	linkLoop      = 108
+	linkLinuxSLL  = 113
+	linkIPv4      = 228
+	linkIPv6      = 229
+	linkLinuxSLL2 = 276
+)
+
+// maxPacketSize bounds the packet records read from a capture
+const maxPacketSize = 256 * 1024
+
+// TCP flags
+const (
+	tcpSYN = 0x02
+	tcpRST = 0x04
+	tcpACK = 0x10
+)
+
+// IsPcap reports whether header, the first bytes of a file, starts a pcap
+// or pcapng capture
+func IsPcap(header []byte) bool {
+	if len(header) < 4 {
+		return false
+	}
+	switch binary.BigEndian.Uint32(header) {
+	case pcapMagicMicros, pcapMagicNanos, pcapngMagic,
+		swap32(pcapMagicMicros), swap32(pcapMagicNanos):
+		return true
+	}
+	return false
+}
+
+func swap32(x uint32) uint32 {
+	return x>>24 | x>>8&0xFF00 | x<<8&0xFF0000 | x<<24
+}
+
+// ReadPcap reads a classic pcap capture and reassembles the TCP connections
+// in it, in the order they were first seen. The client of each connection
+// is the side that sent the SYN, or failing that the side that sent the
+// Bolt magic preamble.
+func ReadPcap(r io.Reader) ([]*Conn, error) {
+	br := bufio.NewReader(r)
+	var header [24]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		return nil, fmt.Errorf("reading pcap header: %w", err)
+	}
+
+	var (
+		order binary.ByteOrder
+		nanos bool
+	)
+	switch magic := binary.BigEndian.Uint32(header[:]); magic {
+	case pcapMagicMicros, pcapMagicNanos:
+		order, nanos = binary.BigEndian, magic == pcapMagicNanos
+	case swap32(pcapMagicMicros), swap32(pcapMagicNanos):
+		order, nanos = binary.LittleEndian, magic == swap32(pcapMagicNanos)
+	case pcapngMagic:
+		return nil, errors.New("pcapng captures are not supported, convert with: editcap -F pcap")
+	default:
+		return nil, fmt.Errorf("not a pcap capture (magic 0x%08X)", magic)
+	}
+	link := order.Uint32(header[20:]) & 0x0FFFFFFF
+
+	a := newAssembler()
+	for n := 1; ; n++ {
+		var record [16]byte
+		if _, err := io.ReadFull(br, record[:]); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("reading packet %d: %w", n, err)
+		}
+		sec, frac := order.Uint32(record[0:]), order.Uint32(record[4:])
+		captured, original := order.Uint32(record[8:]), order.Uint32(record[12:])
+		if captured > maxPacketSize {
+			return nil, fmt.Errorf("packet %d is %d bytes, more than %d", n, captured, maxPacketSize)
+		}
+		data := make([]byte, captured)
+		if _, err := io.ReadFull(br, data); err != nil {
+			return nil, fmt.Errorf("reading packet %d: %w", n, err)
+		}
+
+		if !nanos {
+			frac *= 1000
+		}
+		ts := time.Unix(int64(sec), int64(frac)).UTC()
+		seg, ok := parsePacket(link, data)
+		if !ok {
+			continue
+		}
+		if captured < original && len(seg.payload) > 0 {
+			return nil, fmt.Errorf("packet %d was truncated to %d of %d bytes, capture with a larger snap length (tcpdump -s 0)", n, captured, original)
+		}
+		a.add(ts, seg)
+	}
+	return a.conns(), nil
+}
+
+// tcpSegment is the part of a captured packet the assembler needs
+type tcpSegment struct {
+	src, dst netip.AddrPort
+	seq      uint32
+	flags    byte
+	payload  []byte
+}
+
+// parsePacket extracts the TCP segment from a link layer frame. It reports
+// false for anything else, including fragmented IP packets.
+func parsePacket(link uint32, data []byte) (tcpSegment, bool) {
+	var etherType uint16
+	switch link {
+	case linkNull, linkLoop:
+		// A 4-byte address family in the capturing host's byte order; the
+		// IP version nibble tells the families apart just as well
+		data = skip(data, 4)
+	case linkEthernet:
+		if len(data) < 14 {
+			return tcpSegment{}, false
+		}
+		etherType = binary.BigEndian.Uint16(data[12:])
+		data = data[14:]
+		for (etherType == 0x8100 || etherType == 0x88A8) && len(data) >= 4 {
+			// VLAN tags
+			etherType = binary.BigEndian.Uint16(data[2:])
+			data = data[4:]
+		}
+	case linkLinuxSLL:
+		if len(data) < 16 {
+			return tcpSegment{}, false
+		}
+		etherType = binary.BigEndian.Uint16(data[14:])
+		data = data[16:]
+	case linkLinuxSLL2:
+		if len(data) < 20 {
+			return tcpSegment{}, false
+		}
+		etherType = binary.BigEndian.Uint16(data[0:])
+		data = data[20:]
+	case linkRaw, linkIPv4, linkIPv6:
+	default:
+		return tcpSegment{}, false
+	}
+	if etherType != 0 && etherType != 0x0800 && etherType != 0x86DD {
+		return tcpSegment{}, false
+	}
+	if len(data) == 0 {
+		return tcpSegment{}, false
+	}
+
+	var (
+		seg     tcpSegment
+		srcAddr netip.Addr
+		dstAddr netip.Addr
+	)
+	switch data[0] >> 4 {
+	case 4:
+		if len(data) < 20 {
+			return seg, false
+		}
+		headerLen := int(data[0]&0x0F) * 4
+		total := int(binary.BigEndian.Uint16(data[2:]))
+		fragment := binary.BigEndian.Uint16(data[6:])
+		if data[9] != 6 || fragment&0x3FFF != 0 || headerLen < 20 || total < headerLen {
+			return seg, false
+		}
+		srcAddr = netip.AddrFrom4([4]byte(data[12:16]))
+		dstAddr = netip.AddrFrom4([4]byte(data[16:20]))
+		data = skip(data[:min(total, len(data))], headerLen)
+	case 6:
+		if len(data) < 40 {
+			return seg, false
+		}
+		next := data[6]
+		total := 40 + int(binary.BigEndian.Uint16(data[4:]))
+		srcAddr = netip.AddrFrom16([16]byte(data[8:24]))
+		dstAddr = netip.AddrFrom16([16]byte(data[24:40]))
+		data = data[40:min(total, len(data))]
+		// Hop-by-hop, routing and destination options headers
+		for (next == 0 || next == 43 || next == 60) && len(data) >= 2 {
+			next, data = data[0], skip(data, (int(data[1])+1)*8)
+		}
+		if next != 6 {
+			return seg, false
+		}
+	default:
+		return seg, false
+	}
+
+	if len(data) < 20 {
+		return seg, false
+	}
+	offset := int(data[12]>>4) * 4
+	if offset < 20 || offset > len(data) {
+		return seg, false
+	}
+	seg.src = netip.AddrPortFrom(srcAddr, binary.BigEndian.Uint16(data[0:]))
+	seg.dst = netip.AddrPortFrom(dstAddr, binary.BigEndian.Uint16(data[2:]))
+	seg.seq = binary.BigEndian.Uint32(data[4:])
+	seg.flags = data[13]
+	seg.payload = data[offset:]
+	return seg, true
+}
+
+func skip(data []byte, n int) []byte {
+	if n > len(data) {
+		return nil
+	}
+	return data[n:]
+}
+
+type flowKey struct {
+	src, dst netip.AddrPort
+}
+
+// flow reassembles one direction of a TCP connection
+type flow struct {
+	key      flowKey
+	started  bool
+	syn      bool // the flow opened with a SYN without ACK
+	next     uint32
+	pending  map[uint32]Segment // out of order data by sequence number
+	segments []Segment
+}
+
+// assembler collects the flows of a capture
+type assembler struct {
+	flows map[flowKey]*flow
+	order []*flow
+}
+
+func newAssembler() *assembler {
+	return &assembler{flows: map[flowKey]*flow{}}
+}
+
+// add appends a captured segment to its flow, dropping retransmitted data
+// and holding back data that arrived out of order
+func (a *assembler) add(ts time.Time, seg tcpSegment) {
+	key := flowKey{src: seg.src, dst: seg.dst}
+	f := a.flows[key]
+	if f == nil || seg.flags&tcpSYN != 0 && f.started && len(f.segments) > 0 {
+		// A new connection, or the port pair was reused
+		f = &flow{key: key, pending: map[uint32]Segment{}}
+		a.flows[key] = f
+		a.order = append(a.order, f)
+	}
+	if seg.flags&tcpSYN != 0 {
+		f.syn = seg.flags&tcpACK == 0
+		f.started = true
+		f.next = seg.seq + 1
+		return
+	}
+	if seg.flags&tcpRST != 0 || len(seg.payload) == 0 {
+		return
+	}
+	if !f.started {
+		// The capture began after the connection was opened
+		f.started = true
+		f.next = seg.seq
+	}
+
+	f.pending[seg.seq] = Segment{Time: ts, Data: slices.Clone(seg.payload)}
+	for progress := true; progress; {
+		progress = false
+		for seq, s := range f.pending {
+			ahead := int32(seq - f.next)
+			if ahead > 0 {
+				continue
+			}
+			delete(f.pending, seq)
+			progress = true
+			if -int(ahead) >= len(s.Data) {
+				// Retransmitted data
+				continue
+			}
+			s.Data = s.Data[-ahead:]
+			// Data held back becomes readable when the gap before it fills
+			s.Time = ts
+			f.segments = append(f.segments, s)
+			f.next += uint32(len(s.Data))
+		}
+	}
+}
+
+// conns pairs the flows up into connections
+func (a *assembler) conns() []*Conn {
+	var conns []*Conn
+	paired := map[*flow]bool{}
+	for _, f := range a.order {
+		if paired[f] {
+			continue
+		}
+		paired[f] = true
+		reverse := a.reverse(f)
+		if reverse != nil {
+			paired[reverse] = true
+		}
+
+		client, server := f, reverse
+		if server != nil && (server.syn && !client.syn ||
+			!client.syn && !server.syn && hasMagic(server.segments) && !hasMagic(client.segments)) {
+			client, server = server, client
+		}
+		conn := &Conn{
+			Client:     client.key.src.String(),
+			Server:     client.key.dst.String(),
+			ClientData: client.segments,
+		}
+		if server != nil {
+			conn.ServerData = server.segments
+		}
+		conns = append(conns, conn)
+	}
+	return conns
+}
+
+// reverse returns the opposite flow of f that was seen alongside it
+func (a *assembler) reverse(f *flow) *flow {
+	r := a.flows[flowKey{src: f.key.dst, dst: f.key.src}]
+	if r == nil || r == f {
+		return nil
+	}
+	return r
+}
+
+func hasMagic(segments []Segment) bool {
+	return newStream(segments).hasMagic()
+}
@@ -0,0 +1,236 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net"
+	"strings"
+
+	"neo4j-proxy/internal/auth"
+	"neo4j-proxy/pkg/bolt"
+	"neo4j-proxy/pkg/config"
+)
+
+// login is what a client authenticated with
+type login struct {
+	// hello is the HELLO of Bolt 5.1 and later, which the proxy answers
+	// itself and replays to the backend once LOGON names the tenant
+	hello         *bolt.Message
+	helloMetadata map[string]interface{}
+	// messages are the INIT, HELLO or LOGON requests relayed to the backend
+	messages []*bolt.Message
+	auth     bolt.AuthToken
+	// user is whom the principal names within the tenant, e.g. without
+	// its tenant@ prefix
+	user string
+	// metadata is passed to the tenant extractor: scheme, user_agent,
+	// routing and database where the client sent them
+	metadata map[string]interface{}
+}
+
+// SetTenantExtractor replaces the extractor that maps a client's login to
+// its tenant, by default the tenant@user username prefix
+func (p *Proxy) SetTenantExtractor(extractor auth.TenantExtractor) {
+	p.authenticator = auth.New(extractor)
+}
+
+// readLogin reads the requests that authenticate the client. From Bolt 5.1
+// the credentials follow HELLO in LOGON, so HELLO is answered before the
+// tenant is known, as a client may wait for that answer to send LOGON; see
+// bolt.EarlyHelloSuccess for what that answer reports.
+func readLogin(conn *bolt.Connection, first *bolt.Message) (*login, error) {
+	v := conn.GetVersion()
+	l := &login{messages: []*bolt.Message{first}, metadata: map[string]interface{}{}}
+
+	typed, err := bolt.ParseMessage(first, v)
+	if err != nil {
+		return nil, err
+	}
+	switch m := typed.(type) {
+	case *bolt.Init:
+		l.auth = m.Auth
+		l.metadata["user_agent"] = m.UserAgent
+	case *bolt.Hello:
+		l.auth = m.Auth
+		l.metadata["user_agent"] = m.UserAgent
+		if m.Routing != nil {
+			l.metadata["routing"] = m.Routing
+			if db, ok := m.Routing["db"].(string); ok && db != "" {
+				l.metadata["database"] = db
+			}
+		}
+	default:
+		return nil, fmt.Errorf("expected %s, got %s", bolt.MessageName(bolt.MsgHello, v), bolt.MessageName(first.Signature, v))
+	}
+
+	if v.AtLeast(5, 1) {
+		l.hello, l.messages = first, nil
+		success := bolt.EarlyHelloSuccess(v)
+		l.helloMetadata = success.Metadata
+		reply, err := success.Encode(v)
+		if err == nil {
+			err = conn.WriteMessage(reply)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		next, err := conn.ReadMessage()
+		if err != nil {
+			return nil, err
+		}
+		typed, err := bolt.ParseMessage(next, v)
+		if err != nil {
+			return nil, err
+		}
+		logon, ok := typed.(*bolt.Logon)
+		if !ok {
+			return nil, fmt.Errorf("expected LOGON after HELLO, got %s", bolt.MessageName(next.Signature, v))
+		}
+		l.messages = []*bolt.Message{next}
+		l.auth = logon.Auth
+	}
+	l.metadata["scheme"] = l.auth.Scheme()
+	return l, nil
+}
+
+// determineTenant determines which tenant the client logged in to. Clients
+// the extractor cannot place, such as those without credentials, go to the
+// default tenant if there is one.
+func (p *Proxy) determineTenant(l *login) (string, error) {
+	tenantID, user, err := p.authenticator.AuthenticateAndRouteUser(l.auth.Principal(), l.auth.Credentials(), l.metadata)
+	if err != nil {
+		fallback, defaultErr := p.defaultTenant()
+		if defaultErr != nil {
+			return "", err
+		}
+		tenantID, user = fallback, l.auth.Principal()
+	}
+	l.user = user
+	if _, ok := p.router.GetTenantConfig(tenantID); !ok {
+		return "", fmt.Errorf("%w %q", errUnknownTenant, tenantID)
+	}
+	return tenantID, nil
+}
+
+// errUnknownTenant is returned for logins naming a tenant that is not configured
+var errUnknownTenant = errors.New("unknown tenant")
+
+// errBadCredentials is returned for clients whose password the proxy rejects
+var errBadCredentials = errors.New("the client is unauthorized due to authentication failure")
+
+// authenticateUser checks the client's password against the tenant's users
+// when the proxy logs in to the backend with service credentials. Otherwise
+// the backend authenticates the client itself.
+func authenticateUser(tenant *config.TenantConfig, token bolt.AuthToken) error {
+	if tenant.Username == "" {
+		return nil
+	}
+	want, ok := tenant.Users[token.Principal()]
+	if !ok || token.Scheme() != "basic" || !auth.PasswordMatches(want, token.Credentials()) {
+		return errBadCredentials
+	}
+	return nil
+}
+
+// backendAuth returns the auth token the login is forwarded to the
+// tenant's backend with: its service credentials, the client's token with
+// the principal rewritten, or nil to forward the client's token unchanged
+func backendAuth(tenant *config.TenantConfig, tenantID string, l *login) (bolt.AuthToken, error) {
+	if tenant.Username != "" {
+		return bolt.AuthToken{"scheme": "basic", "principal": tenant.Username, "credentials": tenant.Password}, nil
+	}
+	if tenant.Principal.Mode == "" || l.auth.Principal() == "" {
+		return nil, nil
+	}
+	principal, err := rewritePrincipal(tenant.Principal, tenantID, l.user, l.auth.Principal())
+	if err != nil {
+		return nil, err
+	}
+	token := maps.Clone(l.auth)
+	token["principal"] = principal
+	return token, nil
+}
+
+// rewritePrincipal returns the backend principal for a user of the tenant
+// who logged in as principal
+func rewritePrincipal(rule config.PrincipalRewrite, tenantID, user, principal string) (string, error) {
+	switch rule.Mode {
+	case config.PrincipalStripTenant:
+		return user, nil
+	case config.PrincipalTemplate:
+		return strings.NewReplacer("{tenant}", tenantID, "{user}", user, "{principal}", principal).Replace(rule.Template), nil
+	case config.PrincipalMap:
+		if mapped, ok := rule.Map[user]; ok {
+			return mapped, nil
+		}
+		return "", errBadCredentials
+	}
+	return "", fmt.Errorf("unknown principal rewrite mode %q", rule.Mode)
+}
+
+// replaceAuth replaces the client's auth token in the login's INIT, HELLO
+// or LOGON
+func (l *login) replaceAuth(token bolt.AuthToken, v bolt.Version) error {
+	for i, msg := range l.messages {
+		typed, err := bolt.ParseMessage(msg, v)
+		if err != nil {
+			return err
+		}
+		switch m := typed.(type) {
+		case *bolt.Init:
+			m.Auth = token
+		case *bolt.Hello:
+			m.Auth = token
+		case *bolt.Logon:
+			m.Auth = token
+		}
+		if l.messages[i], err = typed.Encode(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replayHello sends the HELLO the proxy answered to a backend that speaks
+// the client's version and consumes the backend's reply, returning a
+// FAILURE as a *bolt.ServerError
+func replayHello(backend *bolt.Connection, hello *bolt.Message) error {
+	if err := backend.WriteMessage(hello); err != nil {
+		return err
+	}
+	reply, err := backend.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return helloError(reply, backend.GetVersion())
+}
+
+// helloError returns the error a reply to HELLO reports, if any
+func helloError(reply *bolt.Message, v bolt.Version) error {
+	typed, err := bolt.ParseMessage(reply, v)
+	if err != nil {
+		return err
+	}
+	switch m := typed.(type) {
+	case *bolt.Success:
+		return nil
+	case *bolt.Failure:
+		return &bolt.ServerError{Code: m.Code, Message: m.Message}
+	}
+	return fmt.Errorf("unexpected reply %s to HELLO", bolt.MessageName(reply.Signature, v))
+}
+
+// loginFailed tells the client, waiting for its login to be answered, that
+// the backend rejected the login or the HELLO the proxy replayed
+func (p *Proxy) loginFailed(client net.Conn, v bolt.Version, tenantID string, err error) {
+	log.Printf("Backend for tenant %s rejected the login of client %s: %v", tenantID, client.RemoteAddr(), err)
+	var serverErr *bolt.ServerError
+	if errors.As(err, &serverErr) {
+		writeFailure(client, v, &bolt.Failure{Code: serverErr.Code, Message: serverErr.Message})
+		return
+	}
+	p.fail(client, v, config.FailureBackendUnavailable, err)
+}
@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"log"
+	"maps"
+	"net"
+
+	"neo4j-proxy/pkg/bolt"
+	"neo4j-proxy/pkg/config"
+)
+
+// defaultFailureCodes are the Neo4j status codes sent for each failure
+// reason. Drivers retry TransientErrors and give up on the others.
+var defaultFailureCodes = map[string]string{
+	config.FailureUnauthorized:       "Neo.ClientError.Security.Unauthorized",
+	config.FailureUnknownTenant:      "Neo.ClientError.Security.Unauthorized",
+	config.FailureBackendUnavailable: "Neo.TransientError.General.DatabaseUnavailable",
+	config.FailureUnsupportedVersion: "Neo.ClientError.Request.Invalid",
+	config.FailureInvalidRequest:     "Neo.ClientError.Request.Invalid",
+	config.FailureProxyError:         "Neo.DatabaseError.General.UnknownError",
+}
+
+// failureMessages are sent in place of the underlying error, which may name
+// backends or other tenants. Invalid requests are described as they are.
+var failureMessages = map[string]string{
+	config.FailureUnauthorized:       "The client is unauthorized due to authentication failure.",
+	config.FailureUnknownTenant:      "The client is unauthorized due to authentication failure.",
+	config.FailureBackendUnavailable: "The database is unavailable.",
+	config.FailureUnsupportedVersion: "The database does not support the negotiated Bolt version.",
+	config.FailureProxyError:         "The proxy failed to process the request.",
+}
+
+// failureCodes maps failure reasons to Neo4j status codes
+type failureCodes map[string]string
+
+// newFailureCodes applies the configured codes over the defaults
+func newFailureCodes(configured map[string]string) failureCodes {
+	codes := maps.Clone(defaultFailureCodes)
+	for reason, code := range configured {
+		if _, ok := codes[reason]; !ok {
+			log.Printf("Ignoring failure code for unknown reason %q", reason)
+			continue
+		}
+		codes[reason] = code
+	}
+	return codes
+}
+
+// failure returns the FAILURE sent for reason, caused by cause
+func (c failureCodes) failure(reason string, cause error) *bolt.Failure {
+	message, ok := failureMessages[reason]
+	if !ok {
+		message = cause.Error()
+	}
+	return &bolt.Failure{Code: c[reason], Message: message}
+}
+
+// writeFailure answers the client with failure
+func writeFailure(client net.Conn, v bolt.Version, failure *bolt.Failure) {
+	msg, err := failure.Encode(v)
+	if err != nil {
+		return
+	}
+	writer := bolt.NewFrameWriter(client)
+	writer.SetVersion(v)
+	writer.WriteMessage(msg)
+}
+
+// fail answers the client with the FAILURE for reason, before its
+// connection is closed
+func (p *Proxy) fail(client net.Conn, v bolt.Version, reason string, cause error) {
+	writeFailure(client, v, p.failures.failure(reason, cause))
+}
@@ -0,0 +1,310 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"neo4j-proxy/internal/router"
+	"neo4j-proxy/pkg/bolt"
+	"neo4j-proxy/pkg/config"
+)
+
+// errLogoffMultiplexed rejects LOGOFF from clients sharing backend
+// connections, which stay logged in as the pool's backend user
+var errLogoffMultiplexed = errors.New("LOGOFF is not supported with transaction pooling")
+
+// multiplex serves a client of a tenant in transaction pooling mode. The
+// client's login is answered with the replies of a pooled backend
+// connection that logged in the same way, and a backend connection is
+// bound to the client only from a request until the connection is back in
+// READY with no requests pending: the end of an explicit transaction or of
+// an auto-commit query's results.
+func (p *Proxy) multiplex(ctx context.Context, client *bolt.Connection, tenantID string, pool *router.Pool, l *login) {
+	clientConn := client.NetConn()
+	v := client.GetVersion()
+
+	state, err := loginState(v, l)
+	if err != nil {
+		log.Printf("Rejected login from client %s: %v", clientConn.RemoteAddr(), err)
+		p.fail(clientConn, v, config.FailureInvalidRequest, err)
+		return
+	}
+
+	m := &multiplexer{
+		proxy:    p,
+		client:   clientConn,
+		v:        v,
+		state:    state,
+		pool:     pool,
+		key:      sessionKey(v, l),
+		tenantID: tenantID,
+		writer:   bolt.NewFrameWriter(clientConn),
+	}
+	m.writer.SetVersion(v)
+	m.dial = func() (*router.PooledConn, error) {
+		backend, err := p.router.RouteConnection(tenantID, []bolt.Version{v})
+		if err != nil {
+			return nil, err
+		}
+		replies, err := loginBackend(backend, l)
+		if err != nil {
+			backend.Close()
+			return nil, err
+		}
+		log.Printf("Opened shared backend connection for tenant %s, version: %s", tenantID, v)
+		return router.NewPooledConn(backend, m.key, replies), nil
+	}
+
+	conn, err := pool.Acquire(ctx, m.key, m.dial)
+	if err != nil {
+		if errors.Is(err, bolt.ErrNoCompatibleVersion) {
+			log.Printf("Failed to route to tenant %s: %v", tenantID, err)
+			p.fail(clientConn, v, config.FailureUnsupportedVersion, err)
+			return
+		}
+		p.loginFailed(clientConn, v, tenantID, err)
+		return
+	}
+	replies := conn.Login
+	pool.Return(conn)
+	if err := replayLogin(client, state, replies); err != nil {
+		log.Printf("Failed to answer login of client %s: %v", clientConn.RemoteAddr(), err)
+		return
+	}
+
+	clientAddr := clientConn.RemoteAddr().String()
+	p.sessions.Store(clientAddr, state)
+	defer p.sessions.Delete(clientAddr)
+
+	// The client holds no backend connection while it waits for requests,
+	// so shutting down only needs to stop reading from it
+	stop := context.AfterFunc(ctx, func() { clientConn.Close() })
+	defer stop()
+
+	log.Printf("Client %s shares backend connections of tenant %s", clientConn.RemoteAddr(), tenantID)
+	if err := m.clientToBackend(ctx); err != nil {
+		log.Printf("Client->Backend forwarding error for tenant %s: %v", tenantID, err)
+	}
+	m.release()
+	log.Printf("Connection closed for client %s, tenant %s", clientConn.RemoteAddr(), tenantID)
+}
+
+// multiplexer relays one client's requests to whichever backend connection
+// is bound to it
+type multiplexer struct {
+	proxy    *Proxy
+	client   net.Conn
+	v        bolt.Version
+	state    *bolt.StateMachine
+	pool     *router.Pool
+	key      string
+	tenantID string
+	dial     func() (*router.PooledConn, error)
+
+	writeMu sync.Mutex // serializes writes to the client
+	writer  *bolt.FrameWriter
+
+	mu    sync.Mutex // guards bound, and binding with recording requests
+	bound *binding
+}
+
+// binding is a backend connection bound to the client, whose responses are
+// relayed until done is closed
+type binding struct {
+	conn *router.PooledConn
+	done chan struct{}
+}
+
+// clientToBackend relays client requests, binding a backend connection to
+// the first request after the client was unbound, until the client leaves
+func (m *multiplexer) clientToBackend(ctx context.Context) error {
+	reader := bolt.NewFrameReader(m.client)
+	reader.SetLimits(m.proxy.limits)
+	for {
+		frame, err := reader.ReadFrame()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			if isLimitError(err) {
+				m.reject(ctx, m.proxy.failures.failure(config.FailureInvalidRequest, err))
+			}
+			return err
+		}
+		if frame.IsNoop() {
+			continue
+		}
+		if m.proxy.frameFilter != nil {
+			if err := m.proxy.frameFilter("client->backend", frame); err != nil {
+				return err
+			}
+		}
+		switch frame.Signature {
+		case bolt.MsgGoodbye:
+			// The shared backend connection stays open
+			return nil
+		case bolt.MsgLogoff:
+			m.reject(ctx, m.proxy.failures.failure(config.FailureInvalidRequest, errLogoffMultiplexed))
+			return errLogoffMultiplexed
+		}
+		if err := m.forward(ctx, frame); err != nil {
+			return err
+		}
+	}
+}
+
+// forward records a request and writes it to the backend connection bound
+// to the client, rejecting requests the current state does not allow
+func (m *multiplexer) forward(ctx context.Context, frame *bolt.Frame) error {
+	m.mu.Lock()
+	err := m.state.Request(frame.Signature)
+	if err == nil {
+		err = m.send(ctx, frame)
+	}
+	m.mu.Unlock()
+
+	var transitionErr *bolt.TransitionError
+	if errors.As(err, &transitionErr) {
+		m.reject(ctx, m.proxy.failures.failure(config.FailureInvalidRequest, err))
+	}
+	return err
+}
+
+// send writes a recorded request to the bound backend connection, binding
+// one first if needed. RESET of an unbound client is answered directly, as
+// there is nothing to interrupt. m.mu must be held.
+func (m *multiplexer) send(ctx context.Context, frame *bolt.Frame) error {
+	if m.bound == nil {
+		if frame.Signature == bolt.MsgReset {
+			m.state.Response(bolt.MsgSuccess, nil)
+			success, err := (&bolt.Success{}).Encode(m.v)
+			if err != nil {
+				return err
+			}
+			m.writeMu.Lock()
+			defer m.writeMu.Unlock()
+			return m.writer.WriteMessage(success)
+		}
+		conn, err := m.pool.Acquire(ctx, m.key, m.dial)
+		if err != nil {
+			log.Printf("Failed to acquire backend connection for tenant %s: %v", m.tenantID, err)
+			m.writeMu.Lock()
+			m.proxy.fail(m.client, m.v, config.FailureBackendUnavailable, err)
+			m.writeMu.Unlock()
+			return err
+		}
+		m.bound = &binding{conn: conn, done: make(chan struct{})}
+		go m.backendToClient(m.bound)
+	}
+	return bolt.NewFrameWriter(m.bound.conn.NetConn()).WriteFrame(frame)
+}
+
+// backendToClient relays the responses of a bound backend connection and
+// returns it to the pool once the client's work on it is complete. If the
+// backend fails, the client is disconnected, as its transaction is lost.
+func (m *multiplexer) backendToClient(b *binding) {
+	defer close(b.done)
+	reader := bolt.NewFrameReader(b.conn.NetConn())
+	track := m.proxy.trackResponse(m.state)
+	for {
+		frame, err := reader.ReadFrame()
+		if err == nil && m.proxy.frameFilter != nil {
+			err = m.proxy.frameFilter("backend->client", frame)
+		}
+		if err == nil {
+			// A departed client is noticed by clientToBackend, and release
+			// still pools the connection
+			m.writeMu.Lock()
+			m.writer.WriteFrame(frame)
+			m.writeMu.Unlock()
+			// Only once written, as reject writes when nothing is pending
+			err = track(frame)
+		}
+		if err != nil {
+			m.mu.Lock()
+			owned := m.bound == b
+			if owned {
+				m.bound = nil
+			}
+			m.mu.Unlock()
+			// Otherwise release stopped the relay and owns the connection
+			if owned {
+				if !errors.Is(err, io.EOF) {
+					log.Printf("Backend->Client forwarding error for tenant %s: %v", m.tenantID, err)
+				}
+				b.conn.Close()
+				m.client.Close()
+			}
+			return
+		}
+
+		m.mu.Lock()
+		done := m.bound == b && m.state.Pending() == 0 && m.state.State() == bolt.StateReady
+		if done {
+			m.bound = nil
+		}
+		m.mu.Unlock()
+		if done {
+			m.pool.Return(b.conn)
+			return
+		}
+	}
+}
+
+// release unbinds the backend connection of a departing client. It is reset
+// and pooled once the responses to the client's last requests have arrived,
+// rolling back a transaction the client left open, or closed if they do not
+// arrive in time.
+func (m *multiplexer) release() {
+	m.mu.Lock()
+	b := m.bound
+	m.mu.Unlock()
+	if b == nil {
+		return
+	}
+
+	idle := true
+	select {
+	case <-m.state.Idle():
+	case <-b.done:
+	case <-time.After(releaseTimeout):
+		idle = false
+	}
+
+	m.mu.Lock()
+	owned := m.bound == b
+	m.bound = nil
+	m.mu.Unlock()
+	if !owned {
+		// The relay returned or closed the connection itself
+		return
+	}
+
+	netConn := b.conn.NetConn()
+	netConn.SetReadDeadline(time.Now())
+	<-b.done
+	netConn.SetReadDeadline(time.Time{})
+	if idle {
+		m.pool.Put(b.conn)
+	} else {
+		b.conn.Close()
+	}
+}
+
+// reject answers a request with failure once the responses to the earlier
+// requests have been relayed
+func (m *multiplexer) reject(ctx context.Context, failure *bolt.Failure) {
+	select {
+	case <-m.state.Idle():
+	case <-ctx.Done():
+		return
+	}
+	m.writeMu.Lock()
+	defer m.writeMu.Unlock()
+	writeFailure(m.client, m.v, failure)
+}
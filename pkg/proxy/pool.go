@@ -0,0 +1,139 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"neo4j-proxy/pkg/bolt"
+)
+
+// releaseTimeout bounds the wait for the responses to a departed client's
+// last requests before its backend connection is pooled
+const releaseTimeout = 5 * time.Second
+
+// errClientGoodbye stops relaying at a pooled connection's GOODBYE, which
+// would make the backend close the connection
+var errClientGoodbye = errors.New("client said goodbye")
+
+// sessionKey identifies what a backend connection logged in as: the Bolt
+// version, the auth token and the HELLO entries that shape the session.
+// Only clients whose login has the same key may reuse the connection.
+func sessionKey(v bolt.Version, l *login) string {
+	h := sha256.New()
+	fmt.Fprint(h, v)
+	for _, msg := range append([]*bolt.Message{l.hello}, l.messages...) {
+		if msg == nil {
+			continue
+		}
+		typed, err := bolt.ParseMessage(msg, v)
+		if err != nil {
+			fmt.Fprint(h, msg.Signature, msg.Fields)
+			continue
+		}
+		switch m := typed.(type) {
+		case *bolt.Init:
+			fmt.Fprint(h, "INIT", m.Auth)
+		case *bolt.Hello:
+			// The user agent describes the client, not the session
+			extra := maps.Clone(m.Extra)
+			delete(extra, "bolt_agent")
+			fmt.Fprint(h, "HELLO", m.Auth, m.Routing, extra)
+		case *bolt.Logon:
+			fmt.Fprint(h, "LOGON", m.Auth)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// loginPooled forwards the login on a new backend connection that is to be
+// pooled and waits for the replies, which are relayed to the client and
+// returned for replaying to later clients. A FAILURE is returned as a
+// *bolt.ServerError without relaying it.
+func loginPooled(client, backend *bolt.Connection, state *bolt.StateMachine, l *login) ([]*bolt.Message, error) {
+	replies, err := loginBackend(backend, l)
+	if err != nil {
+		return nil, err
+	}
+	return replies, replayLogin(client, state, replies)
+}
+
+// loginBackend logs a backend connection in as the client would and
+// returns the backend's replies to the login, or a FAILURE as a
+// *bolt.ServerError
+func loginBackend(backend *bolt.Connection, l *login) ([]*bolt.Message, error) {
+	if l.hello != nil {
+		if err := replayHello(backend, l.hello); err != nil {
+			return nil, err
+		}
+	}
+	for _, msg := range l.messages {
+		if err := backend.WriteMessage(msg); err != nil {
+			return nil, err
+		}
+	}
+	replies := make([]*bolt.Message, 0, len(l.messages))
+	for range l.messages {
+		reply, err := backend.ReadMessage()
+		if err != nil {
+			return nil, err
+		}
+		if err := helloError(reply, backend.GetVersion()); err != nil {
+			return nil, err
+		}
+		replies = append(replies, reply)
+	}
+	return replies, nil
+}
+
+// replayLogin answers the client's login with the replies the backend sent
+// when the connection logged in
+func replayLogin(client *bolt.Connection, state *bolt.StateMachine, replies []*bolt.Message) error {
+	for _, reply := range replies {
+		var metadata map[string]interface{}
+		if len(reply.Fields) > 0 {
+			metadata, _ = reply.Fields[0].(map[string]interface{})
+		}
+		state.Response(reply.Signature, metadata)
+		if err := client.WriteMessage(reply); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// poolable wraps the request observer of a pooled connection. GOODBYE is
+// kept from the backend, and LOGOFF, which changes what the connection is
+// logged in as, keeps it from returning to the pool.
+func poolable(track func(*bolt.Frame) error, discard *atomic.Bool) func(*bolt.Frame) error {
+	return func(frame *bolt.Frame) error {
+		switch frame.Signature {
+		case bolt.MsgGoodbye:
+			return errClientGoodbye
+		case bolt.MsgLogoff:
+			discard.Store(true)
+		}
+		return track(frame)
+	}
+}
+
+// stopRelay stops relaying backend responses once the responses to the
+// client's last requests have arrived, leaving the backend connection open.
+// It reports false if they do not arrive in time.
+func stopRelay(state *bolt.StateMachine, backend net.Conn, relays *sync.WaitGroup) bool {
+	select {
+	case <-state.Idle():
+	case <-time.After(releaseTimeout):
+		return false
+	}
+	backend.SetReadDeadline(time.Now())
+	relays.Wait()
+	backend.SetReadDeadline(time.Time{})
+	return true
+}
@@ -2,11 +2,16 @@ package proxy
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
+	"os"
+	"slices"
 	"sync"
+	"sync/atomic"
 
 	"neo4j-proxy/internal/auth"
 	"neo4j-proxy/internal/router"
@@ -19,8 +24,18 @@ type Proxy struct {
 	config        *config.Config
 	router        *router.Router
 	authenticator *auth.Authenticator
-	listener      net.Listener
+	versions      []bolt.Version
+	limits        bolt.Limits
+	failures      failureCodes
+	frameFilter   FrameFilter
+	sessions      sync.Map // client address -> *bolt.StateMachine
 	wg            sync.WaitGroup
+
+	stopMu      sync.Mutex // orders registering connections and listeners with Stop
+	stopping    bool
+	listener    net.Listener
+	tlsListener net.Listener
+	wsListener  net.Listener
 }
 
 // New creates a new proxy instance
@@ -29,48 +44,170 @@ func New(cfg *config.Config) *Proxy {
 		config:        cfg,
 		router:        router.New(cfg),
 		authenticator: auth.New(auth.NewUsernameBasedExtractor()),
+		versions:      parseVersions(cfg.BoltVersions),
+		limits:        clientLimits(cfg.MessageLimits),
+		failures:      newFailureCodes(cfg.FailureCodes),
+	}
+}
+
+// clientLimits applies the configured message limits over the defaults
+func clientLimits(configured config.MessageLimits) bolt.Limits {
+	limit := func(configured, def int) int {
+		switch {
+		case configured < 0:
+			return 0
+		case configured == 0:
+			return def
+		}
+		return configured
+	}
+	return bolt.Limits{
+		MaxMessageSize:      limit(configured.MaxMessageSize, bolt.DefaultLimits.MaxMessageSize),
+		MaxDepth:            limit(configured.MaxDepth, bolt.DefaultLimits.MaxDepth),
+		MaxCollectionLength: limit(configured.MaxCollectionLength, bolt.DefaultLimits.MaxCollectionLength),
+		MaxStringLength:     limit(configured.MaxStringLength, bolt.DefaultLimits.MaxStringLength),
+	}
+}
+
+// parseVersions converts the configured Bolt versions, falling back to
+// every version the proxy supports when none are configured or valid
+func parseVersions(configured []string) []bolt.Version {
+	versions := make([]bolt.Version, 0, len(configured))
+	for _, s := range configured {
+		v, err := bolt.ParseVersion(s)
+		if err != nil {
+			log.Printf("Ignoring Bolt version: %v", err)
+			continue
+		}
+		versions = append(versions, v)
+	}
+	if len(versions) == 0 {
+		return bolt.DefaultSupportedVersions
 	}
+	return versions
 }
 
 // Start starts the proxy server
 func (p *Proxy) Start(ctx context.Context) error {
+	tlsConfig, err := serverTLS(p.config.TLS)
+	if err != nil {
+		return err
+	}
+
 	addr := fmt.Sprintf(":%d", p.config.ProxyPort)
 	listener, err := net.Listen("tcp", addr)
 	if err != nil {
 		return fmt.Errorf("failed to listen on %s: %w", addr, err)
 	}
-	p.listener = listener
+	if tlsConfig != nil && p.config.TLS.Port == 0 {
+		listener = tls.NewListener(listener, tlsConfig)
+		log.Printf("Proxy listening for TLS connections on %s", addr)
+	} else {
+		log.Printf("Proxy listening on %s", addr)
+	}
+	if !p.keepListener(&p.listener, listener) {
+		return nil
+	}
+
+	var tlsListener net.Listener
+	if tlsConfig != nil && p.config.TLS.Port != 0 {
+		tlsAddr := fmt.Sprintf(":%d", p.config.TLS.Port)
+		tcpListener, err := net.Listen("tcp", tlsAddr)
+		if err != nil {
+			listener.Close()
+			return fmt.Errorf("failed to listen on %s: %w", tlsAddr, err)
+		}
+		tlsListener = tls.NewListener(tcpListener, tlsConfig)
+		if !p.keepListener(&p.tlsListener, tlsListener) {
+			return nil
+		}
+		log.Printf("Proxy listening for TLS connections on %s", tlsAddr)
+		go p.serve(ctx, tlsListener)
+	}
+
+	if p.config.WebSocketPort != 0 {
+		if err := p.startWebSocket(ctx); err != nil {
+			listener.Close()
+			if tlsListener != nil {
+				tlsListener.Close()
+			}
+			return err
+		}
+	}
 
-	log.Printf("Proxy listening on %s", addr)
+	p.serve(ctx, listener)
+	return nil
+}
 
+// serve accepts client connections on listener until ctx is done
+func (p *Proxy) serve(ctx context.Context, listener net.Listener) {
 	go func() {
 		<-ctx.Done()
-		p.listener.Close()
+		listener.Close()
 	}()
 
 	for {
-		conn, err := p.listener.Accept()
+		conn, err := listener.Accept()
 		if err != nil {
 			select {
 			case <-ctx.Done():
-				return nil
+				return
 			default:
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
 				log.Printf("Failed to accept connection: %v", err)
 				continue
 			}
 		}
 
-		p.wg.Add(1)
+		if !p.serving(ctx) {
+			conn.Close()
+			return
+		}
 		go p.handleConnection(ctx, conn)
 	}
 }
 
+// serving registers a connection about to be handled, which Stop then waits
+// for. It returns false once the proxy is stopping or ctx is done, and the
+// connection must be refused.
+func (p *Proxy) serving(ctx context.Context) bool {
+	p.stopMu.Lock()
+	defer p.stopMu.Unlock()
+	if p.stopping || ctx.Err() != nil {
+		return false
+	}
+	p.wg.Add(1)
+	return true
+}
+
+// keepListener records a listener for Stop to close. Once the proxy is
+// stopping, it closes the listener instead and returns false.
+func (p *Proxy) keepListener(field *net.Listener, listener net.Listener) bool {
+	p.stopMu.Lock()
+	defer p.stopMu.Unlock()
+	if p.stopping {
+		listener.Close()
+		return false
+	}
+	*field = listener
+	return true
+}
+
 // Stop stops the proxy server gracefully
 func (p *Proxy) Stop() error {
-	if p.listener != nil {
-		p.listener.Close()
+	p.stopMu.Lock()
+	p.stopping = true
+	for _, listener := range []net.Listener{p.listener, p.tlsListener, p.wsListener} {
+		if listener != nil {
+			listener.Close()
+		}
 	}
+	p.stopMu.Unlock()
+
 	p.wg.Wait()
+	p.router.Close()
 	return nil
 }
 
@@ -83,69 +220,266 @@ func (p *Proxy) handleConnection(ctx context.Context, clientConn net.Conn) {
 
 	// Wrap the connection with Bolt protocol handler
 	boltConn := bolt.NewConnection(clientConn)
+	boltConn.SetSupportedVersions(p.versions)
+	boltConn.SetLimits(p.limits)
 
-	// Perform Bolt handshake with client
-	if err := boltConn.Handshake(); err != nil {
+	// Read the client's version proposals; the answer depends on the negotiation mode
+	proposals, err := boltConn.ReadHandshake()
+	if err != nil {
 		log.Printf("Handshake failed with client %s: %v", clientConn.RemoteAddr(), err)
 		return
 	}
 
-	log.Printf("Bolt handshake successful with client %s, version: %d", 
+	var (
+		backendBolt *bolt.Connection
+		tenantID    string
+	)
+	if p.config.VersionNegotiation == config.NegotiateBackendFirst {
+		// Let the backend choose among the versions the client proposed, without
+		// connecting to it when the proxy supports none of them
+		accepted := bolt.AcceptedVersions(proposals, p.versions)
+		if len(accepted) == 0 {
+			boltConn.AnswerHandshake(bolt.Version{})
+			log.Printf("Handshake failed with client %s: %v", clientConn.RemoteAddr(), bolt.ErrNoCompatibleVersion)
+			return
+		}
+		tenantID, err = p.defaultTenant()
+		if err == nil {
+			backendBolt, err = p.router.RouteConnection(tenantID, accepted)
+		}
+		if err != nil {
+			boltConn.AnswerHandshake(bolt.Version{})
+			log.Printf("Backend negotiation failed for client %s: %v", clientConn.RemoteAddr(), err)
+			return
+		}
+		defer backendBolt.Close()
+		err = boltConn.AnswerProposals(proposals, []bolt.Version{backendBolt.GetVersion()})
+	} else {
+		err = boltConn.AnswerProposals(proposals, p.clientVersions())
+	}
+	if err != nil {
+		log.Printf("Handshake failed with client %s: %v", clientConn.RemoteAddr(), err)
+		return
+	}
+
+	log.Printf("Bolt handshake successful with client %s, version: %s", 
 		clientConn.RemoteAddr(), boltConn.GetVersion())
 
 	// Read the first message to determine tenant
 	firstMsg, err := boltConn.ReadMessage()
 	if err != nil {
 		log.Printf("Failed to read first message from client %s: %v", clientConn.RemoteAddr(), err)
+		if isLimitError(err) {
+			p.fail(clientConn, boltConn.GetVersion(), config.FailureInvalidRequest, err)
+		}
 		return
 	}
 
-	// Extract tenant ID from the connection/message
-	tenantID, err := p.determineTenant(boltConn, firstMsg)
+	// Identify the tenant from the client's login
+	login, err := readLogin(boltConn, firstMsg)
+	if err != nil {
+		log.Printf("Failed to read login from client %s: %v", clientConn.RemoteAddr(), err)
+		p.fail(clientConn, boltConn.GetVersion(), config.FailureInvalidRequest, err)
+		return
+	}
+	messageTenantID, err := p.determineTenant(login)
 	if err != nil {
 		log.Printf("Failed to determine tenant for client %s: %v", clientConn.RemoteAddr(), err)
+		reason := config.FailureUnauthorized
+		if errors.Is(err, errUnknownTenant) {
+			reason = config.FailureUnknownTenant
+		}
+		p.fail(clientConn, boltConn.GetVersion(), reason, err)
 		return
 	}
 
-	log.Printf("Client %s routed to tenant: %s", clientConn.RemoteAddr(), tenantID)
+	if backendBolt != nil && messageTenantID != tenantID {
+		log.Printf("Client %s identified as tenant %s after negotiating with tenant %s", 
+			clientConn.RemoteAddr(), messageTenantID, tenantID)
+		p.fail(clientConn, boltConn.GetVersion(), config.FailureUnknownTenant,
+			fmt.Errorf("tenant %s is not served by this connection", messageTenantID))
+		return
+	}
+	tenantID = messageTenantID
 
-	// Establish connection to backend
-	backendConn, err := p.router.RouteConnection(tenantID)
+	tenantConfig, _ := p.router.GetTenantConfig(tenantID)
+	if err := authenticateUser(tenantConfig, login.auth); err != nil {
+		log.Printf("Rejected login from client %s to tenant %s: %v", clientConn.RemoteAddr(), tenantID, err)
+		p.fail(clientConn, boltConn.GetVersion(), config.FailureUnauthorized, err)
+		return
+	}
+	token, err := backendAuth(tenantConfig, tenantID, login)
+	if err == nil && token != nil {
+		err = login.replaceAuth(token, boltConn.GetVersion())
+	}
 	if err != nil {
-		log.Printf("Failed to route to tenant %s: %v", tenantID, err)
+		log.Printf("Failed to rewrite login of client %s to tenant %s: %v", clientConn.RemoteAddr(), tenantID, err)
+		reason := config.FailureProxyError
+		if errors.Is(err, errBadCredentials) {
+			reason = config.FailureUnauthorized
+		}
+		p.fail(clientConn, boltConn.GetVersion(), reason, err)
 		return
 	}
-	defer backendConn.Close()
 
-	log.Printf("Connected to backend for tenant %s", tenantID)
+	log.Printf("Client %s routed to tenant: %s", clientConn.RemoteAddr(), tenantID)
 
-	// Create backend Bolt connection
-	backendBolt := bolt.NewConnection(backendConn)
+	// Bolt 3 is the first version whose transactions the state machine can
+	// follow, which transaction pooling relies on
+	if backendBolt == nil && tenantConfig.PoolMode == config.PoolModeTransaction &&
+		boltConn.GetVersion().AtLeast(3, 0) {
+		if pool := p.router.Pool(tenantID); pool != nil {
+			p.multiplex(ctx, boltConn, tenantID, pool, login)
+			return
+		}
+	}
 
-	// Perform handshake with backend
-	if err := backendBolt.Handshake(); err != nil {
-		log.Printf("Backend handshake failed for tenant %s: %v", tenantID, err)
-		return
+	// A pooled backend connection is closed on return unless it was put
+	// back into the pool
+	var (
+		pool   *router.Pool
+		pooled *router.PooledConn
+		reused bool
+	)
+	defer func() {
+		if pooled != nil {
+			pooled.Close()
+		}
+	}()
+
+	if backendBolt == nil {
+		key := sessionKey(boltConn.GetVersion(), login)
+		if pool = p.router.Pool(tenantID); pool != nil {
+			pooled = pool.Get(key)
+			reused = pooled != nil
+		}
+		if reused {
+			backendBolt = pooled.Connection
+			log.Printf("Reusing pooled backend connection for tenant %s", tenantID)
+		} else {
+			// Establish connection to backend, which must accept the client's
+			// version unless the proxy translates
+			backendBolt, err = p.routeBackend(tenantID, boltConn.GetVersion())
+			if err != nil {
+				log.Printf("Failed to route to tenant %s: %v", tenantID, err)
+				reason := config.FailureBackendUnavailable
+				if errors.Is(err, bolt.ErrNoCompatibleVersion) {
+					reason = config.FailureUnsupportedVersion
+				}
+				p.fail(clientConn, boltConn.GetVersion(), reason, err)
+				return
+			}
+			// Translated connections are not pooled
+			if pool != nil && backendBolt.GetVersion() == boltConn.GetVersion() {
+				pooled = router.NewPooledConn(backendBolt, key, nil)
+			} else {
+				defer backendBolt.Close()
+			}
+		}
 	}
+	backendConn := backendBolt.NetConn()
+
+	log.Printf("Connected to backend for tenant %s, version: %s", tenantID, backendBolt.GetVersion())
 
-	// Forward the first message to backend
-	if err := backendBolt.WriteMessage(firstMsg); err != nil {
-		log.Printf("Failed to forward first message to backend for tenant %s: %v", tenantID, err)
+	// Follow the connection state from here on, starting with the login
+	state, err := loginState(boltConn.GetVersion(), login)
+	if err != nil {
+		log.Printf("Rejected login from client %s: %v", clientConn.RemoteAddr(), err)
+		p.fail(clientConn, boltConn.GetVersion(), config.FailureInvalidRequest, err)
 		return
 	}
+	clientAddr := clientConn.RemoteAddr().String()
+	p.sessions.Store(clientAddr, state)
+	defer p.sessions.Delete(clientAddr)
 
 	// Start bidirectional proxy
+	proxyCtx := ctx
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	var wg sync.WaitGroup
+	var (
+		clientToBackend, backendToClient func() error
+		discard                          atomic.Bool // the connection must not return to the pool
+	)
+	if backendBolt.GetVersion() == boltConn.GetVersion() {
+		switch {
+		case reused:
+			// The connection logged in as the client would, so the client
+			// gets the replies the backend sent then
+			if err := replayLogin(boltConn, state, pooled.Login); err != nil {
+				log.Printf("Failed to answer login of client %s: %v", clientConn.RemoteAddr(), err)
+				return
+			}
+		case pooled != nil:
+			if pooled.Login, err = loginPooled(boltConn, backendBolt, state, login); err != nil {
+				p.loginFailed(clientConn, boltConn.GetVersion(), tenantID, err)
+				return
+			}
+		default:
+			if login.hello != nil {
+				if err := replayHello(backendBolt, login.hello); err != nil {
+					p.loginFailed(clientConn, boltConn.GetVersion(), tenantID, err)
+					return
+				}
+			}
+			// Forward the login to backend
+			for _, msg := range login.messages {
+				if err := backendBolt.WriteMessage(msg); err != nil {
+					log.Printf("Failed to forward login to backend for tenant %s: %v", tenantID, err)
+					p.fail(clientConn, boltConn.GetVersion(), config.FailureBackendUnavailable, err)
+					return
+				}
+			}
+		}
+		clientToBackend = func() error {
+			track := p.trackRequest(ctx, state, clientConn, boltConn.GetVersion())
+			if pooled != nil {
+				track = poolable(track, &discard)
+			}
+			err := p.forwardData(clientConn, backendConn, "client->backend", p.limits, track, nil)
+			if isLimitError(err) {
+				rejectRequest(ctx, state, clientConn, boltConn.GetVersion(), p.failures.failure(config.FailureInvalidRequest, err))
+			}
+			return err
+		}
+		backendToClient = func() error {
+			return p.forwardData(backendConn, clientConn, "backend->client", bolt.Limits{}, nil, p.trackResponse(state))
+		}
+	} else {
+		log.Printf("Translating between client Bolt %s and backend Bolt %s for tenant %s",
+			boltConn.GetVersion(), backendBolt.GetVersion(), tenantID)
+		relay := newTranslatingRelay(boltConn, backendBolt, state, p.failures)
+		if login.hello != nil {
+			if err := relay.replayHello(login.hello); err != nil {
+				p.loginFailed(clientConn, boltConn.GetVersion(), tenantID, err)
+				return
+			}
+		}
+		for _, msg := range login.messages {
+			if err := relay.forward(msg); err != nil {
+				log.Printf("Failed to forward login to backend for tenant %s: %v", tenantID, err)
+				p.fail(clientConn, boltConn.GetVersion(), config.FailureBackendUnavailable, err)
+				return
+			}
+		}
+		clientToBackend = func() error { return relay.clientToBackend(ctx) }
+		backendToClient = relay.backendToClient
+	}
+
+	var (
+		wg          sync.WaitGroup
+		clientEnded atomic.Bool // the client left without breaking the session
+	)
 
 	// Forward from client to backend
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 		defer cancel()
-		if err := p.forwardData(clientConn, backendConn, "client->backend"); err != nil {
+		err := clientToBackend()
+		if err == nil || errors.Is(err, errClientGoodbye) {
+			clientEnded.Store(true)
+		} else {
 			log.Printf("Client->Backend forwarding error for tenant %s: %v", tenantID, err)
 		}
 	}()
@@ -155,7 +489,7 @@ func (p *Proxy) handleConnection(ctx context.Context, clientConn net.Conn) {
 	go func() {
 		defer wg.Done()
 		defer cancel()
-		if err := p.forwardData(backendConn, clientConn, "backend->client"); err != nil {
+		if err := backendToClient(); err != nil && !errors.Is(err, os.ErrDeadlineExceeded) {
 			log.Printf("Backend->Client forwarding error for tenant %s: %v", tenantID, err)
 		}
 	}()
@@ -166,29 +500,134 @@ func (p *Proxy) handleConnection(ctx context.Context, clientConn net.Conn) {
 		log.Printf("Connection context cancelled for tenant %s", tenantID)
 	}
 
+	// Unblock whichever direction is still copying. A pooled backend
+	// connection whose client left cleanly goes back to the pool instead.
+	clientConn.Close()
+	if pooled != nil && clientEnded.Load() && !discard.Load() && proxyCtx.Err() == nil &&
+		stopRelay(state, backendConn, &wg) {
+		pool.Put(pooled)
+		pooled = nil
+	} else {
+		backendConn.Close()
+	}
+
 	wg.Wait()
 	log.Printf("Connection closed for client %s, tenant %s", clientConn.RemoteAddr(), tenantID)
 }
 
-// determineTenant determines which tenant this connection should be routed to
-func (p *Proxy) determineTenant(conn *bolt.Connection, firstMsg *bolt.Message) (string, error) {
-	// For now, use simple extraction from the Bolt connection
-	// In production, this would parse INIT message authentication details
-	tenantID, err := conn.ExtractTenantID(firstMsg)
-	if err != nil {
-		// Fallback to simple round-robin or default tenant
-		tenants := p.router.ListTenants()
-		if len(tenants) > 0 {
-			return tenants[0], nil
+// loginState returns a state machine for a client that sent the login,
+// with the HELLO the proxy answered already succeeded
+func loginState(v bolt.Version, l *login) (*bolt.StateMachine, error) {
+	state := bolt.NewStateMachine(v)
+	if l.hello != nil {
+		state.Request(l.hello.Signature)
+		state.Response(bolt.MsgSuccess, l.helloMetadata)
+	}
+	for _, msg := range l.messages {
+		if err := state.Request(msg.Signature); err != nil {
+			return nil, err
+		}
+	}
+	return state, nil
+}
+
+// routeBackend connects to the tenant's backend at the client's version or,
+// with version translation enabled, at any version the backend accepts
+func (p *Proxy) routeBackend(tenantID string, v bolt.Version) (*bolt.Connection, error) {
+	backend, err := p.router.RouteConnection(tenantID, []bolt.Version{v})
+	if err == nil || !p.config.VersionTranslation || !errors.Is(err, bolt.ErrNoCompatibleVersion) {
+		return backend, err
+	}
+	log.Printf("Backend for tenant %s does not accept Bolt %s, negotiating a version to translate to", tenantID, v)
+	return p.router.RouteConnection(tenantID, bolt.DefaultSupportedVersions)
+}
+
+// clientVersions returns the versions offered to clients when the backend is
+// not consulted first. If every tenant is pinned, only pinned versions are
+// offered so the backend leg can always match the client, unless the proxy
+// translates between versions.
+func (p *Proxy) clientVersions() []bolt.Version {
+	pinned := p.router.PinnedVersions()
+	if pinned == nil || p.config.VersionTranslation {
+		return p.versions
+	}
+
+	var versions []bolt.Version
+	for _, v := range p.versions {
+		if slices.Contains(pinned, v) {
+			versions = append(versions, v)
 		}
-		return "", fmt.Errorf("no tenants configured")
 	}
+	return versions
+}
+
+// defaultTenant returns the tenant for clients that have not identified
+// themselves, yet or at all: the configured default, or the only configured tenant
+func (p *Proxy) defaultTenant() (string, error) {
+	if p.config.DefaultTenant != "" {
+		return p.config.DefaultTenant, nil
+	}
+	tenants := p.router.ListTenants()
+	if len(tenants) == 1 {
+		return tenants[0], nil
+	}
+	return "", fmt.Errorf("default_tenant is required for %s version negotiation", config.NegotiateBackendFirst)
+}
+
+// FrameFilter inspects each relayed frame. Returning an error stops the
+// relay and closes the connection.
+type FrameFilter func(direction string, frame *bolt.Frame) error
 
-	return tenantID, nil
+// SetFrameFilter installs a filter applied to every relayed frame
+func (p *Proxy) SetFrameFilter(filter FrameFilter) {
+	p.frameFilter = filter
 }
 
-// forwardData forwards data from source to destination
-func (p *Proxy) forwardData(src, dst net.Conn, direction string) error {
-	_, err := io.Copy(dst, src)
-	return err
+// forwardData relays whole message frames from source to destination
+// without decoding them, counting messages and failures along the way.
+// Frames are read within limits; observe, if set, sees each frame before it
+// is written and written after, and an error from either stops the relay.
+func (p *Proxy) forwardData(src, dst net.Conn, direction string, limits bolt.Limits, observe, written func(*bolt.Frame) error) error {
+	reader := bolt.NewFrameReader(src)
+	reader.SetLimits(limits)
+	writer := bolt.NewFrameWriter(dst)
+
+	var messages, failures int
+	defer func() {
+		log.Printf("Relayed %d messages (%d failures) %s", messages, failures, direction)
+	}()
+
+	for {
+		frame, err := reader.ReadFrame()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if !frame.IsNoop() {
+			messages++
+			if frame.Signature == bolt.MsgFailure {
+				failures++
+			}
+		}
+		if p.frameFilter != nil {
+			if err := p.frameFilter(direction, frame); err != nil {
+				return err
+			}
+		}
+		if observe != nil {
+			if err := observe(frame); err != nil {
+				return err
+			}
+		}
+		if err := writer.WriteFrame(frame); err != nil {
+			return err
+		}
+		if written != nil {
+			if err := written(frame); err != nil {
+				return err
+			}
+		}
+	}
 }
\ No newline at end of file
@@ -0,0 +1,90 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"neo4j-proxy/pkg/bolt"
+	"neo4j-proxy/pkg/config"
+)
+
+// ConnectionStates returns the Bolt state of every relayed connection,
+// keyed by client address
+func (p *Proxy) ConnectionStates() map[string]bolt.State {
+	states := make(map[string]bolt.State)
+	p.sessions.Range(func(key, value interface{}) bool {
+		states[key.(string)] = value.(*bolt.StateMachine).State()
+		return true
+	})
+	return states
+}
+
+// PooledConnections returns the number of idle backend connections pooled
+// for a tenant
+func (p *Proxy) PooledConnections(tenantID string) int {
+	pool := p.router.Pool(tenantID)
+	if pool == nil {
+		return 0
+	}
+	return pool.Idle()
+}
+
+// trackRequest returns a relay observer that drives the state machine from
+// client requests and rejects those the current state does not allow
+func (p *Proxy) trackRequest(ctx context.Context, state *bolt.StateMachine, client net.Conn, v bolt.Version) func(*bolt.Frame) error {
+	return func(frame *bolt.Frame) error {
+		if frame.IsNoop() {
+			return nil
+		}
+		if err := state.Request(frame.Signature); err != nil {
+			rejectRequest(ctx, state, client, v, p.failures.failure(config.FailureInvalidRequest, err))
+			return err
+		}
+		return nil
+	}
+}
+
+// trackResponse returns a relay observer that drives the state machine from
+// backend responses, decoding only SUCCESS metadata. It must see a response
+// only once the response is written to the client, as rejectRequest writes
+// as soon as the state machine has no requests pending.
+func (p *Proxy) trackResponse(state *bolt.StateMachine) func(*bolt.Frame) error {
+	return func(frame *bolt.Frame) error {
+		if frame.IsNoop() {
+			return nil
+		}
+		var metadata map[string]interface{}
+		if frame.Signature == bolt.MsgSuccess {
+			msg, err := frame.Message()
+			if err != nil {
+				return err
+			}
+			if len(msg.Fields) > 0 {
+				metadata, _ = msg.Fields[0].(map[string]interface{})
+			}
+		}
+		state.Response(frame.Signature, metadata)
+		return nil
+	}
+}
+
+// rejectRequest answers a request the state machine or the message limits
+// rejected with failure. Responses to earlier pipelined requests are relayed
+// first so the client can match the FAILURE to its request; the connection
+// is closed afterwards.
+func rejectRequest(ctx context.Context, state *bolt.StateMachine, client net.Conn, v bolt.Version, failure *bolt.Failure) {
+	select {
+	case <-state.Idle():
+	case <-ctx.Done():
+		return
+	}
+	writeFailure(client, v, failure)
+}
+
+// isLimitError reports whether a client message exceeded the message
+// limits, which the client is told about before the connection closes
+func isLimitError(err error) bool {
+	var limitErr *bolt.LimitError
+	return errors.As(err, &limitErr)
+}
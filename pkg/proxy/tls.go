@@ -0,0 +1,147 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"neo4j-proxy/pkg/config"
+)
+
+// certCheckInterval is how often the certificate files are checked for
+// changes, at most once per interval and only when clients connect
+const certCheckInterval = time.Second
+
+// tlsVersions maps configured minimum versions to their crypto/tls values.
+// TLS 1.0 and 1.1 are deprecated by RFC 8996 and not accepted.
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// serverTLS builds the TLS configuration of the client listener, or returns
+// nil when TLS is not configured
+func serverTLS(cfg config.TLSConfig) (*tls.Config, error) {
+	if cfg.CertFile == "" {
+		return nil, nil
+	}
+
+	minVersion := uint16(tls.VersionTLS12)
+	if cfg.MinVersion != "" {
+		v, ok := tlsVersions[cfg.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown or deprecated TLS version %q, use \"1.2\" or \"1.3\"", cfg.MinVersion)
+		}
+		minVersion = v
+	}
+	suites, err := cipherSuites(cfg.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+	certs, err := newCertReloader(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		MinVersion:     minVersion,
+		CipherSuites:   suites,
+		GetCertificate: certs.certificate,
+	}, nil
+}
+
+// cipherSuites looks up cipher suites by name; insecure suites are not
+// accepted
+func cipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// certReloader serves a certificate and key pair, loading it again when
+// either file changes. A pair that fails to load, e.g. while only one of
+// the files has been replaced, leaves the previous one in use.
+type certReloader struct {
+	certFile, keyFile string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	stamp   string // modification times and sizes of the loaded files
+	checked time.Time
+}
+
+// newCertReloader loads the initial certificate
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	stamp, err := r.fileStamp()
+	if err == nil {
+		err = r.load(stamp)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	return r, nil
+}
+
+// certificate returns the current certificate, reloading it first if the
+// files changed; it is the listener's tls.Config.GetCertificate
+func (r *certReloader) certificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if now := time.Now(); now.Sub(r.checked) >= certCheckInterval {
+		r.checked = now
+		stamp, err := r.fileStamp()
+		if err == nil && stamp != r.stamp {
+			err = r.load(stamp)
+			if err == nil {
+				log.Printf("Reloaded TLS certificate from %s", r.certFile)
+			}
+		}
+		if err != nil {
+			log.Printf("Failed to reload TLS certificate, keeping the previous one: %v", err)
+		}
+	}
+	return r.cert, nil
+}
+
+// load reads the certificate and key pair; r.mu must be held after
+// construction
+func (r *certReloader) load(stamp string) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.cert = &cert
+	r.stamp = stamp
+	return nil
+}
+
+// fileStamp identifies the current version of both files
+func (r *certReloader) fileStamp() (string, error) {
+	var stamp string
+	for _, name := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return "", err
+		}
+		stamp += fmt.Sprintf("%d:%d;", info.ModTime().UnixNano(), info.Size())
+	}
+	return stamp, nil
+}
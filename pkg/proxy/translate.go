@@ -0,0 +1,158 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"neo4j-proxy/pkg/bolt"
+	"neo4j-proxy/pkg/config"
+)
+
+// translatingRelay relays between a client and a backend that negotiated
+// different Bolt versions, decoding every message to translate it
+type translatingRelay struct {
+	client     *bolt.Connection
+	backend    *bolt.Connection
+	state      *bolt.StateMachine
+	translator *bolt.Translator
+	failures   failureCodes
+	// mu serializes the translator and writes to the client, so replies the
+	// translator makes itself stay in order with the backend's
+	mu sync.Mutex
+}
+
+func newTranslatingRelay(client, backend *bolt.Connection, state *bolt.StateMachine, failures failureCodes) *translatingRelay {
+	return &translatingRelay{
+		client:     client,
+		backend:    backend,
+		state:      state,
+		translator: bolt.NewTranslator(client.GetVersion(), backend.GetVersion()),
+		failures:   failures,
+	}
+}
+
+// clientToBackend translates client requests until the client disconnects
+func (r *translatingRelay) clientToBackend(ctx context.Context) error {
+	for {
+		msg, err := r.client.ReadMessage()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			if isLimitError(err) {
+				r.reject(ctx, err)
+			}
+			return err
+		}
+		if err := r.state.Request(msg.Signature); err != nil {
+			r.reject(ctx, err)
+			return err
+		}
+		if err := r.forward(msg); err != nil {
+			return err
+		}
+	}
+}
+
+// reject answers a request the client may not send with FAILURE
+func (r *translatingRelay) reject(ctx context.Context, err error) {
+	rejectRequest(ctx, r.state, r.client.NetConn(), r.client.GetVersion(), r.failures.failure(config.FailureInvalidRequest, err))
+}
+
+// forward translates one request, sends the result to the backend and
+// answers the client directly where the translator does
+func (r *translatingRelay) forward(msg *bolt.Message) error {
+	r.mu.Lock()
+	out, err := r.translator.Request(msg)
+	if err == nil {
+		err = r.send(r.translator.Flush())
+	}
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// Backend writes stay outside the lock so a backend waiting for its
+	// responses to be read cannot stall the other direction
+	for _, m := range out {
+		if err := r.backend.WriteMessage(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replayHello sends the HELLO the proxy answered to the backend and
+// consumes the backend's reply, which the client must not see again
+func (r *translatingRelay) replayHello(hello *bolt.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out, err := r.translator.Request(hello)
+	if err != nil {
+		return err
+	}
+	// The translator answers HELLO itself for backends before 5.1
+	if replies := r.translator.Flush(); len(replies) > 0 {
+		return helloError(replies[0], r.client.GetVersion())
+	}
+	for _, m := range out {
+		if err := r.backend.WriteMessage(m); err != nil {
+			return err
+		}
+	}
+	for {
+		msg, err := r.backend.ReadMessage()
+		if err != nil {
+			return err
+		}
+		replies, err := r.translator.Response(msg)
+		if err != nil {
+			return err
+		}
+		if len(replies) > 0 {
+			return helloError(replies[0], r.client.GetVersion())
+		}
+	}
+}
+
+// backendToClient translates backend responses until the backend disconnects
+func (r *translatingRelay) backendToClient() error {
+	for {
+		msg, err := r.backend.ReadMessage()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		r.mu.Lock()
+		out, err := r.translator.Response(msg)
+		if err == nil {
+			err = r.send(out)
+		}
+		r.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// send writes responses to the client and drives the state machine with
+// them. The caller holds mu.
+func (r *translatingRelay) send(msgs []*bolt.Message) error {
+	r.client.SetUTCPatch(r.translator.ClientUTC())
+	for _, msg := range msgs {
+		var metadata map[string]interface{}
+		if msg.Signature == bolt.MsgSuccess && len(msg.Fields) > 0 {
+			metadata, _ = msg.Fields[0].(map[string]interface{})
+		}
+		if err := r.client.WriteMessage(msg); err != nil {
+			return err
+		}
+		// Only once written, as reject writes when nothing is pending
+		r.state.Response(msg.Signature, metadata)
+	}
+	return nil
+}
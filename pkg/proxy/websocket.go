@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/websocket"
+)
+
+// startWebSocket listens for Bolt over WebSocket, as used by Neo4j Browser
+// and browser drivers. Each binary frame stream is handled like a TCP
+// connection.
+func (p *Proxy) startWebSocket(ctx context.Context) error {
+	addr := fmt.Sprintf(":%d", p.config.WebSocketPort)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	if !p.keepListener(&p.wsListener, listener) {
+		return nil
+	}
+
+	log.Printf("Proxy listening for WebSocket connections on %s", addr)
+
+	server := &http.Server{Handler: websocket.Server{
+		// The proxy may log in on the client's behalf, so pages from other
+		// sites must not be able to open sessions with a visitor's browser
+		Handshake: func(_ *websocket.Config, req *http.Request) error {
+			if !originAllowed(req, p.config.WebSocketOrigins) {
+				log.Printf("Rejected WebSocket connection from %s with origin %q", req.RemoteAddr, req.Header.Get("Origin"))
+				return errOriginNotAllowed
+			}
+			return nil
+		},
+		Handler: func(ws *websocket.Conn) {
+			if !p.serving(ctx) {
+				return
+			}
+			ws.PayloadType = websocket.BinaryFrame
+			p.handleConnection(ctx, &wsConn{Conn: ws, remote: remoteAddr(ws.Request())})
+		},
+	}}
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Printf("WebSocket listener stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+// errOriginNotAllowed rejects WebSocket handshakes from foreign pages
+var errOriginNotAllowed = errors.New("origin not allowed")
+
+// originAllowed reports whether the page that opened a WebSocket may
+// connect: its origin is listed, or, with no list, is the proxy's own host.
+// Requests without an Origin come from clients other than browsers.
+func originAllowed(req *http.Request, allowed []string) bool {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if len(allowed) == 0 {
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, req.Host)
+	}
+	for _, a := range allowed {
+		if a == "*" || strings.EqualFold(strings.TrimSuffix(a, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// wsConn reports the client's TCP address, where websocket.Conn reports the
+// origin of the page that opened it
+type wsConn struct {
+	*websocket.Conn
+	remote net.Addr
+}
+
+func (c *wsConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// remoteAddr returns the address the WebSocket request came from
+func remoteAddr(req *http.Request) net.Addr {
+	addr, err := net.ResolveTCPAddr("tcp", req.RemoteAddr)
+	if err != nil {
+		return &net.TCPAddr{}
+	}
+	return addr
+}
@@ -74,6 +74,22 @@ var _ = Describe("Authentication and Tenant Extraction", func() {
 				Expect(tenantID).To(Equal("tenant"))
 			})
 		})
+
+		Context("when extracting the user", func() {
+			It("should strip the tenant prefix", func() {
+				tenantID, user, err := authenticator.AuthenticateAndRouteUser("tenant1@alice@example.com", "password", map[string]interface{}{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(tenantID).To(Equal("tenant1"))
+				Expect(user).To(Equal("alice@example.com"))
+			})
+
+			It("should keep usernames without a tenant prefix", func() {
+				tenantID, user, err := authenticator.AuthenticateAndRouteUser("@alice", "password", map[string]interface{}{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(tenantID).To(Equal("tenant1"))
+				Expect(user).To(Equal("@alice"))
+			})
+		})
 	})
 
 	Describe("Database-based Tenant Extraction", func() {
@@ -136,5 +152,46 @@ var _ = Describe("Authentication and Tenant Extraction", func() {
 				Expect(tenantID).To(Equal("tenant1"))
 			})
 		})
+
+		Context("when the extractor does not extract users", func() {
+			It("should name the username as the user", func() {
+				tenantID, user, err := auth.New(fixedTenant("tenant3")).AuthenticateAndRouteUser("tenant1@alice", "password", nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(tenantID).To(Equal("tenant3"))
+				Expect(user).To(Equal("tenant1@alice"))
+			})
+		})
 	})
-})
\ No newline at end of file
+
+	Describe("Passwords", func() {
+		It("should check salted hashes", func() {
+			hash, err := auth.HashPassword("secret")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hash).To(HavePrefix("pbkdf2-sha256:600000:"))
+			Expect(auth.PasswordMatches(hash, "secret")).To(BeTrue())
+			Expect(auth.PasswordMatches(hash, "Secret")).To(BeFalse())
+
+			other, err := auth.HashPassword("secret")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(other).NotTo(Equal(hash))
+		})
+
+		It("should match no password against a malformed hash", func() {
+			Expect(auth.PasswordMatches("pbkdf2-sha256:1:c2FsdA", "pbkdf2-sha256:1:c2FsdA")).To(BeFalse())
+			Expect(auth.PasswordMatches("pbkdf2-sha256:x:c2FsdA:a2V5", "")).To(BeFalse())
+		})
+
+		It("should still accept unsalted digests and clear text", func() {
+			Expect(auth.PasswordMatches("sha256:2BB80D537B1DA3E38BD30361AA855686BDE0EACD7162FEF6A25FE97BF527A25B", "secret")).To(BeTrue())
+			Expect(auth.PasswordMatches("secret", "secret")).To(BeTrue())
+			Expect(auth.PasswordMatches("secret", "secret2")).To(BeFalse())
+		})
+	})
+})
+
+// fixedTenant is a TenantExtractor routing every login to one tenant
+type fixedTenant string
+
+func (t fixedTenant) ExtractTenantID(username, password string, metadata map[string]interface{}) (string, error) {
+	return string(t), nil
+}
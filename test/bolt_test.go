@@ -3,7 +3,9 @@ package test
 import (
 	"bytes"
 	"encoding/binary"
+	"io"
 	"net"
+	"strings"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -59,7 +61,7 @@ var _ = Describe("Bolt Protocol", func() {
 			It("should create a connection wrapper", func() {
 				conn := bolt.NewConnection(clientConn)
 				Expect(conn).NotTo(BeNil())
-				Expect(conn.GetVersion()).To(Equal(0)) // Not negotiated yet
+				Expect(conn.GetVersion().IsZero()).To(BeTrue()) // Not negotiated yet
 			})
 		})
 
@@ -92,6 +94,91 @@ var _ = Describe("Bolt Protocol", func() {
 				Expect(err).NotTo(HaveOccurred())
 			})
 
+			It("should negotiate minor versions from range proposals", func() {
+				go func() {
+					defer GinkgoRecover()
+					
+					// Propose 5.8 down to 5.0 and 4.4 down to 4.0
+					var buf bytes.Buffer
+					binary.Write(&buf, binary.BigEndian, bolt.BoltMagicPreamble)
+					binary.Write(&buf, binary.BigEndian, []uint32{0x00080805, 0x00040404, 0, 0})
+					_, err := serverConn.Write(buf.Bytes())
+					Expect(err).NotTo(HaveOccurred())
+				}()
+
+				boltConn.SetSupportedVersions([]bolt.Version{{Major: 5, Minor: 4}, {Major: 4, Minor: 4}})
+				Expect(boltConn.Handshake()).To(Succeed())
+				Expect(boltConn.GetVersion()).To(Equal(bolt.Version{Major: 5, Minor: 4}))
+
+				var agreed uint32
+				Expect(binary.Read(serverConn, binary.BigEndian, &agreed)).To(Succeed())
+				Expect(agreed).To(Equal(uint32(0x00000405)))
+			})
+
+			It("should answer zero when no version is supported", func() {
+				go func() {
+					defer GinkgoRecover()
+					
+					var buf bytes.Buffer
+					binary.Write(&buf, binary.BigEndian, bolt.BoltMagicPreamble)
+					binary.Write(&buf, binary.BigEndian, []uint32{0x00000006, 0, 0, 0})
+					_, err := serverConn.Write(buf.Bytes())
+					Expect(err).NotTo(HaveOccurred())
+				}()
+
+				Expect(boltConn.Handshake()).To(MatchError(bolt.ErrNoCompatibleVersion))
+
+				var agreed uint32
+				Expect(binary.Read(serverConn, binary.BigEndian, &agreed)).To(Succeed())
+				Expect(agreed).To(BeZero())
+			})
+
+			It("should perform the client side of the handshake", func() {
+				go func() {
+					defer GinkgoRecover()
+					
+					var magic uint32
+					Expect(binary.Read(serverConn, binary.BigEndian, &magic)).To(Succeed())
+					Expect(magic).To(Equal(bolt.BoltMagicPreamble))
+					
+					proposals := make([]uint32, 4)
+					Expect(binary.Read(serverConn, binary.BigEndian, proposals)).To(Succeed())
+					Expect(proposals).To(Equal([]uint32{0x00010405, 0x00000404, 0, 0}))
+					
+					Expect(binary.Write(serverConn, binary.BigEndian, uint32(0x00000305))).To(Succeed())
+				}()
+
+				boltConn.SetSupportedVersions([]bolt.Version{{Major: 5, Minor: 4}, {Major: 5, Minor: 3}, {Major: 4, Minor: 4}})
+				Expect(boltConn.ClientHandshake()).To(Succeed())
+				Expect(boltConn.GetVersion()).To(Equal(bolt.Version{Major: 5, Minor: 3}))
+			})
+
+			It("should fail the client handshake when the server rejects all versions", func() {
+				go func() {
+					defer GinkgoRecover()
+					
+					request := make([]byte, 20)
+					_, err := io.ReadFull(serverConn, request)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(binary.Write(serverConn, binary.BigEndian, uint32(0))).To(Succeed())
+				}()
+
+				Expect(boltConn.ClientHandshake()).To(MatchError(bolt.ErrNoCompatibleVersion))
+			})
+
+			It("should complete a handshake between client and server roles", func() {
+				serverBolt := bolt.NewConnection(serverConn)
+				done := make(chan error, 1)
+				go func() {
+					done <- serverBolt.Handshake()
+				}()
+
+				Expect(boltConn.ClientHandshake()).To(Succeed())
+				Eventually(done).Should(Receive(BeNil()))
+				Expect(boltConn.GetVersion()).To(Equal(bolt.Version{Major: 5, Minor: 8}))
+				Expect(serverBolt.GetVersion()).To(Equal(boltConn.GetVersion()))
+			})
+
 			It("should reject invalid magic preamble", func() {
 				go func() {
 					defer GinkgoRecover()
@@ -112,12 +199,16 @@ var _ = Describe("Bolt Protocol", func() {
 				go func() {
 					defer GinkgoRecover()
 					
-					// Send a simple message
-					chunkSize := uint16(1)
-					err := binary.Write(serverConn, binary.BigEndian, chunkSize)
+					// Send INIT("agent/1.0", {}) as a tiny structure
+					payload := []byte{0xB2, bolt.MsgInit, 0x89, 'a', 'g', 'e', 'n', 't', '/', '1', '.', '0', 0xA0}
+					err := binary.Write(serverConn, binary.BigEndian, uint16(len(payload)))
 					Expect(err).NotTo(HaveOccurred())
 					
-					err = binary.Write(serverConn, binary.BigEndian, byte(bolt.MsgInit))
+					_, err = serverConn.Write(payload)
+					Expect(err).NotTo(HaveOccurred())
+
+					// End-of-message marker
+					err = binary.Write(serverConn, binary.BigEndian, uint16(0))
 					Expect(err).NotTo(HaveOccurred())
 				}()
 
@@ -125,70 +216,107 @@ var _ = Describe("Bolt Protocol", func() {
 				Expect(err).NotTo(HaveOccurred())
 				Expect(msg).NotTo(BeNil())
 				Expect(msg.Signature).To(Equal(byte(bolt.MsgInit)))
+				Expect(msg.Fields).To(Equal([]interface{}{"agent/1.0", map[string]interface{}{}}))
 			})
 
 			It("should write messages correctly", func() {
 				msg := &bolt.Message{
 					Signature: bolt.MsgSuccess,
-					Fields:    []interface{}{},
+					Fields:    []interface{}{map[string]interface{}{"server": "Neo4j/5.0"}},
 				}
 
+				err := boltConn.WriteMessage(msg)
+				Expect(err).NotTo(HaveOccurred())
+
+				// Read chunk size
+				var chunkSize uint16
+				err = binary.Read(serverConn, binary.BigEndian, &chunkSize)
+				Expect(err).NotTo(HaveOccurred())
+
+				// Read and decode the message body
+				data := make([]byte, chunkSize)
+				_, err = io.ReadFull(serverConn, data)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(data[:2]).To(Equal([]byte{0xB1, bolt.MsgSuccess}))
+
+				decoded, err := bolt.DecodeMessage(data)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(decoded).To(Equal(msg))
+
+				// End-of-message marker
+				err = binary.Read(serverConn, binary.BigEndian, &chunkSize)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(chunkSize).To(Equal(uint16(0)))
+			})
+
+			It("should skip NOOP chunks between messages", func() {
 				go func() {
 					defer GinkgoRecover()
 					
-					// Read chunk size
-					var chunkSize uint16
-					err := binary.Read(serverConn, binary.BigEndian, &chunkSize)
+					// Two NOOP chunks followed by RESET
+					_, err := serverConn.Write([]byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xB0, bolt.MsgReset, 0x00, 0x00})
 					Expect(err).NotTo(HaveOccurred())
-					Expect(chunkSize).To(Equal(uint16(1)))
-					
-					// Read message signature
-					var signature byte
-					err = binary.Read(serverConn, binary.BigEndian, &signature)
-					Expect(err).NotTo(HaveOccurred())
-					Expect(signature).To(Equal(byte(bolt.MsgSuccess)))
 				}()
 
-				err := boltConn.WriteMessage(msg)
+				msg, err := boltConn.ReadMessage()
 				Expect(err).NotTo(HaveOccurred())
+				Expect(msg.Signature).To(Equal(bolt.MsgReset))
 			})
 
-			It("should handle empty chunks", func() {
+			It("should reassemble messages split over several chunks", func() {
 				go func() {
 					defer GinkgoRecover()
 					
-					// Send zero chunk size
-					err := binary.Write(serverConn, binary.BigEndian, uint16(0))
+					// RUN("RETURN 1", {}, {}) split at arbitrary points
+					payload := []byte{0xB3, bolt.MsgRun, 0x88, 'R', 'E', 'T', 'U', 'R', 'N', ' ', '1', 0xA0, 0xA0}
+					var buf bytes.Buffer
+					for _, part := range [][]byte{payload[:1], payload[1:5], payload[5:]} {
+						binary.Write(&buf, binary.BigEndian, uint16(len(part)))
+						buf.Write(part)
+					}
+					buf.Write([]byte{0x00, 0x00})
+					_, err := serverConn.Write(buf.Bytes())
 					Expect(err).NotTo(HaveOccurred())
 				}()
 
-				_, err := boltConn.ReadMessage()
-				Expect(err).To(HaveOccurred())
-				Expect(err.Error()).To(ContainSubstring("empty chunk"))
+				msg, err := boltConn.ReadMessage()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(msg.Signature).To(Equal(bolt.MsgRun))
+				Expect(msg.Fields[0]).To(Equal("RETURN 1"))
 			})
-		})
 
-		Context("when extracting tenant information", func() {
-			It("should extract tenant from INIT message", func() {
+			It("should split large messages at the chunk size limit", func() {
+				query := strings.Repeat("x", 2*bolt.MaxChunkSize)
 				msg := &bolt.Message{
-					Signature: bolt.MsgInit,
-					Fields:    []interface{}{},
+					Signature: bolt.MsgRun,
+					Fields:    []interface{}{query, map[string]interface{}{}, map[string]interface{}{}},
 				}
 
-				tenantID, err := boltConn.ExtractTenantID(msg)
-				Expect(err).NotTo(HaveOccurred())
-				Expect(tenantID).To(Equal("tenant1")) // Default behavior
+				serverBolt := bolt.NewConnection(serverConn)
+				received := make(chan *bolt.Message, 1)
+				go func() {
+					defer GinkgoRecover()
+					
+					msg, err := serverBolt.ReadMessage()
+					Expect(err).NotTo(HaveOccurred())
+					received <- msg
+				}()
+
+				Expect(boltConn.WriteMessage(msg)).To(Succeed())
+				Eventually(received).Should(Receive(Equal(msg)))
 			})
 
-			It("should handle non-INIT messages", func() {
-				msg := &bolt.Message{
-					Signature: bolt.MsgRun,
-					Fields:    []interface{}{},
-				}
+			It("should fail when the stream ends mid-message", func() {
+				go func() {
+					defer GinkgoRecover()
+					
+					_, err := serverConn.Write([]byte{0x00, 0x02, 0xB0, bolt.MsgReset})
+					Expect(err).NotTo(HaveOccurred())
+					serverConn.Close()
+				}()
 
-				_, err := boltConn.ExtractTenantID(msg)
-				Expect(err).To(HaveOccurred())
-				Expect(err.Error()).To(ContainSubstring("unable to determine tenant ID"))
+				_, err := boltConn.ReadMessage()
+				Expect(err).To(MatchError(io.ErrUnexpectedEOF))
 			})
 		})
 	})
@@ -0,0 +1,128 @@
+package test
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"neo4j-proxy/pkg/bolt"
+	"neo4j-proxy/pkg/boltstub"
+)
+
+var _ = Describe("Bolt Stub Server", func() {
+	// start runs a stub server playing script, closed after the spec
+	start := func(script *boltstub.Script, versions ...bolt.Version) *boltstub.Server {
+		server, err := boltstub.NewServer(script, versions...)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(server.Close)
+		return server
+	}
+
+	It("should play a scripted conversation", func() {
+		server := start(boltstub.NewScript().
+			Expect(bolt.MsgHello).Success(boltstub.Metadata{"server": "Neo4j/5.26.0"}).
+			Expect(bolt.MsgLogon, boltstub.Principal("alice"), boltstub.Credentials("secret")).Success(nil).
+			Expect(bolt.MsgRun, boltstub.Query("RETURN $n AS n"), boltstub.Param("n", int64(7)), boltstub.Database("neo4j")).
+			Success(boltstub.Fields("n")).
+			Expect(bolt.MsgPull).Record(int64(7)).Record(int64(8)).Success(boltstub.Metadata{"bookmark": "bm1"}).
+			Expect(bolt.MsgGoodbye))
+
+		client, err := bolt.Dial(context.Background(), server.Addr(), bolt.ClientConfig{Auth: bolt.BasicAuth("alice", "secret")})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.ServerInfo()).To(HaveKeyWithValue("server", "Neo4j/5.26.0"))
+
+		result, err := client.Run(context.Background(), "RETURN $n AS n", map[string]interface{}{"n": int64(7)}, bolt.TxExtra{"db": "neo4j"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Keys).To(Equal([]string{"n"}))
+		Expect(result.Records).To(Equal([][]interface{}{{int64(7)}, {int64(8)}}))
+		Expect(result.Summary).To(HaveKeyWithValue("bookmark", "bm1"))
+		Expect(client.Close()).To(Succeed())
+
+		Eventually(server.Completed).Should(Equal(1))
+		Consistently(server.Err).Should(Succeed())
+	})
+
+	It("should fail on demand and answer auto requests out of order", func() {
+		server := start(boltstub.NewScript().
+			AutoSuccess(bolt.MsgReset).
+			Expect(bolt.MsgHello).Success(nil).
+			Expect(bolt.MsgRun, boltstub.QueryMatching(`^CREATE`)).Failure("Neo.ClientError.Schema.ConstraintValidationFailed", "exists").
+			Expect(bolt.MsgPull).Ignored(),
+			bolt.Version{Major: 4, Minor: 4})
+
+		client, err := bolt.Dial(context.Background(), server.Addr(), bolt.ClientConfig{})
+		Expect(err).NotTo(HaveOccurred())
+		defer client.Close()
+		Expect(client.Version()).To(Equal(bolt.Version{Major: 4, Minor: 4}))
+
+		_, err = client.Run(context.Background(), "CREATE (n)", nil, nil)
+		var serverErr *bolt.ServerError
+		Expect(errors.As(err, &serverErr)).To(BeTrue())
+		Expect(serverErr.Code).To(Equal("Neo.ClientError.Schema.ConstraintValidationFailed"))
+		Expect(client.Reset(context.Background())).To(Succeed())
+
+		Eventually(server.Completed).Should(Equal(1))
+		Expect(server.Err()).NotTo(HaveOccurred())
+	})
+
+	It("should reject and report requests that break the script", func() {
+		server := start(boltstub.NewScript().
+			Expect(bolt.MsgHello).Success(nil).
+			Expect(bolt.MsgRun, boltstub.Query("RETURN 1")).Success(boltstub.Fields("1")).
+			Expect(bolt.MsgPull).Record(int64(1)).Success(nil),
+			bolt.Version{Major: 5, Minor: 0})
+
+		client, err := bolt.Dial(context.Background(), server.Addr(), bolt.ClientConfig{})
+		Expect(err).NotTo(HaveOccurred())
+		defer client.Close()
+
+		_, err = client.Run(context.Background(), "RETURN 2", nil, nil)
+		Expect(err).To(HaveOccurred())
+
+		Eventually(server.Err).Should(MatchError(ContainSubstring(`expected query "RETURN 1", got "RETURN 2"`)))
+		Expect(server.Completed()).To(Equal(0))
+	})
+
+	It("should report connections closed before the script ends", func() {
+		server := start(boltstub.NewScript().
+			Expect(bolt.MsgHello).Success(nil).
+			Expect(bolt.MsgRun),
+			bolt.Version{Major: 5, Minor: 0})
+
+		client, err := bolt.Dial(context.Background(), server.Addr(), bolt.ClientConfig{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.Close()).To(Succeed())
+
+		Eventually(server.Err).Should(MatchError(ContainSubstring("expected RUN")))
+	})
+
+	It("should hang up where the script says so", func() {
+		server := start(boltstub.NewScript().
+			Expect(bolt.MsgHello).Success(nil).
+			Expect(bolt.MsgRun).HangUp(),
+			bolt.Version{Major: 5, Minor: 0})
+
+		client, err := bolt.Dial(context.Background(), server.Addr(), bolt.ClientConfig{})
+		Expect(err).NotTo(HaveOccurred())
+		defer client.Close()
+
+		_, err = client.Run(context.Background(), "RETURN 1", nil, nil)
+		Expect(err).To(HaveOccurred())
+		Eventually(server.Completed).Should(Equal(1))
+		Expect(server.Err()).NotTo(HaveOccurred())
+	})
+
+	It("should refuse scripts that reply before any expectation", func() {
+		for _, script := range []*boltstub.Script{
+			boltstub.NewScript().Success(nil).Expect(bolt.MsgHello),
+			boltstub.NewScript().Record(int64(1)),
+			boltstub.NewScript().Failure("Neo.ClientError.Request.Invalid", "bad"),
+			boltstub.NewScript().HangUp(),
+		} {
+			_, err := boltstub.NewServer(script)
+			Expect(err).To(MatchError(ContainSubstring("before any Expect")))
+		}
+	})
+})
@@ -0,0 +1,217 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"neo4j-proxy/pkg/bolt"
+)
+
+var _ = Describe("Bolt Client", func() {
+	var (
+		listener net.Listener
+		received chan *bolt.Message
+	)
+
+	// serve accepts one connection at version v and answers each request
+	// with the responses answer returns
+	serve := func(v bolt.Version, answer func(*bolt.Message) []*bolt.Message) {
+		var err error
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(listener.Close)
+		requests := make(chan *bolt.Message, 20)
+		received = requests
+
+		go func() {
+			defer GinkgoRecover()
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			server := bolt.NewConnection(conn)
+			server.SetSupportedVersions([]bolt.Version{v})
+			if server.Handshake() != nil {
+				return
+			}
+			for {
+				msg, err := server.ReadMessage()
+				if err != nil {
+					return
+				}
+				requests <- msg
+				for _, response := range answer(msg) {
+					if server.WriteMessage(response) != nil {
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	success := func(metadata map[string]interface{}) *bolt.Message {
+		return &bolt.Message{Signature: bolt.MsgSuccess, Fields: []interface{}{metadata}}
+	}
+	failure := func(code string) *bolt.Message {
+		return &bolt.Message{Signature: bolt.MsgFailure, Fields: []interface{}{map[string]interface{}{"code": code, "message": "failed"}}}
+	}
+
+	// database answers queries with one record, failing those of "FAIL"
+	database := func(msg *bolt.Message) []*bolt.Message {
+		switch msg.Signature {
+		case bolt.MsgHello:
+			return []*bolt.Message{success(map[string]interface{}{"server": "Neo4j/5.26.0", "connection_id": "bolt-1"})}
+		case bolt.MsgRun:
+			if msg.Fields[0] == "FAIL" {
+				return []*bolt.Message{failure("Neo.ClientError.Statement.SyntaxError")}
+			}
+			return []*bolt.Message{success(map[string]interface{}{"fields": []interface{}{"n"}})}
+		case bolt.MsgPull:
+			return []*bolt.Message{
+				{Signature: bolt.MsgRecord, Fields: []interface{}{[]interface{}{int64(42)}}},
+				success(map[string]interface{}{"bookmark": "bm1"}),
+			}
+		case bolt.MsgRoute:
+			return []*bolt.Message{success(map[string]interface{}{"rt": map[string]interface{}{"ttl": int64(300)}})}
+		case bolt.MsgGoodbye:
+			return nil
+		}
+		return []*bolt.Message{success(map[string]interface{}{})}
+	}
+
+	// next returns the next request the server received
+	next := func() *bolt.Message {
+		var msg *bolt.Message
+		Eventually(received).Should(Receive(&msg))
+		return msg
+	}
+
+	It("should authenticate with LOGON from Bolt 5.1 and run queries", func() {
+		serve(bolt.Version{Major: 5, Minor: 8}, database)
+		client, err := bolt.Dial(context.Background(), listener.Addr().String(), bolt.ClientConfig{Auth: bolt.BasicAuth("neo4j", "secret")})
+		Expect(err).NotTo(HaveOccurred())
+		defer client.Close()
+
+		Expect(client.Version()).To(Equal(bolt.Version{Major: 5, Minor: 8}))
+		Expect(client.ServerInfo()).To(HaveKeyWithValue("server", "Neo4j/5.26.0"))
+		hello := next()
+		Expect(hello.Signature).To(Equal(bolt.MsgHello))
+		Expect(hello.Fields[0]).To(HaveKeyWithValue("user_agent", bolt.DefaultUserAgent))
+		Expect(hello.Fields[0]).NotTo(HaveKey("credentials"))
+		logon := next()
+		Expect(logon.Signature).To(Equal(bolt.MsgLogon))
+		Expect(logon.Fields[0]).To(HaveKeyWithValue("credentials", "secret"))
+
+		result, err := client.Run(context.Background(), "RETURN $n AS n", map[string]interface{}{"n": int64(42)}, bolt.TxExtra{"db": "neo4j"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Keys).To(Equal([]string{"n"}))
+		Expect(result.Records).To(Equal([][]interface{}{{int64(42)}}))
+		Expect(result.Summary).To(HaveKeyWithValue("bookmark", "bm1"))
+
+		run := next()
+		Expect(run.Fields[1]).To(HaveKeyWithValue("n", int64(42)))
+		Expect(run.Fields[2]).To(HaveKeyWithValue("db", "neo4j"))
+		Expect(next().Fields[0]).To(HaveKeyWithValue("n", int64(-1)))
+	})
+
+	It("should authenticate in HELLO and ask for the utc patch on Bolt 4.4", func() {
+		serve(bolt.Version{Major: 4, Minor: 4}, database)
+		client, err := bolt.Dial(context.Background(), listener.Addr().String(), bolt.ClientConfig{Auth: bolt.BasicAuth("neo4j", "secret")})
+		Expect(err).NotTo(HaveOccurred())
+		defer client.Close()
+
+		hello := next()
+		Expect(hello.Fields[0]).To(HaveKeyWithValue("credentials", "secret"))
+		Expect(hello.Fields[0]).To(HaveKeyWithValue("patch_bolt", []interface{}{"utc"}))
+
+		rt, err := client.Route(context.Background(), map[string]interface{}{"address": "proxy:7687"}, nil, "neo4j")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rt).To(HaveKeyWithValue("ttl", int64(300)))
+	})
+
+	It("should reset after a FAILURE and stay usable", func() {
+		serve(bolt.Version{Major: 5, Minor: 0}, database)
+		client, err := bolt.Dial(context.Background(), listener.Addr().String(), bolt.ClientConfig{})
+		Expect(err).NotTo(HaveOccurred())
+		defer client.Close()
+		Expect(next().Fields[0]).To(HaveKeyWithValue("scheme", "none"))
+
+		_, err = client.Run(context.Background(), "FAIL", nil, nil)
+		var serverErr *bolt.ServerError
+		Expect(errors.As(err, &serverErr)).To(BeTrue())
+		Expect(serverErr.Code).To(Equal("Neo.ClientError.Statement.SyntaxError"))
+		Expect(next().Signature).To(Equal(bolt.MsgRun))
+		Expect(next().Signature).To(Equal(bolt.MsgPull))
+		Expect(next().Signature).To(Equal(bolt.MsgReset))
+
+		result, err := client.Run(context.Background(), "RETURN 1", nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Records).To(HaveLen(1))
+	})
+
+	It("should report a rejected authentication", func() {
+		serve(bolt.Version{Major: 5, Minor: 8}, func(msg *bolt.Message) []*bolt.Message {
+			if msg.Signature == bolt.MsgLogon {
+				return []*bolt.Message{failure("Neo.ClientError.Security.Unauthorized")}
+			}
+			return database(msg)
+		})
+		_, err := bolt.Dial(context.Background(), listener.Addr().String(), bolt.ClientConfig{Auth: bolt.BasicAuth("neo4j", "wrong")})
+		var serverErr *bolt.ServerError
+		Expect(errors.As(err, &serverErr)).To(BeTrue())
+		Expect(serverErr.Code).To(Equal("Neo.ClientError.Security.Unauthorized"))
+	})
+
+	It("should give up on a request when the context ends", func() {
+		serve(bolt.Version{Major: 5, Minor: 8}, func(msg *bolt.Message) []*bolt.Message {
+			if msg.Signature == bolt.MsgRun {
+				return nil // never answers
+			}
+			return database(msg)
+		})
+		client, err := bolt.Dial(context.Background(), listener.Addr().String(), bolt.ClientConfig{})
+		Expect(err).NotTo(HaveOccurred())
+		defer client.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		_, err = client.Run(ctx, "RETURN 1", nil, nil)
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+
+		_, err = client.Run(context.Background(), "RETURN 1", nil, nil)
+		Expect(err).To(MatchError(ContainSubstring("unusable")))
+	})
+
+	It("should report the context's error even if its deadline passes first", func() {
+		serve(bolt.Version{Major: 5, Minor: 8}, func(msg *bolt.Message) []*bolt.Message {
+			if msg.Signature == bolt.MsgRun {
+				return nil // never answers
+			}
+			return database(msg)
+		})
+		client, err := bolt.Dial(context.Background(), listener.Addr().String(), bolt.ClientConfig{})
+		Expect(err).NotTo(HaveOccurred())
+		defer client.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		_, err = client.Run(earlyDeadline{ctx}, "RETURN 1", nil, nil)
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+	})
+})
+
+// earlyDeadline reports a deadline that passes well before the context
+// ends, as a deadline copied to a socket may fire before the context is done
+type earlyDeadline struct {
+	context.Context
+}
+
+func (c earlyDeadline) Deadline() (time.Time, bool) {
+	return time.Now().Add(10 * time.Millisecond), true
+}
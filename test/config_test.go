@@ -75,6 +75,22 @@ var _ = Describe("Configuration Management", func() {
 				Expect(tenant.Username).To(Equal("testuser"))
 				Expect(tenant.Password).To(Equal("testpass"))
 			})
+
+			It("should load the supported Bolt versions", func() {
+				tmpFile, err := os.CreateTemp("", "config-*.json")
+				Expect(err).NotTo(HaveOccurred())
+				tempConfigFile = tmpFile.Name()
+
+				_, err = tmpFile.WriteString(`{"proxy_port": 7687, "bolt_versions": ["5.4", "4.4"]}`)
+				Expect(err).NotTo(HaveOccurred())
+				tmpFile.Close()
+
+				os.Setenv("CONFIG_FILE", tempConfigFile)
+
+				cfg, err := config.Load()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(cfg.BoltVersions).To(Equal([]string{"5.4", "4.4"}))
+			})
 		})
 
 		Context("when config file does not exist", func() {
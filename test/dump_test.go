@@ -0,0 +1,247 @@
+package test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"neo4j-proxy/pkg/bolt"
+	"neo4j-proxy/pkg/dump"
+)
+
+var _ = Describe("Wire Dump", func() {
+	v58 := bolt.Version{Major: 5, Minor: 8}
+
+	// chunkedMsg returns the wire bytes of a typed message at version v
+	chunkedMsg := func(m bolt.TypedMessage, v bolt.Version) []byte {
+		msg, err := m.Encode(v)
+		Expect(err).NotTo(HaveOccurred())
+		var buf bytes.Buffer
+		Expect(bolt.NewFrameWriter(&buf).WriteMessage(msg)).To(Succeed())
+		return buf.Bytes()
+	}
+
+	// manifestConversation returns the bytes of a client and server that
+	// negotiate Bolt 5.8 through the manifest and log on
+	manifestConversation := func() ([]byte, []byte) {
+		client := binary.BigEndian.AppendUint32(nil, bolt.BoltMagicPreamble)
+		for _, p := range []uint32{bolt.ManifestV1, 0x00080805, 0x00020404, 0} {
+			client = binary.BigEndian.AppendUint32(client, p)
+		}
+		client = binary.BigEndian.AppendUint32(client, v58.Encode())
+		client = append(client, 0)
+		client = append(client, chunkedMsg(&bolt.Hello{UserAgent: "test/1.0", Extra: map[string]interface{}{}}, v58)...)
+		client = append(client, 0, 0) // NOOP
+		client = append(client, chunkedMsg(&bolt.Logon{Auth: bolt.AuthToken{"scheme": "basic", "principal": "tenant1@alice", "credentials": "secret"}}, v58)...)
+
+		server := binary.BigEndian.AppendUint32(nil, bolt.ManifestV1)
+		server = append(server, 2)
+		server = binary.BigEndian.AppendUint32(server, 0x00080805)
+		server = binary.BigEndian.AppendUint32(server, 0x00000404)
+		server = append(server, 0)
+		server = append(server, chunkedMsg(&bolt.Success{Metadata: map[string]interface{}{"server": "Neo4j/5.26"}}, v58)...)
+		server = append(server, chunkedMsg(&bolt.Failure{Code: "Neo.ClientError.Security.Unauthorized", Message: "bad credentials"}, v58)...)
+		return client, server
+	}
+
+	It("should decode a manifest handshake, chunks and messages from raw captures", func() {
+		client, server := manifestConversation()
+		events := dump.Decode(&dump.Conn{
+			ClientData: []dump.Segment{{Data: client}},
+			ServerData: []dump.Segment{{Data: server}},
+		}, dump.Options{})
+
+		var types []string
+		for _, e := range events {
+			Expect(e.Error).To(BeEmpty())
+			types = append(types, e.Direction+":"+e.Type)
+		}
+		Expect(types).To(Equal([]string{
+			"client:HANDSHAKE", "server:HANDSHAKE", "client:HANDSHAKE",
+			"client:HELLO", "client:NOOP", "client:LOGON",
+			"server:SUCCESS", "server:FAILURE",
+		}))
+
+		Expect(events[0].Handshake.Proposals).To(Equal([]string{"manifest/v1", "5.0-5.8", "4.2-4.4"}))
+		Expect(events[1].Handshake.Offers).To(Equal([]string{"5.0-5.8", "4.4"}))
+		Expect(events[2].Handshake.Version).To(Equal("5.8"))
+		Expect(events[3].Offset).To(Equal(25))
+		Expect(events[3].Chunks).To(HaveLen(1))
+		Expect(events[3].Message.(*bolt.Hello).UserAgent).To(Equal("test/1.0"))
+
+		logon := events[5].Message.(*bolt.Logon)
+		Expect(logon.Auth.Principal()).To(Equal("tenant1@alice"))
+		Expect(logon.Auth.Credentials()).NotTo(Equal("secret"))
+		Expect(events[7].Message.(*bolt.Failure).Code).To(Equal("Neo.ClientError.Security.Unauthorized"))
+	})
+
+	It("should show credentials only when asked", func() {
+		client, _ := manifestConversation()
+		events := dump.Filter(dump.Decode(&dump.Conn{ClientData: []dump.Segment{{Data: client}}},
+			dump.Options{ShowCredentials: true}), []string{"logon"})
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].Message.(*bolt.Logon).Auth.Credentials()).To(Equal("secret"))
+	})
+
+	It("should redact credentials in the raw fields of auth messages it cannot parse", func() {
+		// The user agent of INIT must be a string
+		auth := map[string]interface{}{"scheme": "basic", "principal": "tenant1@alice", "credentials": "secret"}
+		init := &bolt.Message{Signature: bolt.MsgInit, Fields: []interface{}{int64(1), auth}}
+		var buf bytes.Buffer
+		Expect(bolt.NewFrameWriter(&buf).WriteMessage(init)).To(Succeed())
+
+		events := dump.Decode(&dump.Conn{ClientData: []dump.Segment{{Data: buf.Bytes()}}}, dump.Options{Version: bolt.Version{Major: 1}})
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].Error).NotTo(BeEmpty())
+		Expect(events[0].Fields[1]).To(HaveKeyWithValue("principal", "tenant1@alice"))
+		out, err := json.Marshal(events)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(out)).NotTo(ContainSubstring("secret"))
+		Expect(auth).To(HaveKeyWithValue("credentials", "secret"))
+	})
+
+	It("should report chunk boundaries of messages split across chunks", func() {
+		msg, err := (&bolt.Run{Query: strings.Repeat("x", bolt.MaxChunkSize+10), Parameters: map[string]interface{}{}}).Encode(v58)
+		Expect(err).NotTo(HaveOccurred())
+		var buf bytes.Buffer
+		Expect(bolt.NewFrameWriter(&buf).WriteMessage(msg)).To(Succeed())
+
+		events := dump.Decode(&dump.Conn{ClientData: []dump.Segment{{Data: buf.Bytes()}}}, dump.Options{Version: v58})
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].Type).To(Equal("RUN"))
+		Expect(events[0].Chunks).To(HaveLen(2))
+		Expect(events[0].Chunks[0]).To(Equal(bolt.MaxChunkSize))
+	})
+
+	It("should report a capture that ends inside a message", func() {
+		data := chunkedMsg(&bolt.Reset{}, v58)
+		events := dump.Decode(&dump.Conn{ClientData: []dump.Segment{{Data: append(data, 0x00, 0x05, 0xB1)}}}, dump.Options{Version: v58})
+		Expect(events).To(HaveLen(2))
+		Expect(events[0].Type).To(Equal("RESET"))
+		Expect(events[1].Kind).To(Equal(dump.KindError))
+		Expect(events[1].Offset).To(Equal(len(data)))
+	})
+
+	It("should name messages by version", func() {
+		Expect(bolt.MessageName(bolt.MsgHello, bolt.Version{Major: 1})).To(Equal("INIT"))
+		Expect(bolt.MessageName(bolt.MsgPull, bolt.Version{Major: 3})).To(Equal("PULL_ALL"))
+		Expect(bolt.MessageName(bolt.MsgPull, v58)).To(Equal("PULL"))
+		Expect(bolt.MessageName(0x99, v58)).To(Equal("0x99"))
+	})
+
+	It("should filter events by type and write them as text and JSON", func() {
+		client, server := manifestConversation()
+		events := dump.Decode(&dump.Conn{
+			ClientData: []dump.Segment{{Data: client}},
+			ServerData: []dump.Segment{{Data: server}},
+		}, dump.Options{})
+		events = dump.Filter(events, []string{"hello", " FAILURE"})
+		Expect(events).To(HaveLen(2))
+
+		var text bytes.Buffer
+		Expect(dump.WriteText(&text, events)).To(Succeed())
+		Expect(text.String()).To(ContainSubstring("C> @25     HELLO chunks=["))
+		Expect(text.String()).To(ContainSubstring("UserAgent:test/1.0"))
+
+		var out bytes.Buffer
+		Expect(dump.WriteJSON(&out, events)).To(Succeed())
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		Expect(lines).To(HaveLen(2))
+		var decoded map[string]interface{}
+		Expect(json.Unmarshal([]byte(lines[1]), &decoded)).To(Succeed())
+		Expect(decoded["type"]).To(Equal("FAILURE"))
+		Expect(decoded["direction"]).To(Equal("server"))
+		Expect(decoded["message"]).To(HaveKeyWithValue("Code", "Neo.ClientError.Security.Unauthorized"))
+	})
+
+	Describe("pcap captures", func() {
+		type packet struct {
+			fromClient bool
+			flags      byte
+			seq        uint32
+			payload    []byte
+		}
+
+		// pcapFile builds an Ethernet pcap of a connection between
+		// 10.0.0.1:50000 and 10.0.0.2:7687
+		pcapFile := func(packets []packet) []byte {
+			var buf bytes.Buffer
+			binary.Write(&buf, binary.LittleEndian, []uint32{0xA1B2C3D4, 0x00040002, 0, 0, 65535, 1})
+			start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+			for i, p := range packets {
+				src, dst := []byte{10, 0, 0, 1}, []byte{10, 0, 0, 2}
+				srcPort, dstPort := uint16(50000), uint16(7687)
+				if !p.fromClient {
+					src, dst, srcPort, dstPort = dst, src, dstPort, srcPort
+				}
+
+				tcp := binary.BigEndian.AppendUint16(nil, srcPort)
+				tcp = binary.BigEndian.AppendUint16(tcp, dstPort)
+				tcp = binary.BigEndian.AppendUint32(tcp, p.seq)
+				tcp = binary.BigEndian.AppendUint32(tcp, 0)
+				tcp = append(tcp, 5<<4, p.flags, 0xFF, 0xFF, 0, 0, 0, 0)
+				tcp = append(tcp, p.payload...)
+
+				ip := []byte{0x45, 0, 0, 0, 0, 0, 0x40, 0, 64, 6, 0, 0}
+				binary.BigEndian.PutUint16(ip[2:], uint16(20+len(tcp)))
+				ip = append(append(append(ip, src...), dst...), tcp...)
+
+				frame := append(make([]byte, 12), 0x08, 0x00)
+				frame = append(frame, ip...)
+
+				ts := start.Add(time.Duration(i) * time.Millisecond)
+				binary.Write(&buf, binary.LittleEndian, []uint32{uint32(ts.Unix()), uint32(ts.Nanosecond() / 1000), uint32(len(frame)), uint32(len(frame))})
+				buf.Write(frame)
+			}
+			return buf.Bytes()
+		}
+
+		It("should reassemble TCP streams and interleave both directions", func() {
+			client, server := manifestConversation()
+			const clientISN, serverISN = 1000, 5000
+			split := 30 // inside the HELLO message
+			capture := pcapFile([]packet{
+				{fromClient: true, flags: 0x02, seq: clientISN},
+				{fromClient: false, flags: 0x12, seq: serverISN},
+				{fromClient: true, flags: 0x10, seq: clientISN + 1, payload: client[:20]},
+				{fromClient: false, flags: 0x18, seq: serverISN + 1, payload: server[:14]},
+				// Out of order, then the missing piece, then a retransmission
+				{fromClient: true, flags: 0x18, seq: clientISN + 1 + uint32(split), payload: client[split:]},
+				{fromClient: true, flags: 0x18, seq: clientISN + 1 + 20, payload: client[20:split]},
+				{fromClient: true, flags: 0x18, seq: clientISN + 1 + 20, payload: client[20:split]},
+				{fromClient: false, flags: 0x18, seq: serverISN + 1 + 14, payload: server[14:]},
+			})
+			Expect(dump.IsPcap(capture)).To(BeTrue())
+
+			conns, err := dump.ReadPcap(bytes.NewReader(capture))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(conns).To(HaveLen(1))
+			Expect(conns[0].Client).To(Equal("10.0.0.1:50000"))
+			Expect(conns[0].Server).To(Equal("10.0.0.2:7687"))
+			Expect(conns[0].HasHandshake()).To(BeTrue())
+
+			var types []string
+			for _, e := range dump.Decode(conns[0], dump.Options{}) {
+				Expect(e.Error).To(BeEmpty())
+				Expect(e.Conn).To(Equal("10.0.0.1:50000 > 10.0.0.2:7687"))
+				Expect(e.Time.IsZero()).To(BeFalse())
+				types = append(types, e.Direction+":"+e.Type)
+			}
+			Expect(types).To(Equal([]string{
+				"client:HANDSHAKE", "server:HANDSHAKE",
+				"client:HANDSHAKE", "client:HELLO", "client:NOOP", "client:LOGON",
+				"server:SUCCESS", "server:FAILURE",
+			}))
+		})
+
+		It("should reject pcapng captures", func() {
+			_, err := dump.ReadPcap(bytes.NewReader([]byte{0x0A, 0x0D, 0x0D, 0x0A, 0, 0, 0, 0, 0x4D, 0x3C, 0x2B, 0x1A, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}))
+			Expect(err).To(MatchError(ContainSubstring("pcapng")))
+		})
+	})
+})
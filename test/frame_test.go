@@ -0,0 +1,115 @@
+package test
+
+import (
+	"bytes"
+	"io"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"neo4j-proxy/pkg/bolt"
+)
+
+var _ = Describe("Frame Relay", func() {
+	// chunked returns the wire bytes of msg
+	chunked := func(msg *bolt.Message) []byte {
+		var buf bytes.Buffer
+		Expect(bolt.NewFrameWriter(&buf).WriteMessage(msg)).To(Succeed())
+		return buf.Bytes()
+	}
+
+	It("should relay frames byte for byte and peek their signatures", func() {
+		success := chunked(&bolt.Message{Signature: bolt.MsgSuccess, Fields: []interface{}{map[string]interface{}{"server": "Neo4j/5.8"}}})
+		failure := chunked(&bolt.Message{Signature: bolt.MsgFailure, Fields: []interface{}{map[string]interface{}{"code": "X"}}})
+		stream := append(append([]byte{}, success...), failure...)
+
+		reader := bolt.NewFrameReader(bytes.NewReader(stream))
+		var out bytes.Buffer
+		writer := bolt.NewFrameWriter(&out)
+
+		var signatures []byte
+		for {
+			frame, err := reader.ReadFrame()
+			if err == io.EOF {
+				break
+			}
+			Expect(err).NotTo(HaveOccurred())
+			signatures = append(signatures, frame.Signature)
+			Expect(writer.WriteFrame(frame)).To(Succeed())
+		}
+		Expect(signatures).To(Equal([]byte{bolt.MsgSuccess, bolt.MsgFailure}))
+		Expect(out.Bytes()).To(Equal(stream))
+	})
+
+	It("should return NOOP chunks as their own frames", func() {
+		record := chunked(&bolt.Message{Signature: bolt.MsgRecord, Fields: []interface{}{[]interface{}{int64(1)}}})
+		reader := bolt.NewFrameReader(bytes.NewReader(append([]byte{0x00, 0x00}, record...)))
+
+		frame, err := reader.ReadFrame()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(frame.IsNoop()).To(BeTrue())
+		Expect(frame.Signature).To(BeZero())
+
+		frame, err = reader.ReadFrame()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(frame.IsNoop()).To(BeFalse())
+		Expect(frame.Raw).To(Equal(record))
+	})
+
+	It("should keep multi-chunk messages intact and decode them on demand", func() {
+		big := make([]byte, bolt.MaxChunkSize+100)
+		msg := &bolt.Message{Signature: bolt.MsgRun, Fields: []interface{}{string(big), map[string]interface{}{}}}
+		data := chunked(msg)
+
+		frame, err := bolt.NewFrameReader(bytes.NewReader(data)).ReadFrame()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(frame.Raw).To(Equal(data))
+		Expect(frame.Signature).To(Equal(byte(bolt.MsgRun)))
+
+		decoded, err := frame.Message()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(decoded.Fields[0]).To(Equal(string(big)))
+	})
+
+	It("should peek signatures split across chunks", func() {
+		// A tiny struct marker alone in the first chunk, the signature in the second
+		stream := []byte{0x00, 0x01, 0xB0, 0x00, 0x01, bolt.MsgReset, 0x00, 0x00}
+		frame, err := bolt.NewFrameReader(bytes.NewReader(stream)).ReadFrame()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(frame.Signature).To(Equal(byte(bolt.MsgReset)))
+		Expect(frame.Payload()).To(Equal([]byte{0xB0, bolt.MsgReset}))
+	})
+
+	It("should lay out written messages for the negotiated version", func() {
+		dt := &bolt.DateTime{Seconds: 1700000000, OffsetSeconds: 3600}
+		msg := &bolt.Message{Signature: bolt.MsgRecord, Fields: []interface{}{[]interface{}{dt}}}
+		tag := func(v bolt.Version, utc bool) byte {
+			var buf bytes.Buffer
+			writer := bolt.NewFrameWriter(&buf)
+			writer.SetVersion(v)
+			writer.SetUTCPatch(utc)
+			Expect(writer.WriteMessage(msg)).To(Succeed())
+			frame, err := bolt.NewFrameReader(&buf).ReadFrame()
+			Expect(err).NotTo(HaveOccurred())
+			decoded, err := frame.Message()
+			Expect(err).NotTo(HaveOccurred())
+			return decoded.Fields[0].([]interface{})[0].(*bolt.Structure).Tag
+		}
+
+		v44 := bolt.Version{Major: 4, Minor: 4}
+		Expect(tag(v44, false)).To(Equal(bolt.TagLegacyDateTime))
+		Expect(tag(v44, true)).To(Equal(bolt.TagDateTime))
+		Expect(tag(bolt.Version{Major: 5}, false)).To(Equal(bolt.TagDateTime))
+	})
+
+	It("should fail on truncated frames and non-structure messages", func() {
+		_, err := bolt.NewFrameReader(bytes.NewReader([]byte{0x00, 0x02, 0xB0})).ReadFrame()
+		Expect(err).To(Equal(io.ErrUnexpectedEOF))
+
+		_, err = bolt.NewFrameReader(bytes.NewReader([]byte{0x00, 0x01, 0xB0})).ReadFrame()
+		Expect(err).To(Equal(io.ErrUnexpectedEOF))
+
+		_, err = bolt.NewFrameReader(bytes.NewReader([]byte{0x00, 0x01, 0x01, 0x00, 0x00})).ReadFrame()
+		Expect(err).To(HaveOccurred())
+	})
+})
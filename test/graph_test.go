@@ -0,0 +1,138 @@
+package test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"neo4j-proxy/pkg/bolt"
+)
+
+var _ = Describe("Graph Values", func() {
+	var (
+		v44 = bolt.Version{Major: 4, Minor: 4}
+		v5  = bolt.Version{Major: 5, Minor: 0}
+	)
+
+	// reencode encodes a value for version v and decodes it back into typed values
+	reencode := func(value interface{}, v bolt.Version) interface{} {
+		enc := bolt.NewEncoder()
+		enc.SetVersion(v)
+		Expect(enc.Encode(value)).To(Succeed())
+		raw, err := bolt.Unmarshal(enc.Bytes())
+		Expect(err).NotTo(HaveOccurred())
+		decoded, err := bolt.DecodeValue(raw, v)
+		Expect(err).NotTo(HaveOccurred())
+		return decoded
+	}
+
+	Describe("Nodes", func() {
+		It("should decode the Bolt 4 layout", func() {
+			raw := &bolt.Structure{Tag: bolt.TagNode, Fields: []interface{}{
+				int64(7), []interface{}{"Person"}, map[string]interface{}{"name": "Alice"},
+			}}
+			decoded, err := bolt.DecodeValue(raw, v44)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(decoded).To(Equal(&bolt.Node{
+				ID: 7, Labels: []string{"Person"}, Properties: map[string]interface{}{"name": "Alice"},
+			}))
+		})
+
+		It("should decode the Bolt 5 element id", func() {
+			raw := &bolt.Structure{Tag: bolt.TagNode, Fields: []interface{}{
+				int64(7), []interface{}{}, map[string]interface{}{}, "4:abc:7",
+			}}
+			decoded, err := bolt.DecodeValue(raw, v5)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(decoded.(*bolt.Node).ElementID).To(Equal("4:abc:7"))
+		})
+
+		It("should reject layouts that do not match the version", func() {
+			raw := &bolt.Structure{Tag: bolt.TagNode, Fields: []interface{}{
+				int64(7), []interface{}{}, map[string]interface{}{},
+			}}
+			_, err := bolt.DecodeValue(raw, v5)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("must have 4 fields"))
+		})
+
+		It("should round-trip in both layouts", func() {
+			node := &bolt.Node{ID: 1, Labels: []string{"A", "B"}, Properties: map[string]interface{}{"x": int64(1)}, ElementID: "4:db:1"}
+			Expect(reencode(node, v5)).To(Equal(node))
+
+			legacy := &bolt.Node{ID: 1, Labels: []string{"A"}, Properties: map[string]interface{}{}}
+			Expect(reencode(legacy, v44)).To(Equal(legacy))
+		})
+
+		It("should derive element ids when upgrading a Bolt 4 node", func() {
+			legacy := &bolt.Node{ID: 42, Labels: []string{}, Properties: map[string]interface{}{}}
+			upgraded := reencode(legacy, v5).(*bolt.Node)
+			Expect(upgraded.ElementID).To(Equal("42"))
+		})
+	})
+
+	Describe("Relationships", func() {
+		It("should round-trip bound relationships with element ids", func() {
+			rel := &bolt.Relationship{
+				ID: 3, StartNodeID: 1, EndNodeID: 2, Type: "KNOWS",
+				Properties:         map[string]interface{}{"since": int64(2020)},
+				ElementID:          "5:db:3",
+				StartNodeElementID: "4:db:1",
+				EndNodeElementID:   "4:db:2",
+			}
+			Expect(reencode(rel, v5)).To(Equal(rel))
+
+			data, err := (&bolt.Relationship{Type: "KNOWS"}).Structure(v44, false)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(data.Fields).To(HaveLen(5))
+		})
+
+		It("should round-trip unbound relationships", func() {
+			rel := &bolt.UnboundRelationship{ID: 3, Type: "KNOWS", Properties: map[string]interface{}{}, ElementID: "5:db:3"}
+			Expect(reencode(rel, v5)).To(Equal(rel))
+		})
+	})
+
+	Describe("Paths", func() {
+		It("should decode nested nodes and relationships", func() {
+			path := &bolt.Path{
+				Nodes: []*bolt.Node{
+					{ID: 1, Labels: []string{"A"}, Properties: map[string]interface{}{}},
+					{ID: 2, Labels: []string{"B"}, Properties: map[string]interface{}{}},
+				},
+				Relationships: []*bolt.UnboundRelationship{
+					{ID: 9, Type: "TO", Properties: map[string]interface{}{}},
+				},
+				Indices: []int64{1, 1},
+			}
+			Expect(reencode(path, v44)).To(Equal(path))
+		})
+
+		It("should reject paths with foreign values", func() {
+			raw := &bolt.Structure{Tag: bolt.TagPath, Fields: []interface{}{
+				[]interface{}{"not a node"}, []interface{}{}, []interface{}{},
+			}}
+			_, err := bolt.DecodeValue(raw, v44)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("Records", func() {
+		It("should decode graph values inside RECORD fields and keep unknown structures", func() {
+			unknown := &bolt.Structure{Tag: 0x01, Fields: []interface{}{}}
+			values := []interface{}{
+				&bolt.Structure{Tag: bolt.TagNode, Fields: []interface{}{int64(1), []interface{}{}, map[string]interface{}{}}},
+				map[string]interface{}{"u": unknown},
+			}
+			decoded, err := bolt.DecodeValue(values, v44)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(decoded.([]interface{})[0]).To(BeAssignableToTypeOf(&bolt.Node{}))
+			Expect(decoded.([]interface{})[1]).To(Equal(map[string]interface{}{"u": unknown}))
+		})
+
+		It("should require a version to encode typed values", func() {
+			_, err := bolt.Marshal(&bolt.Node{})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("a Bolt version is required"))
+		})
+	})
+})
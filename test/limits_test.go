@@ -0,0 +1,142 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"neo4j-proxy/pkg/bolt"
+)
+
+var _ = Describe("Decoder Limits", func() {
+	limits := bolt.Limits{MaxMessageSize: 1024, MaxDepth: 4, MaxCollectionLength: 8, MaxStringLength: 16}
+
+	// limitOf returns the name of the limit err reports
+	limitOf := func(err error) string {
+		var limitErr *bolt.LimitError
+		if !errors.As(err, &limitErr) {
+			return ""
+		}
+		return limitErr.Limit
+	}
+
+	decode := func(v interface{}) error {
+		data, err := bolt.Marshal(v)
+		Expect(err).NotTo(HaveOccurred())
+		dec := bolt.NewDecoder(data)
+		dec.SetLimits(limits)
+		_, err = dec.Decode()
+		return err
+	}
+
+	nested := func(depth int) interface{} {
+		var v interface{} = int64(1)
+		for i := 0; i < depth; i++ {
+			v = []interface{}{v}
+		}
+		return v
+	}
+
+	It("should decode values within the limits", func() {
+		Expect(decode(map[string]interface{}{"a": nested(3), "b": strings.Repeat("x", 16), "c": []byte("0123456789abcdef")})).To(Succeed())
+	})
+
+	It("should reject values nested too deeply", func() {
+		Expect(decode(nested(4))).To(Succeed())
+		Expect(limitOf(decode(nested(5)))).To(Equal(bolt.LimitDepth))
+		Expect(limitOf(decode(&bolt.Structure{Tag: 'N', Fields: []interface{}{nested(4)}}))).To(Equal(bolt.LimitDepth))
+	})
+
+	It("should reject collections declaring too many entries before reading them", func() {
+		Expect(limitOf(decode(make([]interface{}, 9)))).To(Equal(bolt.LimitCollectionLength))
+
+		// A LIST_32 header claiming four billion items and no items
+		dec := bolt.NewDecoder([]byte{0xD6, 0xFF, 0xFF, 0xFF, 0xFF})
+		dec.SetLimits(limits)
+		_, err := dec.Decode()
+		Expect(err).To(MatchError(&bolt.LimitError{Limit: bolt.LimitCollectionLength, Max: 8, Size: 0xFFFFFFFF}))
+
+		m := map[string]interface{}{}
+		for _, k := range strings.Split("abcdefghi", "") {
+			m[k] = nil
+		}
+		Expect(limitOf(decode(m))).To(Equal(bolt.LimitCollectionLength))
+	})
+
+	It("should reject long strings and byte arrays", func() {
+		Expect(limitOf(decode(strings.Repeat("x", 17)))).To(Equal(bolt.LimitStringLength))
+		Expect(limitOf(decode(make([]byte, 17)))).To(Equal(bolt.LimitStringLength))
+	})
+
+	It("should leave the decoder unlimited by default", func() {
+		data, err := bolt.Marshal(nested(200))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = bolt.Unmarshal(data)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	Describe("messages", func() {
+		// chunked returns the wire bytes of a RUN with the given query
+		chunked := func(query string) []byte {
+			var buf bytes.Buffer
+			msg := &bolt.Message{Signature: bolt.MsgRun, Fields: []interface{}{query, map[string]interface{}{}, map[string]interface{}{}}}
+			Expect(bolt.NewFrameWriter(&buf).WriteMessage(msg)).To(Succeed())
+			return buf.Bytes()
+		}
+
+		It("should stop reading a message larger than the limit", func() {
+			client, server := net.Pipe()
+			defer client.Close()
+			defer server.Close()
+
+			conn := bolt.NewConnection(server)
+			conn.SetLimits(bolt.Limits{MaxMessageSize: 100})
+			// Only the chunk header is written; the limit applies before
+			// the data arrives
+			go client.Write([]byte{0xFF, 0xFF})
+
+			_, err := conn.ReadMessage()
+			Expect(err).To(MatchError(&bolt.LimitError{Limit: bolt.LimitMessageSize, Max: 100, Size: 0xFFFF}))
+		})
+
+		It("should apply the decoder limits to messages read from a connection", func() {
+			client, server := net.Pipe()
+			defer client.Close()
+			defer server.Close()
+
+			conn := bolt.NewConnection(server)
+			conn.SetLimits(limits)
+			go client.Write(chunked(strings.Repeat("x", 32)))
+
+			_, err := conn.ReadMessage()
+			Expect(limitOf(err)).To(Equal(bolt.LimitStringLength))
+		})
+
+		It("should bound frames and their decoding", func() {
+			reader := bolt.NewFrameReader(bytes.NewReader(append(chunked("RETURN 1"), chunked(strings.Repeat("x", 2000))...)))
+			reader.SetLimits(limits)
+
+			frame, err := reader.ReadFrame()
+			Expect(err).NotTo(HaveOccurred())
+			_, err = frame.Message()
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = reader.ReadFrame()
+			Expect(limitOf(err)).To(Equal(bolt.LimitMessageSize))
+		})
+
+		It("should decode frames within the reader's limits", func() {
+			reader := bolt.NewFrameReader(bytes.NewReader(chunked(strings.Repeat("x", 32))))
+			reader.SetLimits(limits)
+
+			frame, err := reader.ReadFrame()
+			Expect(err).NotTo(HaveOccurred())
+			_, err = frame.Message()
+			Expect(limitOf(err)).To(Equal(bolt.LimitStringLength))
+		})
+	})
+})
@@ -0,0 +1,201 @@
+package test
+
+import (
+	"io"
+	"net"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"neo4j-proxy/pkg/bolt"
+)
+
+var _ = Describe("Handshake Manifest", func() {
+	var (
+		serverConn, clientConn net.Conn
+		// A 5.7+ driver: manifest first, then 5.8-5.0, 4.4-4.2 and 3.0
+		driverHello = []byte{
+			0x60, 0x60, 0xB0, 0x17,
+			0x00, 0x00, 0x01, 0xFF,
+			0x00, 0x08, 0x08, 0x05,
+			0x00, 0x02, 0x04, 0x04,
+			0x00, 0x00, 0x00, 0x03,
+		}
+		// A server offering 5.8-5.0, 4.4-4.0 and 3.0 without capabilities
+		serverManifest = []byte{
+			0x00, 0x00, 0x01, 0xFF,
+			0x03,
+			0x00, 0x08, 0x08, 0x05,
+			0x00, 0x04, 0x04, 0x04,
+			0x00, 0x00, 0x00, 0x03,
+			0x00,
+		}
+	)
+
+	BeforeEach(func() {
+		var err error
+		serverConn, clientConn, err = createConnectedPair()
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(serverConn.Close)
+		DeferCleanup(clientConn.Close)
+	})
+
+	// readBytes reads exactly n bytes from conn
+	readBytes := func(conn net.Conn, n int) []byte {
+		buf := make([]byte, n)
+		_, err := io.ReadFull(conn, buf)
+		Expect(err).NotTo(HaveOccurred())
+		return buf
+	}
+
+	Describe("as a server", func() {
+		It("should offer a manifest and accept the client's confirmation", func() {
+			server := bolt.NewConnection(serverConn)
+			server.SetSupportedVersions([]bolt.Version{{Major: 5, Minor: 8}, {Major: 5, Minor: 7}, {Major: 4, Minor: 4}})
+			done := make(chan error, 1)
+			go func() { done <- server.Handshake() }()
+
+			_, err := clientConn.Write(driverHello)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(readBytes(clientConn, 14)).To(Equal([]byte{
+				0x00, 0x00, 0x01, 0xFF,
+				0x02,
+				0x00, 0x01, 0x08, 0x05,
+				0x00, 0x00, 0x04, 0x04,
+				0x00,
+			}))
+
+			// Confirm 5.7 with no capabilities
+			_, err = clientConn.Write([]byte{0x00, 0x00, 0x07, 0x05, 0x00})
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(done).Should(Receive(BeNil()))
+			Expect(server.GetVersion()).To(Equal(bolt.Version{Major: 5, Minor: 7}))
+		})
+
+		It("should reject a confirmation for a version it did not offer", func() {
+			server := bolt.NewConnection(serverConn)
+			server.SetSupportedVersions([]bolt.Version{{Major: 5, Minor: 8}})
+			done := make(chan error, 1)
+			go func() { done <- server.Handshake() }()
+
+			_, err := clientConn.Write(driverHello)
+			Expect(err).NotTo(HaveOccurred())
+			readBytes(clientConn, 10)
+			_, err = clientConn.Write([]byte{0x00, 0x00, 0x04, 0x04, 0x00})
+			Expect(err).NotTo(HaveOccurred())
+
+			var result error
+			Eventually(done).Should(Receive(&result))
+			Expect(result).To(MatchError(ContainSubstring("not offered")))
+		})
+
+		It("should fail when the client gives up", func() {
+			server := bolt.NewConnection(serverConn)
+			done := make(chan error, 1)
+			go func() { done <- server.Handshake() }()
+
+			_, err := clientConn.Write(driverHello)
+			Expect(err).NotTo(HaveOccurred())
+			readBytes(clientConn, 4)
+			_, err = clientConn.Write([]byte{0x00, 0x00, 0x00, 0x00, 0x00})
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(done).Should(Receive(MatchError(bolt.ErrNoCompatibleVersion)))
+		})
+
+		It("should answer plainly when a supported proposal comes before the manifest", func() {
+			server := bolt.NewConnection(serverConn)
+			done := make(chan error, 1)
+			go func() { done <- server.Handshake() }()
+
+			_, err := clientConn.Write([]byte{
+				0x60, 0x60, 0xB0, 0x17,
+				0x00, 0x00, 0x04, 0x04,
+				0x00, 0x00, 0x01, 0xFF,
+				0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x00,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(readBytes(clientConn, 4)).To(Equal([]byte{0x00, 0x00, 0x04, 0x04}))
+			Eventually(done).Should(Receive(BeNil()))
+		})
+	})
+
+	Describe("as a client", func() {
+		It("should lead with the manifest and confirm the newest common version", func() {
+			client := bolt.NewConnection(clientConn)
+			client.SetSupportedVersions([]bolt.Version{{Major: 5, Minor: 7}, {Major: 5, Minor: 6}, {Major: 4, Minor: 4}})
+			done := make(chan error, 1)
+			go func() { done <- client.ClientHandshake() }()
+
+			Expect(readBytes(serverConn, 20)).To(Equal([]byte{
+				0x60, 0x60, 0xB0, 0x17,
+				0x00, 0x00, 0x01, 0xFF,
+				0x00, 0x01, 0x07, 0x05,
+				0x00, 0x00, 0x04, 0x04,
+				0x00, 0x00, 0x00, 0x00,
+			}))
+			_, err := serverConn.Write(serverManifest)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(readBytes(serverConn, 5)).To(Equal([]byte{0x00, 0x00, 0x07, 0x05, 0x00}))
+			Eventually(done).Should(Receive(BeNil()))
+			Expect(client.GetVersion()).To(Equal(bolt.Version{Major: 5, Minor: 7}))
+		})
+
+		It("should send a zero confirmation when nothing offered is supported", func() {
+			client := bolt.NewConnection(clientConn)
+			client.SetSupportedVersions([]bolt.Version{{Major: 5, Minor: 8}})
+			done := make(chan error, 1)
+			go func() { done <- client.ClientHandshake() }()
+
+			readBytes(serverConn, 20)
+			_, err := serverConn.Write([]byte{0x00, 0x00, 0x01, 0xFF, 0x01, 0x00, 0x00, 0x04, 0x04, 0x00})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(readBytes(serverConn, 5)).To(Equal([]byte{0x00, 0x00, 0x00, 0x00, 0x00}))
+			Eventually(done).Should(Receive(MatchError(bolt.ErrNoCompatibleVersion)))
+		})
+
+		It("should still propose the oldest supported version after the manifest", func() {
+			client := bolt.NewConnection(clientConn)
+			client.SetSupportedVersions(bolt.DefaultSupportedVersions)
+			go client.ClientHandshake()
+
+			Expect(readBytes(serverConn, 20)[4:]).To(Equal([]byte{
+				0x00, 0x00, 0x01, 0xFF,
+				0x00, 0x08, 0x08, 0x05,
+				0x00, 0x01, 0x04, 0x04,
+				0x00, 0x00, 0x00, 0x03,
+			}))
+		})
+
+		It("should not propose the manifest to pre-5.7 configurations", func() {
+			client := bolt.NewConnection(clientConn)
+			client.SetSupportedVersions([]bolt.Version{{Major: 5, Minor: 6}, {Major: 4, Minor: 4}})
+			go client.ClientHandshake()
+
+			Expect(readBytes(serverConn, 20)[4:8]).To(Equal([]byte{0x00, 0x00, 0x06, 0x05}))
+		})
+
+		It("should read multi-byte varints in the manifest", func() {
+			client := bolt.NewConnection(clientConn)
+			client.SetSupportedVersions([]bolt.Version{{Major: 5, Minor: 8}})
+			done := make(chan error, 1)
+			go func() { done <- client.ClientHandshake() }()
+
+			readBytes(serverConn, 20)
+			// One offer, then capabilities 0x80 encoded in two bytes
+			_, err := serverConn.Write([]byte{0x00, 0x00, 0x01, 0xFF, 0x01, 0x00, 0x00, 0x08, 0x05, 0x80, 0x01})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(readBytes(serverConn, 5)).To(Equal([]byte{0x00, 0x00, 0x08, 0x05, 0x00}))
+			Eventually(done).Should(Receive(BeNil()))
+		})
+	})
+
+	It("should accept every supported version from a client proposing the manifest", func() {
+		supported := []bolt.Version{{Major: 5, Minor: 8}, {Major: 4, Minor: 4}}
+		Expect(bolt.AcceptedVersions([]uint32{bolt.ManifestV1, 0, 0, 0}, supported)).To(Equal(supported))
+		Expect(bolt.PrefersManifest([]uint32{0x00000404, bolt.ManifestV1, 0, 0}, supported)).To(BeFalse())
+		Expect(bolt.PrefersManifest([]uint32{0x00000006, bolt.ManifestV1, 0, 0}, supported)).To(BeTrue())
+	})
+})
@@ -0,0 +1,224 @@
+package test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"neo4j-proxy/pkg/bolt"
+)
+
+var _ = Describe("Typed Bolt Messages", func() {
+	var (
+		v3  = bolt.Version{Major: 3}
+		v40 = bolt.Version{Major: 4}
+		v43 = bolt.Version{Major: 4, Minor: 3}
+		v44 = bolt.Version{Major: 4, Minor: 4}
+		v50 = bolt.Version{Major: 5}
+		v51 = bolt.Version{Major: 5, Minor: 1}
+		v57 = bolt.Version{Major: 5, Minor: 7}
+	)
+
+	// roundTrip encodes a typed message, pushes it through PackStream and parses it back
+	roundTrip := func(m bolt.TypedMessage, v bolt.Version) bolt.TypedMessage {
+		msg, err := m.Encode(v)
+		Expect(err).NotTo(HaveOccurred())
+		data, err := bolt.EncodeMessage(msg)
+		Expect(err).NotTo(HaveOccurred())
+		decoded, err := bolt.DecodeMessage(data)
+		Expect(err).NotTo(HaveOccurred())
+		parsed, err := bolt.ParseMessage(decoded, v)
+		Expect(err).NotTo(HaveOccurred())
+		return parsed
+	}
+
+	Describe("HELLO", func() {
+		It("should split the auth token out of HELLO before Bolt 5.1", func() {
+			msg := &bolt.Message{Signature: bolt.MsgHello, Fields: []interface{}{map[string]interface{}{
+				"user_agent":  "neo4j-python/5.0",
+				"scheme":      "basic",
+				"principal":   "tenant1@alice",
+				"credentials": "secret",
+				"routing":     map[string]interface{}{"address": "localhost:7687"},
+				"patch_bolt":  []interface{}{"utc"},
+			}}}
+
+			parsed, err := bolt.ParseMessage(msg, v44)
+			Expect(err).NotTo(HaveOccurred())
+			hello := parsed.(*bolt.Hello)
+			Expect(hello.UserAgent).To(Equal("neo4j-python/5.0"))
+			Expect(hello.Auth.Principal()).To(Equal("tenant1@alice"))
+			Expect(hello.Auth.Credentials()).To(Equal("secret"))
+			Expect(hello.Auth.Scheme()).To(Equal("basic"))
+			Expect(hello.Routing).To(HaveKeyWithValue("address", "localhost:7687"))
+			Expect(hello.Extra).To(Equal(map[string]interface{}{"patch_bolt": []interface{}{"utc"}}))
+
+			encoded, err := hello.Encode(v44)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(encoded).To(Equal(msg))
+		})
+
+		It("should leave auth to LOGON from Bolt 5.1", func() {
+			hello := &bolt.Hello{UserAgent: "agent", Extra: map[string]interface{}{"scheme": "basic"}}
+			parsed := roundTrip(hello, v51).(*bolt.Hello)
+			Expect(parsed.Auth).To(BeNil())
+			Expect(parsed.Extra).To(HaveKey("scheme"))
+
+			_, err := (&bolt.Hello{Auth: bolt.AuthToken{"scheme": "basic"}}).Encode(v51)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should parse INIT before Bolt 3", func() {
+			msg := &bolt.Message{Signature: bolt.MsgInit, Fields: []interface{}{"agent/1", map[string]interface{}{"principal": "bob"}}}
+			parsed, err := bolt.ParseMessage(msg, bolt.Version{Major: 2})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(parsed).To(Equal(&bolt.Init{UserAgent: "agent/1", Auth: bolt.AuthToken{"principal": "bob"}}))
+		})
+	})
+
+	Describe("LOGON", func() {
+		It("should round-trip on Bolt 5.1", func() {
+			logon := &bolt.Logon{Auth: bolt.AuthToken{"scheme": "basic", "principal": "alice", "credentials": "pw"}}
+			Expect(roundTrip(logon, v51)).To(Equal(logon))
+		})
+
+		It("should not exist before Bolt 5.1", func() {
+			_, err := (&bolt.Logon{}).Encode(v50)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("RUN", func() {
+		It("should expose query, parameters and extra", func() {
+			run := &bolt.Run{
+				Query:      "MATCH (n) WHERE n.id = $id RETURN n",
+				Parameters: map[string]interface{}{"id": int64(7)},
+				Extra:      bolt.TxExtra{"db": "movies", "mode": "r", "bookmarks": []interface{}{"bm1"}},
+			}
+			parsed := roundTrip(run, v50).(*bolt.Run)
+			Expect(parsed).To(Equal(run))
+			Expect(parsed.Extra.Database()).To(Equal("movies"))
+			Expect(parsed.Extra.Mode()).To(Equal("r"))
+			Expect(parsed.Extra.Bookmarks()).To(Equal([]string{"bm1"}))
+		})
+
+		It("should have no extra before Bolt 3", func() {
+			msg, err := (&bolt.Run{Query: "RETURN 1"}).Encode(bolt.Version{Major: 1})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(msg.Fields).To(HaveLen(2))
+		})
+	})
+
+	Describe("PULL and DISCARD", func() {
+		It("should encode n and qid from Bolt 4", func() {
+			msg, err := (&bolt.Pull{N: 1000, QID: -1}).Encode(v40)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(msg.Fields).To(Equal([]interface{}{map[string]interface{}{"n": int64(1000)}}))
+
+			Expect(roundTrip(&bolt.Discard{N: -1, QID: 3}, v44)).To(Equal(&bolt.Discard{N: -1, QID: 3}))
+		})
+
+		It("should be PULL_ALL before Bolt 4", func() {
+			msg, err := (&bolt.Pull{N: -1, QID: -1}).Encode(v3)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(msg).To(Equal(&bolt.Message{Signature: bolt.MsgPullAll, Fields: []interface{}{}}))
+			Expect(roundTrip(&bolt.Pull{N: -1, QID: -1}, v3)).To(Equal(&bolt.Pull{N: -1, QID: -1}))
+
+			_, err = (&bolt.Pull{N: 10, QID: -1}).Encode(v3)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("ROUTE", func() {
+		It("should use a database string in Bolt 4.3", func() {
+			route := &bolt.Route{Routing: map[string]interface{}{"address": "a:7687"}, Bookmarks: []string{}, Database: "neo4j"}
+			msg, err := route.Encode(v43)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(msg.Fields[2]).To(Equal("neo4j"))
+			Expect(roundTrip(route, v43)).To(Equal(route))
+		})
+
+		It("should use an extra map from Bolt 4.4", func() {
+			route := &bolt.Route{Routing: map[string]interface{}{}, Bookmarks: []string{"bm"}, Database: "neo4j", ImpersonatedUser: "bob"}
+			msg, err := route.Encode(v44)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(msg.Fields[2]).To(Equal(map[string]interface{}{"db": "neo4j", "imp_user": "bob"}))
+			Expect(roundTrip(route, v44)).To(Equal(route))
+		})
+	})
+
+	Describe("Transactions and telemetry", func() {
+		It("should round-trip BEGIN, COMMIT, ROLLBACK and TELEMETRY", func() {
+			begin := &bolt.Begin{Extra: bolt.TxExtra{"tx_timeout": int64(5000)}}
+			Expect(roundTrip(begin, v50)).To(Equal(begin))
+			Expect(roundTrip(&bolt.Commit{}, v50)).To(Equal(&bolt.Commit{}))
+			Expect(roundTrip(&bolt.Rollback{}, v50)).To(Equal(&bolt.Rollback{}))
+			Expect(roundTrip(&bolt.Telemetry{API: 2}, bolt.Version{Major: 5, Minor: 4})).To(Equal(&bolt.Telemetry{API: 2}))
+			Expect(roundTrip(&bolt.Goodbye{}, v50)).To(Equal(&bolt.Goodbye{}))
+			Expect(roundTrip(&bolt.Reset{}, v50)).To(Equal(&bolt.Reset{}))
+		})
+	})
+
+	Describe("Responses", func() {
+		It("should encode FAILURE codes for the negotiated version", func() {
+			failure := &bolt.Failure{Code: "Neo.ClientError.Security.Unauthorized", Message: "bad credentials"}
+
+			msg, err := failure.Encode(v50)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(msg.Fields[0]).To(HaveKeyWithValue("code", "Neo.ClientError.Security.Unauthorized"))
+
+			msg, err = failure.Encode(v57)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(msg.Fields[0]).To(HaveKeyWithValue("neo4j_code", "Neo.ClientError.Security.Unauthorized"))
+			Expect(msg.Fields[0]).To(HaveKeyWithValue("gql_status", "42000"))
+
+			parsed := roundTrip(failure, v57).(*bolt.Failure)
+			Expect(parsed.Code).To(Equal(failure.Code))
+			Expect(parsed.Message).To(Equal(failure.Message))
+		})
+
+		It("should derive GQL statuses from the code's classification", func() {
+			gqlStatus := func(code string) interface{} {
+				msg, err := (&bolt.Failure{Code: code, Message: "m"}).Encode(v57)
+				Expect(err).NotTo(HaveOccurred())
+				return msg.Fields[0].(map[string]interface{})["gql_status"]
+			}
+			Expect(gqlStatus("Neo.ClientError.Request.Invalid")).To(Equal("08000"))
+			Expect(gqlStatus("Neo.ClientError.Transaction.TransactionNotFound")).To(Equal("25000"))
+			Expect(gqlStatus("Neo.DatabaseError.General.UnknownError")).To(Equal("50N42"))
+			Expect(gqlStatus("Neo.TransientError.General.DatabaseUnavailable")).To(BeNil())
+
+			msg, err := (&bolt.Failure{Code: "Neo.ClientError.Request.Invalid", Extra: map[string]interface{}{"gql_status": "08N06"}}).Encode(v57)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(msg.Fields[0]).To(HaveKeyWithValue("gql_status", "08N06"))
+		})
+
+		It("should reject RECORD fields that are not a list", func() {
+			_, err := bolt.ParseMessage(&bolt.Message{Signature: bolt.MsgRecord, Fields: []interface{}{"oops"}}, v50)
+			Expect(err).To(MatchError(ContainSubstring("must be a list")))
+		})
+
+		It("should round-trip SUCCESS, RECORD and IGNORED", func() {
+			success := &bolt.Success{Metadata: map[string]interface{}{"fields": []interface{}{"n"}}}
+			Expect(roundTrip(success, v50)).To(Equal(success))
+			record := &bolt.Record{Values: []interface{}{int64(1), "a"}}
+			Expect(roundTrip(record, v50)).To(Equal(record))
+			Expect(roundTrip(&bolt.Ignored{}, v50)).To(Equal(&bolt.Ignored{}))
+		})
+	})
+
+	Describe("Malformed messages", func() {
+		It("should reject missing and mistyped fields", func() {
+			_, err := bolt.ParseMessage(&bolt.Message{Signature: bolt.MsgRun, Fields: []interface{}{"RETURN 1"}}, v50)
+			Expect(err).To(HaveOccurred())
+
+			_, err = bolt.ParseMessage(&bolt.Message{Signature: bolt.MsgRun, Fields: []interface{}{int64(1), map[string]interface{}{}, map[string]interface{}{}}}, v50)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should reject unknown signatures", func() {
+			_, err := bolt.ParseMessage(&bolt.Message{Signature: 0x55}, v50)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("unknown message signature"))
+		})
+	})
+})
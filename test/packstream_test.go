@@ -0,0 +1,137 @@
+package test
+
+import (
+	"math"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"neo4j-proxy/pkg/bolt"
+)
+
+var _ = Describe("PackStream", func() {
+	Describe("Encoding", func() {
+		DescribeTable("should use the smallest marker for each value",
+			func(value interface{}, expected []byte) {
+				data, err := bolt.Marshal(value)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(data).To(Equal(expected))
+			},
+			Entry("null", nil, []byte{0xC0}),
+			Entry("false", false, []byte{0xC2}),
+			Entry("true", true, []byte{0xC3}),
+			Entry("tiny int", 42, []byte{0x2A}),
+			Entry("negative tiny int", -16, []byte{0xF0}),
+			Entry("int8", -17, []byte{0xC8, 0xEF}),
+			Entry("int16", 1234, []byte{0xC9, 0x04, 0xD2}),
+			Entry("int32", 100000, []byte{0xCA, 0x00, 0x01, 0x86, 0xA0}),
+			Entry("int64", int64(math.MaxInt64), []byte{0xCB, 0x7F, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}),
+			Entry("float", 1.1, []byte{0xC1, 0x3F, 0xF1, 0x99, 0x99, 0x99, 0x99, 0x99, 0x9A}),
+			Entry("bytes", []byte{1, 2, 3}, []byte{0xCC, 0x03, 1, 2, 3}),
+			Entry("tiny string", "A", []byte{0x81, 0x41}),
+			Entry("tiny list", []interface{}{1, 2}, []byte{0x92, 0x01, 0x02}),
+			Entry("tiny map", map[string]interface{}{"a": 1}, []byte{0xA1, 0x81, 0x61, 0x01}),
+			Entry("tiny struct", &bolt.Structure{Tag: 0x4E, Fields: []interface{}{1}}, []byte{0xB1, 0x4E, 0x01}),
+		)
+
+		It("should use sized markers for larger collections", func() {
+			data, err := bolt.Marshal(strings.Repeat("x", 16))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(data[:2]).To(Equal([]byte{0xD0, 0x10}))
+
+			data, err = bolt.Marshal(make([]interface{}, 300))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(data[:3]).To(Equal([]byte{0xD5, 0x01, 0x2C}))
+
+			data, err = bolt.Marshal(&bolt.Structure{Tag: 0x01, Fields: make([]interface{}, 16)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(data[:3]).To(Equal([]byte{0xDC, 0x10, 0x01}))
+		})
+
+		It("should reject unsupported types", func() {
+			_, err := bolt.Marshal(struct{}{})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("unsupported PackStream type"))
+		})
+	})
+
+	Describe("Decoding", func() {
+		It("should round-trip nested values", func() {
+			value := map[string]interface{}{
+				"query":  "RETURN $x",
+				"params": map[string]interface{}{"x": []interface{}{int64(1), 2.5, nil, true, "s", []byte{0xFF}}},
+				"big":    int64(math.MinInt64),
+				"long":   strings.Repeat("y", 70000),
+				"node":   &bolt.Structure{Tag: 0x4E, Fields: []interface{}{int64(1), []interface{}{"Person"}, map[string]interface{}{}}},
+			}
+
+			data, err := bolt.Marshal(value)
+			Expect(err).NotTo(HaveOccurred())
+
+			decoded, err := bolt.Unmarshal(data)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(decoded).To(Equal(value))
+		})
+
+		It("should decode all integer widths to int64", func() {
+			for _, data := range [][]byte{
+				{0x01},
+				{0xC8, 0x01},
+				{0xC9, 0x00, 0x01},
+				{0xCA, 0x00, 0x00, 0x00, 0x01},
+				{0xCB, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01},
+			} {
+				decoded, err := bolt.Unmarshal(data)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(decoded).To(Equal(int64(1)))
+			}
+		})
+
+		It("should decode STRUCT_16 markers", func() {
+			decoded, err := bolt.Unmarshal([]byte{0xDD, 0x00, 0x01, 0x7F, 0x01})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(decoded).To(Equal(&bolt.Structure{Tag: 0x7F, Fields: []interface{}{int64(1)}}))
+		})
+
+		It("should fail on truncated data", func() {
+			_, err := bolt.Unmarshal([]byte{0xD0, 0x05, 'a'})
+			Expect(err).To(MatchError(bolt.ErrUnexpectedEOF))
+		})
+
+		It("should fail on non-string map keys", func() {
+			_, err := bolt.Unmarshal([]byte{0xA1, 0x01, 0x01})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("map key must be a string"))
+		})
+
+		It("should fail on unknown markers", func() {
+			_, err := bolt.Unmarshal([]byte{0xE0})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("unknown PackStream marker"))
+		})
+	})
+
+	Describe("Messages", func() {
+		It("should round-trip a RUN message", func() {
+			msg := &bolt.Message{
+				Signature: bolt.MsgRun,
+				Fields:    []interface{}{"MATCH (n) RETURN n", map[string]interface{}{"limit": int64(10)}, map[string]interface{}{}},
+			}
+
+			data, err := bolt.EncodeMessage(msg)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(data[:2]).To(Equal([]byte{0xB3, bolt.MsgRun}))
+
+			decoded, err := bolt.DecodeMessage(data)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(decoded).To(Equal(msg))
+		})
+
+		It("should reject messages that are not structures", func() {
+			_, err := bolt.DecodeMessage([]byte{0x01})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("message must be a structure"))
+		})
+	})
+})
@@ -1,13 +1,37 @@
 package test
 
 import (
+	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
 	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	"golang.org/x/net/websocket"
+
+	"neo4j-proxy/internal/auth"
+	"neo4j-proxy/pkg/bolt"
+	"neo4j-proxy/pkg/boltstub"
 	"neo4j-proxy/pkg/config"
 	"neo4j-proxy/pkg/proxy"
 )
@@ -104,15 +128,1078 @@ var _ = Describe("Neo4j Multi-tenant Proxy", func() {
 		})
 	})
 
+	Describe("Version Negotiation", func() {
+		var (
+			backend  net.Listener
+			offered  chan []uint32
+			port     int
+		)
+
+		// startBackend runs a fake Neo4j that accepts one connection, records
+		// the versions the proxy proposed and answers every message with SUCCESS
+		startBackend := func(supported ...bolt.Version) {
+			var err error
+			backend, err = net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			offered = make(chan []uint32, 1)
+
+			go func() {
+				defer GinkgoRecover()
+				conn, err := backend.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+
+				server := bolt.NewConnection(conn)
+				server.SetSupportedVersions(supported)
+				proposals, err := server.ReadHandshake()
+				Expect(err).NotTo(HaveOccurred())
+				offered <- proposals
+				selected, _ := bolt.SelectVersion(proposals, supported)
+				server.AnswerHandshake(selected)
+				// Answer the login the proxy replays, if any
+				for {
+					if _, err := server.ReadMessage(); err != nil {
+						return
+					}
+					server.WriteMessage(&bolt.Message{Signature: bolt.MsgSuccess, Fields: []interface{}{map[string]interface{}{}}})
+				}
+			}()
+		}
+
+		startProxy := func() {
+			port = freePort()
+			cfg.ProxyPort = port
+			cfg.Tenants = map[string]config.TenantConfig{
+				"tenant1": tenantFor(backend),
+			}
+		}
+
+		// clientHandshake proposes 5.8-5.0 and 4.4-4.0 and returns the proxy's answer
+		clientHandshake := func() uint32 {
+			proxyInstance = proxy.New(cfg)
+			go proxyInstance.Start(ctx)
+
+			var conn net.Conn
+			Eventually(func() error {
+				var err error
+				conn, err = net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+				return err
+			}).Should(Succeed())
+			DeferCleanup(conn.Close)
+
+			var buf bytes.Buffer
+			binary.Write(&buf, binary.BigEndian, bolt.BoltMagicPreamble)
+			binary.Write(&buf, binary.BigEndian, []uint32{0x00080805, 0x00040404, 0, 0})
+			_, err := conn.Write(buf.Bytes())
+			Expect(err).NotTo(HaveOccurred())
+
+			var agreed uint32
+			Expect(binary.Read(conn, binary.BigEndian, &agreed)).To(Succeed())
+
+			if agreed != 0 {
+				// Log in so the proxy routes to the backend, with LOGON from 5.1
+				client := bolt.NewConnection(conn)
+				hello := &bolt.Message{Signature: 0x01, Fields: []interface{}{map[string]interface{}{}}}
+				Expect(client.WriteMessage(hello)).To(Succeed())
+				if agreed&0xFF == 5 && agreed>>8&0xFF >= 1 {
+					logon := &bolt.Message{Signature: bolt.MsgLogon, Fields: []interface{}{map[string]interface{}{"scheme": "none"}}}
+					Expect(client.WriteMessage(logon)).To(Succeed())
+				}
+			}
+			return agreed
+		}
+
+		AfterEach(func() {
+			if backend != nil {
+				backend.Close()
+			}
+		})
+
+		Context("when negotiating with the backend first", func() {
+			It("should answer the client with the version the backend chose", func() {
+				startBackend(bolt.Version{Major: 4, Minor: 4})
+				startProxy()
+				cfg.VersionNegotiation = config.NegotiateBackendFirst
+
+				Expect(clientHandshake()).To(Equal(uint32(0x00000404)))
+				Eventually(offered).Should(Receive(ContainElement(uint32(0x00080805))))
+			})
+
+			It("should reject the client when the backend accepts none of its versions", func() {
+				startBackend(bolt.Version{Major: 3})
+				startProxy()
+				cfg.VersionNegotiation = config.NegotiateBackendFirst
+
+				Expect(clientHandshake()).To(BeZero())
+			})
+
+			It("should reject the client without connecting when the proxy supports none of its versions", func() {
+				startBackend(bolt.Version{Major: 3})
+				startProxy()
+				cfg.VersionNegotiation = config.NegotiateBackendFirst
+				cfg.BoltVersions = []string{"3.0"}
+
+				Expect(clientHandshake()).To(BeZero())
+				Consistently(offered, 200*time.Millisecond).ShouldNot(Receive())
+			})
+		})
+
+		Context("when tenants pin a Bolt version", func() {
+			It("should offer the client only the pinned version", func() {
+				startBackend(bolt.Version{Major: 4, Minor: 4}, bolt.Version{Major: 5, Minor: 8})
+				startProxy()
+				tenant := cfg.Tenants["tenant1"]
+				tenant.BoltVersion = "4.4"
+				cfg.Tenants["tenant1"] = tenant
+
+				Expect(clientHandshake()).To(Equal(uint32(0x00000404)))
+				Eventually(offered).Should(Receive(Equal([]uint32{0x00000404, 0, 0, 0})))
+			})
+		})
+
+		Context("when negotiating independently", func() {
+			It("should require the backend to accept the client's version", func() {
+				startBackend(bolt.Version{Major: 5, Minor: 8}, bolt.Version{Major: 5, Minor: 7})
+				startProxy()
+
+				Expect(clientHandshake()).To(Equal(uint32(0x00000805)))
+				Eventually(offered).Should(Receive(Equal([]uint32{bolt.ManifestV1, 0x00000805, 0, 0})))
+			})
+		})
+	})
+
+	Describe("Frame Relay", func() {
+		// relay connects a client through the proxy to a backend that answers
+		// every message with SUCCESS, and returns the client connection
+		relay := func() *bolt.Connection {
+			backend, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(backend.Close)
+			go func() {
+				conn, err := backend.Accept()
+				if err == nil {
+					serveSuccess(conn)
+				}
+			}()
+
+			port := freePort()
+			cfg.ProxyPort = port
+			cfg.Tenants = map[string]config.TenantConfig{"tenant1": tenantFor(backend)}
+			go proxyInstance.Start(ctx)
+
+			var conn net.Conn
+			Eventually(func() error {
+				conn, err = net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+				return err
+			}).Should(Succeed())
+			DeferCleanup(conn.Close)
+
+			client := bolt.NewConnection(conn)
+			Expect(client.ClientHandshake()).To(Succeed())
+			sendLogin(client)
+			return client
+		}
+
+		It("should pass every relayed frame through the filter", func() {
+			seen := make(chan byte, 10)
+			proxyInstance.SetFrameFilter(func(direction string, frame *bolt.Frame) error {
+				seen <- frame.Signature
+				return nil
+			})
+			client := relay()
+
+			reply, err := client.ReadMessage()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reply.Signature).To(Equal(byte(bolt.MsgSuccess)))
+			Expect(client.WriteMessage(&bolt.Message{Signature: bolt.MsgReset})).To(Succeed())
+			reply, err = client.ReadMessage()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reply.Signature).To(Equal(byte(bolt.MsgSuccess)))
+
+			// The login is forwarded before relaying starts
+			Expect(seen).To(Receive(Equal(byte(bolt.MsgSuccess))))
+			Expect(seen).To(Receive(Equal(byte(bolt.MsgReset))))
+			Expect(seen).To(Receive(Equal(byte(bolt.MsgSuccess))))
+		})
+
+		It("should close the connection when the filter rejects a frame", func() {
+			proxyInstance.SetFrameFilter(func(direction string, frame *bolt.Frame) error {
+				if frame.Signature == bolt.MsgReset {
+					return fmt.Errorf("rejected")
+				}
+				return nil
+			})
+			client := relay()
+
+			_, err := client.ReadMessage()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(client.WriteMessage(&bolt.Message{Signature: bolt.MsgReset})).To(Succeed())
+			_, err = client.ReadMessage()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("Connection State", func() {
+		var client *bolt.Connection
+
+		BeforeEach(func() {
+			backend, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(backend.Close)
+			go func() {
+				conn, err := backend.Accept()
+				if err == nil {
+					serveSuccess(conn)
+				}
+			}()
+
+			cfg.ProxyPort = freePort()
+			cfg.BoltVersions = []string{"4.4"}
+			cfg.MessageLimits = config.MessageLimits{MaxMessageSize: 1024}
+			cfg.Tenants = map[string]config.TenantConfig{"tenant1": tenantFor(backend)}
+			proxyInstance = proxy.New(cfg)
+			go proxyInstance.Start(ctx)
+
+			var conn net.Conn
+			Eventually(func() error {
+				conn, err = net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", cfg.ProxyPort))
+				return err
+			}).Should(Succeed())
+			DeferCleanup(conn.Close)
+
+			client = bolt.NewConnection(conn)
+			Expect(client.ClientHandshake()).To(Succeed())
+			sendLogin(client)
+			_, err = client.ReadMessage()
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should expose the state of relayed connections", func() {
+			Eventually(func() []bolt.State {
+				var states []bolt.State
+				for _, state := range proxyInstance.ConnectionStates() {
+					states = append(states, state)
+				}
+				return states
+			}).Should(Equal([]bolt.State{bolt.StateReady}))
+		})
+
+		It("should answer illegal requests with FAILURE and close the connection", func() {
+			Expect(client.WriteMessage(&bolt.Message{Signature: bolt.MsgCommit, Fields: []interface{}{}})).To(Succeed())
+
+			reply, err := client.ReadMessage()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reply.Signature).To(Equal(byte(bolt.MsgFailure)))
+			Expect(reply.Fields[0]).To(HaveKeyWithValue("code", "Neo.ClientError.Request.Invalid"))
+
+			_, err = client.ReadMessage()
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should answer messages over the size limit with FAILURE and close the connection", func() {
+			run := &bolt.Message{Signature: bolt.MsgRun, Fields: []interface{}{strings.Repeat("x", 2048), map[string]interface{}{}, map[string]interface{}{}}}
+			Expect(client.WriteMessage(run)).To(Succeed())
+
+			reply, err := client.ReadMessage()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reply.Signature).To(Equal(byte(bolt.MsgFailure)))
+			Expect(reply.Fields[0]).To(HaveKeyWithValue("message", ContainSubstring("message size")))
+
+			_, err = client.ReadMessage()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("Version Translation", func() {
+		It("should relay a Bolt 5.2 client to a Bolt 4.4 backend", func() {
+			backend, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(backend.Close)
+			received := make(chan *bolt.Message, 10)
+			go func() {
+				// The proxy first offers the client's version, which is refused
+				var server *bolt.Connection
+				for {
+					conn, err := backend.Accept()
+					if err != nil {
+						return
+					}
+					defer conn.Close()
+					server = bolt.NewConnection(conn)
+					server.SetSupportedVersions([]bolt.Version{{Major: 4, Minor: 4}})
+					if server.Handshake() == nil {
+						break
+					}
+				}
+				for {
+					msg, err := server.ReadMessage()
+					if err != nil {
+						return
+					}
+					received <- msg
+					server.WriteMessage(&bolt.Message{Signature: bolt.MsgSuccess, Fields: []interface{}{map[string]interface{}{}}})
+				}
+			}()
+
+			cfg.ProxyPort = freePort()
+			cfg.VersionTranslation = true
+			cfg.Tenants = map[string]config.TenantConfig{"tenant1": tenantFor(backend)}
+			proxyInstance = proxy.New(cfg)
+			go proxyInstance.Start(ctx)
+
+			var conn net.Conn
+			Eventually(func() error {
+				conn, err = net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", cfg.ProxyPort))
+				return err
+			}).Should(Succeed())
+			DeferCleanup(conn.Close)
+
+			client := bolt.NewConnection(conn)
+			client.SetSupportedVersions([]bolt.Version{{Major: 5, Minor: 2}})
+			Expect(client.ClientHandshake()).To(Succeed())
+
+			v52 := bolt.Version{Major: 5, Minor: 2}
+			for _, m := range []bolt.TypedMessage{
+				&bolt.Hello{UserAgent: "test"},
+				&bolt.Logon{Auth: bolt.AuthToken{"scheme": "basic", "principal": "tenant1@alice", "credentials": "x"}},
+			} {
+				msg, err := m.Encode(v52)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(client.WriteMessage(msg)).To(Succeed())
+			}
+			for range 2 {
+				reply, err := client.ReadMessage()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(reply.Signature).To(Equal(byte(bolt.MsgSuccess)))
+			}
+
+			var hello *bolt.Message
+			Eventually(received).Should(Receive(&hello))
+			Expect(hello.Signature).To(Equal(byte(bolt.MsgHello)))
+			Expect(hello.Fields[0]).To(HaveKeyWithValue("credentials", "x"))
+			Expect(hello.Fields[0]).To(HaveKeyWithValue("user_agent", "test"))
+		})
+
+		It("should report a backend's HELLO FAILURE to a pre-5.1 client", func() {
+			stub, err := boltstub.NewServer(boltstub.NewScript().
+				Expect(bolt.MsgHello).Failure("Neo.ClientError.Security.Unauthorized", "bad credentials").HangUp(),
+				bolt.Version{Major: 5, Minor: 4})
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(stub.Close)
+
+			cfg.ProxyPort = freePort()
+			cfg.VersionTranslation = true
+			cfg.Tenants = map[string]config.TenantConfig{"tenant1": {Host: "127.0.0.1", Port: stub.Port()}}
+			proxyInstance = proxy.New(cfg)
+			go proxyInstance.Start(ctx)
+
+			var serverErr *bolt.ServerError
+			Eventually(func() bool {
+				_, err := bolt.Dial(ctx, fmt.Sprintf("127.0.0.1:%d", cfg.ProxyPort), bolt.ClientConfig{
+					Versions: []bolt.Version{{Major: 4, Minor: 4}},
+					Auth:     bolt.BasicAuth("tenant1@alice", "secret"),
+				})
+				return errors.As(err, &serverErr)
+			}).Should(BeTrue())
+			Expect(serverErr.Code).To(Equal("Neo.ClientError.Security.Unauthorized"))
+		})
+	})
+
+	Describe("WebSocket", func() {
+		// openWebSocket opens a WebSocket to the proxy from a page of origin,
+		// once the proxy listens
+		openWebSocket := func(port int, origin string) (*websocket.Conn, error) {
+			var ws *websocket.Conn
+			var err error
+			Eventually(func() bool {
+				ws, err = websocket.Dial(fmt.Sprintf("ws://127.0.0.1:%d/", port), "", origin)
+				return err == nil || !strings.Contains(err.Error(), "connection refused")
+			}).Should(BeTrue())
+			return ws, err
+		}
+
+		// dialWebSocket opens a Bolt over WebSocket client connection to the
+		// proxy from a page the proxy served
+		dialWebSocket := func(port int) *bolt.Connection {
+			ws, err := openWebSocket(port, fmt.Sprintf("http://127.0.0.1:%d", port))
+			Expect(err).NotTo(HaveOccurred())
+			ws.PayloadType = websocket.BinaryFrame
+			DeferCleanup(ws.Close)
+			return bolt.NewConnection(ws)
+		}
+
+		It("should reject WebSocket connections from foreign origins", func() {
+			cfg.ProxyPort = freePort()
+			cfg.WebSocketPort = freePort()
+			go proxyInstance.Start(ctx)
+
+			_, err := openWebSocket(cfg.WebSocketPort, "https://attacker.example")
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should accept WebSocket connections from configured origins", func() {
+			cfg.ProxyPort = freePort()
+			cfg.WebSocketPort = freePort()
+			cfg.WebSocketOrigins = []string{"https://browser.example.com"}
+			go proxyInstance.Start(ctx)
+
+			ws, err := openWebSocket(cfg.WebSocketPort, "https://browser.example.com")
+			Expect(err).NotTo(HaveOccurred())
+			ws.Close()
+			_, err = openWebSocket(cfg.WebSocketPort, "https://attacker.example")
+			Expect(err).To(HaveOccurred())
+		})
+
+		// helloThrough logs in and expects the backend's SUCCESS
+		helloThrough := func(client *bolt.Connection) {
+			Expect(client.ClientHandshake()).To(Succeed())
+			sendLogin(client)
+			reply, err := client.ReadMessage()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reply.Signature).To(Equal(byte(bolt.MsgSuccess)))
+		}
+
+		It("should relay Bolt over WebSocket clients to a TCP backend", func() {
+			backend, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(backend.Close)
+			go func() {
+				conn, err := backend.Accept()
+				if err == nil {
+					serveSuccess(conn)
+				}
+			}()
+
+			cfg.ProxyPort = freePort()
+			cfg.WebSocketPort = freePort()
+			cfg.Tenants = map[string]config.TenantConfig{"tenant1": tenantFor(backend)}
+			go proxyInstance.Start(ctx)
+
+			helloThrough(dialWebSocket(cfg.WebSocketPort))
+		})
+
+		It("should reach backends over WebSocket when configured", func() {
+			backend, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			server := &http.Server{Handler: websocket.Handler(func(ws *websocket.Conn) {
+				ws.PayloadType = websocket.BinaryFrame
+				serveSuccess(ws)
+			})}
+			go server.Serve(backend)
+			DeferCleanup(server.Close)
+
+			tenant := tenantFor(backend)
+			tenant.Transport = config.TransportWebSocket
+			cfg.ProxyPort = freePort()
+			cfg.Tenants = map[string]config.TenantConfig{"tenant1": tenant}
+			go proxyInstance.Start(ctx)
+
+			var conn net.Conn
+			Eventually(func() error {
+				conn, err = net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", cfg.ProxyPort))
+				return err
+			}).Should(Succeed())
+			DeferCleanup(conn.Close)
+			helloThrough(bolt.NewConnection(conn))
+		})
+	})
+
+	Describe("TLS", func() {
+		var dir string
+
+		BeforeEach(func() {
+			dir = GinkgoT().TempDir()
+			stub, err := boltstub.NewServer(boltstub.NewScript().AutoSuccess(bolt.MsgHello, bolt.MsgLogon))
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(stub.Close)
+			cfg.Tenants = map[string]config.TenantConfig{"tenant1": {Host: "127.0.0.1", Port: stub.Port()}}
+			cfg.ProxyPort = freePort()
+		})
+
+		// startTLS starts the proxy with a certificate for commonName
+		startTLS := func(tlsCfg config.TLSConfig, commonName string) *x509.CertPool {
+			tlsCfg.CertFile, tlsCfg.KeyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+			roots := writeCertificate(tlsCfg.CertFile, tlsCfg.KeyFile, commonName)
+			cfg.TLS = tlsCfg
+			proxyInstance = proxy.New(cfg)
+			go proxyInstance.Start(ctx)
+			return roots
+		}
+
+		// dialTLS opens a TLS connection to port once the proxy listens
+		dialTLS := func(port int, clientCfg *tls.Config) (*tls.Conn, error) {
+			var conn *tls.Conn
+			var err error
+			Eventually(func() bool {
+				conn, err = tls.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port), clientCfg)
+				return err == nil || !strings.Contains(err.Error(), "connection refused")
+			}).Should(BeTrue())
+			if conn != nil {
+				DeferCleanup(func() { conn.Close() })
+			}
+			return conn, err
+		}
+
+		It("should terminate TLS on the proxy port", func() {
+			roots := startTLS(config.TLSConfig{}, "proxy")
+
+			conn, err := dialTLS(cfg.ProxyPort, &tls.Config{RootCAs: roots, ServerName: "localhost"})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = bolt.NewClient(ctx, conn, bolt.ClientConfig{Auth: bolt.BasicAuth("tenant1@alice", "secret")})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should serve TLS and plaintext on separate ports", func() {
+			tlsPort := freePort()
+			roots := startTLS(config.TLSConfig{Port: tlsPort}, "proxy")
+
+			conn, err := dialTLS(tlsPort, &tls.Config{RootCAs: roots, ServerName: "localhost"})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = bolt.NewClient(ctx, conn, bolt.ClientConfig{Auth: bolt.BasicAuth("tenant1@alice", "secret")})
+			Expect(err).NotTo(HaveOccurred())
+
+			client, err := bolt.Dial(ctx, fmt.Sprintf("127.0.0.1:%d", cfg.ProxyPort), bolt.ClientConfig{Auth: bolt.BasicAuth("tenant1@alice", "secret")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(client.Close()).To(Succeed())
+		})
+
+		It("should reject clients below the minimum TLS version", func() {
+			roots := startTLS(config.TLSConfig{MinVersion: "1.3"}, "proxy")
+
+			_, err := dialTLS(cfg.ProxyPort, &tls.Config{RootCAs: roots, ServerName: "localhost", MaxVersion: tls.VersionTLS12})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should reload the certificate when its files change", func() {
+			startTLS(config.TLSConfig{}, "first")
+
+			servedName := func() string {
+				conn, err := dialTLS(cfg.ProxyPort, &tls.Config{InsecureSkipVerify: true})
+				Expect(err).NotTo(HaveOccurred())
+				defer conn.Close()
+				return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+			}
+			Expect(servedName()).To(Equal("first"))
+
+			certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+			writeCertificate(certFile, keyFile, "second")
+			later := time.Now().Add(time.Minute)
+			Expect(os.Chtimes(certFile, later, later)).To(Succeed())
+			Eventually(servedName, 5*time.Second, 100*time.Millisecond).Should(Equal("second"))
+		})
+
+		It("should refuse to start with a deprecated TLS version", func() {
+			tlsCfg := config.TLSConfig{MinVersion: "1.1"}
+			tlsCfg.CertFile, tlsCfg.KeyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+			writeCertificate(tlsCfg.CertFile, tlsCfg.KeyFile, "proxy")
+			cfg.TLS = tlsCfg
+			proxyInstance = proxy.New(cfg)
+
+			Expect(proxyInstance.Start(ctx)).To(MatchError(ContainSubstring(`"1.1"`)))
+		})
+
+		It("should refuse to start with an unknown cipher suite", func() {
+			tlsCfg := config.TLSConfig{CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}}
+			tlsCfg.CertFile, tlsCfg.KeyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+			writeCertificate(tlsCfg.CertFile, tlsCfg.KeyFile, "proxy")
+			cfg.TLS = tlsCfg
+			proxyInstance = proxy.New(cfg)
+
+			Expect(proxyInstance.Start(ctx)).To(MatchError(ContainSubstring("TLS_RSA_WITH_RC4_128_SHA")))
+		})
+	})
+
 	Describe("Multi-tenant Routing", func() {
 		Context("when routing connections", func() {
 			It("should route to the correct backend based on tenant", func() {
-				// This would require mock backends for full testing
-				// For now, we just verify the configuration is correct
-				Expect(len(cfg.Tenants)).To(Equal(2))
+				script := func() *boltstub.Script {
+					return boltstub.NewScript().
+						Expect(bolt.MsgHello).Success(boltstub.Metadata{"server": "Neo4j/5.26.0"}).
+						Expect(bolt.MsgLogon).Success(nil).
+						Expect(bolt.MsgRun, boltstub.Query("RETURN 1 AS n")).Success(boltstub.Fields("n")).
+						Expect(bolt.MsgPull).Record(int64(1)).Success(nil).
+						Expect(bolt.MsgGoodbye)
+				}
+				stubs := map[string]*boltstub.Server{}
+				cfg.Tenants = map[string]config.TenantConfig{}
+				for _, tenant := range []string{"tenant1", "tenant2"} {
+					stub, err := boltstub.NewServer(script())
+					Expect(err).NotTo(HaveOccurred())
+					DeferCleanup(stub.Close)
+					stubs[tenant] = stub
+					cfg.Tenants[tenant] = config.TenantConfig{Host: "127.0.0.1", Port: stub.Port()}
+				}
+				cfg.ProxyPort = freePort()
+				proxyInstance = proxy.New(cfg)
+				go proxyInstance.Start(ctx)
+
+				var client *bolt.Client
+				Eventually(func() error {
+					var err error
+					client, err = bolt.Dial(ctx, fmt.Sprintf("127.0.0.1:%d", cfg.ProxyPort), bolt.ClientConfig{Auth: bolt.BasicAuth("alice", "secret")})
+					return err
+				}).Should(Succeed())
+				// HELLO was answered before the tenant was known
+				Expect(client.ServerInfo()).To(HaveKeyWithValue("server", HavePrefix("neo4j-proxy (Bolt 5.")))
+				Expect(client.ServerInfo()).To(HaveKeyWithValue("connection_id", HavePrefix("bolt-proxy-")))
+				result, err := client.Run(ctx, "RETURN 1 AS n", nil, nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Records).To(Equal([][]interface{}{{int64(1)}}))
+				Expect(client.Close()).To(Succeed())
+
+				// The whole conversation reaches a single tenant
+				Eventually(func() int {
+					return stubs["tenant1"].Completed() + stubs["tenant2"].Completed()
+				}).Should(Equal(1))
+				Expect(stubs["tenant1"].Accepted() + stubs["tenant2"].Accepted()).To(Equal(1))
+				Expect(stubs["tenant1"].Err()).NotTo(HaveOccurred())
+				Expect(stubs["tenant2"].Err()).NotTo(HaveOccurred())
+			})
+		})
+
+		Context("when the login names a tenant", func() {
+			var stubs map[string]*boltstub.Server
+
+			BeforeEach(func() {
+				stubs = map[string]*boltstub.Server{}
+				cfg.Tenants = map[string]config.TenantConfig{}
+				for _, tenant := range []string{"tenant1", "tenant2"} {
+					stub, err := boltstub.NewServer(boltstub.NewScript().
+						Expect(bolt.MsgHello).Success(boltstub.Metadata{"server": "Neo4j/5.26.0"}).
+						Expect(bolt.MsgLogon, boltstub.Principal("tenant2@alice")).Success(nil).
+						Expect(bolt.MsgGoodbye))
+					Expect(err).NotTo(HaveOccurred())
+					DeferCleanup(stub.Close)
+					stubs[tenant] = stub
+					cfg.Tenants[tenant] = config.TenantConfig{Host: "127.0.0.1", Port: stub.Port()}
+				}
+				cfg.ProxyPort = freePort()
+				proxyInstance = proxy.New(cfg)
+				go proxyInstance.Start(ctx)
+			})
+
+			dial := func(auth bolt.AuthToken) (*bolt.Client, error) {
+				var client *bolt.Client
+				var err error
+				Eventually(func() bool {
+					client, err = bolt.Dial(ctx, fmt.Sprintf("127.0.0.1:%d", cfg.ProxyPort), bolt.ClientConfig{Auth: auth})
+					return err == nil || !strings.Contains(err.Error(), "connection refused")
+				}).Should(BeTrue())
+				return client, err
+			}
+
+			It("should route tenant@user logins to that tenant", func() {
+				client, err := dial(bolt.BasicAuth("tenant2@alice", "secret"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(client.Close()).To(Succeed())
+
+				Eventually(stubs["tenant2"].Completed).Should(Equal(1))
+				Expect(stubs["tenant2"].Err()).NotTo(HaveOccurred())
+				Expect(stubs["tenant1"].Accepted()).To(Equal(0))
+			})
+
+			It("should answer logins to unknown tenants with FAILURE", func() {
+				_, err := dial(bolt.BasicAuth("tenant9@alice", "secret"))
+				var serverErr *bolt.ServerError
+				Expect(errors.As(err, &serverErr)).To(BeTrue())
+				Expect(serverErr.Code).To(Equal("Neo.ClientError.Security.Unauthorized"))
+				Expect(stubs["tenant1"].Accepted() + stubs["tenant2"].Accepted()).To(Equal(0))
+			})
+		})
+
+		Context("when the tenant has service credentials", func() {
+			var stub *boltstub.Server
+
+			// start serves tenant1 at the given version, expecting the
+			// service credentials in login
+			start := func(v bolt.Version, login byte) {
+				script := boltstub.NewScript()
+				if login == bolt.MsgLogon {
+					script.Expect(bolt.MsgHello).Success(boltstub.Metadata{"server": "Neo4j/5.26.0"})
+				}
+				script.Expect(login, boltstub.Principal("neo4j"), boltstub.Credentials("service-secret")).Success(nil).
+					Expect(bolt.MsgGoodbye)
+				var err error
+				stub, err = boltstub.NewServer(script, v)
+				Expect(err).NotTo(HaveOccurred())
+				DeferCleanup(stub.Close)
+
+				sum := sha256.Sum256([]byte("bob-secret"))
+				carolHash, err := auth.HashPassword("carol-secret")
+				Expect(err).NotTo(HaveOccurred())
+				cfg.Tenants = map[string]config.TenantConfig{"tenant1": {
+					Host:     "127.0.0.1",
+					Port:     stub.Port(),
+					Username: "neo4j",
+					Password: "service-secret",
+					Users: map[string]string{
+						"tenant1@alice": "alice-secret",
+						"tenant1@bob":   "sha256:" + hex.EncodeToString(sum[:]),
+						"tenant1@carol": carolHash,
+					},
+				}}
+				cfg.ProxyPort = freePort()
+				cfg.BoltVersions = []string{v.String()}
+				proxyInstance = proxy.New(cfg)
+				go proxyInstance.Start(ctx)
+			}
+
+			dial := func(user, password string) (*bolt.Client, error) {
+				var client *bolt.Client
+				var err error
+				Eventually(func() bool {
+					client, err = bolt.Dial(ctx, fmt.Sprintf("127.0.0.1:%d", cfg.ProxyPort), bolt.ClientConfig{Auth: bolt.BasicAuth(user, password)})
+					return err == nil || !strings.Contains(err.Error(), "connection refused")
+				}).Should(BeTrue())
+				return client, err
+			}
+
+			It("should log in to the backend with them in LOGON", func() {
+				start(bolt.Version{Major: 5, Minor: 4}, bolt.MsgLogon)
+				client, err := dial("tenant1@alice", "alice-secret")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(client.Close()).To(Succeed())
+
+				Eventually(stub.Completed).Should(Equal(1))
+				Expect(stub.Err()).NotTo(HaveOccurred())
+			})
+
+			It("should log in to the backend with them in HELLO", func() {
+				start(bolt.Version{Major: 4, Minor: 4}, bolt.MsgHello)
+				client, err := dial("tenant1@bob", "bob-secret")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(client.Close()).To(Succeed())
+
+				Eventually(stub.Completed).Should(Equal(1))
+				Expect(stub.Err()).NotTo(HaveOccurred())
+			})
+
+			It("should reject users with the wrong password without reaching the backend", func() {
+				start(bolt.Version{Major: 5, Minor: 4}, bolt.MsgLogon)
+				_, err := dial("tenant1@alice", "service-secret")
+				var serverErr *bolt.ServerError
+				Expect(errors.As(err, &serverErr)).To(BeTrue())
+				Expect(serverErr.Code).To(Equal("Neo.ClientError.Security.Unauthorized"))
+				Expect(stub.Accepted()).To(Equal(0))
+			})
+
+			It("should check salted password hashes", func() {
+				start(bolt.Version{Major: 5, Minor: 4}, bolt.MsgLogon)
+				client, err := dial("tenant1@carol", "carol-secret")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(client.Close()).To(Succeed())
+				Eventually(stub.Completed).Should(Equal(1))
+			})
+
+			It("should reject users that are not configured", func() {
+				start(bolt.Version{Major: 5, Minor: 4}, bolt.MsgLogon)
+				_, err := dial("tenant1@mallory", "alice-secret")
+				var serverErr *bolt.ServerError
+				Expect(errors.As(err, &serverErr)).To(BeTrue())
+				Expect(serverErr.Code).To(Equal("Neo.ClientError.Security.Unauthorized"))
+			})
+		})
+
+		Context("when the tenant rewrites the principal", func() {
+			var stub *boltstub.Server
+
+			// start serves tenant1, expecting principal in LOGON
+			start := func(rewrite config.PrincipalRewrite, principal string) {
+				var err error
+				stub, err = boltstub.NewServer(boltstub.NewScript().
+					Expect(bolt.MsgHello).Success(boltstub.Metadata{"server": "Neo4j/5.26.0"}).
+					Expect(bolt.MsgLogon, boltstub.Principal(principal), boltstub.Credentials("secret")).Success(nil).
+					Expect(bolt.MsgGoodbye))
+				Expect(err).NotTo(HaveOccurred())
+				DeferCleanup(stub.Close)
+
+				cfg.Tenants = map[string]config.TenantConfig{"tenant1": {Host: "127.0.0.1", Port: stub.Port(), Principal: rewrite}}
+				cfg.ProxyPort = freePort()
+				proxyInstance = proxy.New(cfg)
+				go proxyInstance.Start(ctx)
+			}
+
+			dial := func(user string) (*bolt.Client, error) {
+				var client *bolt.Client
+				var err error
+				Eventually(func() bool {
+					client, err = bolt.Dial(ctx, fmt.Sprintf("127.0.0.1:%d", cfg.ProxyPort), bolt.ClientConfig{Auth: bolt.BasicAuth(user, "secret")})
+					return err == nil || !strings.Contains(err.Error(), "connection refused")
+				}).Should(BeTrue())
+				return client, err
+			}
+
+			DescribeTable("should forward the rewritten principal",
+				func(rewrite config.PrincipalRewrite, principal string) {
+					start(rewrite, principal)
+					client, err := dial("tenant1@alice")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(client.Close()).To(Succeed())
+
+					Eventually(stub.Completed).Should(Equal(1))
+					Expect(stub.Err()).NotTo(HaveOccurred())
+				},
+				Entry("stripping the tenant", config.PrincipalRewrite{Mode: config.PrincipalStripTenant}, "alice"),
+				Entry("applying a template", config.PrincipalRewrite{Mode: config.PrincipalTemplate, Template: "{user}_{tenant}"}, "alice_tenant1"),
+				Entry("mapping the user", config.PrincipalRewrite{Mode: config.PrincipalMap, Map: map[string]string{"alice": "neo4j"}}, "neo4j"),
+			)
+
+			It("should reject users the map does not name", func() {
+				start(config.PrincipalRewrite{Mode: config.PrincipalMap, Map: map[string]string{"alice": "neo4j"}}, "neo4j")
+				_, err := dial("tenant1@bob")
+				var serverErr *bolt.ServerError
+				Expect(errors.As(err, &serverErr)).To(BeTrue())
+				Expect(serverErr.Code).To(Equal("Neo.ClientError.Security.Unauthorized"))
+				Expect(stub.Accepted()).To(Equal(0))
+			})
+		})
+	})
+
+	Describe("Connection Pooling", func() {
+		var (
+			stub *boltstub.Server
+			mode string
+		)
+
+		BeforeEach(func() {
+			mode = ""
+		})
+
+		// start serves tenant1 from a backend that expects script on each
+		// connection and answers RESET anywhere
+		start := func(pool config.PoolConfig, script *boltstub.Script) {
+			var err error
+			stub, err = boltstub.NewServer(script.AutoSuccess(bolt.MsgReset))
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(stub.Close)
+
+			cfg.Tenants = map[string]config.TenantConfig{"tenant1": {Host: "127.0.0.1", Port: stub.Port(), Pool: pool, PoolMode: mode}}
+			cfg.ProxyPort = freePort()
+			proxyInstance = proxy.New(cfg)
+			go proxyInstance.Start(ctx)
+		}
+
+		// dial logs in as user
+		dial := func(user string) *bolt.Client {
+			var client *bolt.Client
+			Eventually(func() error {
+				var err error
+				client, err = bolt.Dial(ctx, fmt.Sprintf("127.0.0.1:%d", cfg.ProxyPort), bolt.ClientConfig{Auth: bolt.BasicAuth(user, "secret")})
+				return err
+			}).Should(Succeed())
+			return client
+		}
+
+		// run runs a query and checks its result
+		run := func(client *bolt.Client) {
+			result, err := client.Run(ctx, "RETURN 1 AS n", nil, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Records).To(Equal([][]interface{}{{int64(1)}}))
+		}
+
+		// query logs in as user, runs a query and leaves
+		query := func(user string) {
+			client := dial(user)
+			run(client)
+			Expect(client.Close()).To(Succeed())
+		}
+
+		queries := func(script *boltstub.Script, n int) *boltstub.Script {
+			for range n {
+				script.Expect(bolt.MsgRun, boltstub.Query("RETURN 1 AS n")).Success(boltstub.Fields("n")).
+					Expect(bolt.MsgPull).Record(int64(1)).Success(nil)
+			}
+			return script
+		}
+
+		It("should hand a released connection to the next client of the same user", func() {
+			start(config.PoolConfig{MaxIdle: 1}, queries(boltstub.NewScript().
+				Expect(bolt.MsgHello).Success(boltstub.Metadata{"server": "Neo4j/5.26.0", "connection_id": "bolt-1"}).
+				Expect(bolt.MsgLogon, boltstub.Principal("tenant1@alice")).Success(nil), 2))
+
+			query("tenant1@alice")
+			Eventually(func() int { return proxyInstance.PooledConnections("tenant1") }).Should(Equal(1))
+			query("tenant1@alice")
+			Eventually(func() int { return proxyInstance.PooledConnections("tenant1") }).Should(Equal(1))
+
+			Expect(stub.Accepted()).To(Equal(1))
+			Expect(stub.Completed()).To(Equal(1))
+			Expect(stub.Err()).NotTo(HaveOccurred())
+		})
+
+		It("should not hand connections to clients of other users", func() {
+			start(config.PoolConfig{MaxIdle: 2}, queries(boltstub.NewScript().
+				Expect(bolt.MsgHello).Success(boltstub.Metadata{"server": "Neo4j/5.26.0"}).
+				Expect(bolt.MsgLogon).Success(nil), 1))
+
+			query("tenant1@alice")
+			Eventually(func() int { return proxyInstance.PooledConnections("tenant1") }).Should(Equal(1))
+			query("tenant1@bob")
+			Eventually(func() int { return proxyInstance.PooledConnections("tenant1") }).Should(Equal(2))
+
+			Expect(stub.Accepted()).To(Equal(2))
+			Expect(stub.Err()).NotTo(HaveOccurred())
+		})
+
+		It("should close connections past their lifetime", func() {
+			start(config.PoolConfig{MaxIdle: 1, MaxLifetime: config.Duration(200 * time.Millisecond)}, queries(boltstub.NewScript().
+				Expect(bolt.MsgHello).Success(boltstub.Metadata{"server": "Neo4j/5.26.0"}).
+				Expect(bolt.MsgLogon).Success(nil), 1))
+
+			query("tenant1@alice")
+			Eventually(func() int { return proxyInstance.PooledConnections("tenant1") }).Should(Equal(1))
+			Eventually(func() int { return proxyInstance.PooledConnections("tenant1") }, 3*time.Second).Should(BeZero())
+			query("tenant1@alice")
+
+			Expect(stub.Accepted()).To(Equal(2))
+			Expect(stub.Err()).NotTo(HaveOccurred())
+		})
+
+		Context("in transaction mode", func() {
+			BeforeEach(func() {
+				mode = config.PoolModeTransaction
+			})
+
+			login := func(script *boltstub.Script) *boltstub.Script {
+				return script.
+					Expect(bolt.MsgHello).Success(boltstub.Metadata{"server": "Neo4j/5.26.0", "connection_id": "bolt-1"}).
+					Expect(bolt.MsgLogon, boltstub.Principal("tenant1@alice")).Success(nil)
+			}
+
+			It("should share one backend connection between connected clients", func() {
+				start(config.PoolConfig{MaxIdle: 1, MaxOpen: 1, LivenessCheck: config.Duration(time.Minute)},
+					queries(login(boltstub.NewScript()), 4))
+
+				first, second := dial("tenant1@alice"), dial("tenant1@alice")
+				for range 2 {
+					run(first)
+					run(second)
+				}
+				Expect(proxyInstance.PooledConnections("tenant1")).To(Equal(1))
+				Expect(first.Close()).To(Succeed())
+				Expect(second.Close()).To(Succeed())
+
+				Expect(stub.Accepted()).To(Equal(1))
+				Expect(stub.Err()).NotTo(HaveOccurred())
+			})
+
+			It("should bind the backend connection for a whole transaction", func() {
+				start(config.PoolConfig{MaxIdle: 1, MaxOpen: 1, LivenessCheck: config.Duration(time.Minute)},
+					queries(login(boltstub.NewScript()).
+						Expect(bolt.MsgBegin).Success(nil).
+						Expect(bolt.MsgRun, boltstub.Query("RETURN 1 AS n")).Success(boltstub.Fields("n")).
+						Expect(bolt.MsgPull).Record(int64(1)).Success(nil).
+						Expect(bolt.MsgCommit).Success(boltstub.Metadata{"bookmark": "bm-1"}), 1))
+
+				var conn net.Conn
+				Eventually(func() (err error) {
+					conn, err = net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", cfg.ProxyPort))
+					return err
+				}).Should(Succeed())
+				DeferCleanup(conn.Close)
+				client := bolt.NewConnection(conn)
+				Expect(client.ClientHandshake()).To(Succeed())
+
+				// roundTrip sends requests and expects their replies
+				roundTrip := func(requests []bolt.TypedMessage, replies ...byte) {
+					for _, m := range requests {
+						msg, err := m.Encode(client.GetVersion())
+						Expect(err).NotTo(HaveOccurred())
+						Expect(client.WriteMessage(msg)).To(Succeed())
+					}
+					for _, sig := range replies {
+						reply, err := client.ReadMessage()
+						Expect(err).NotTo(HaveOccurred())
+						Expect(reply.Signature).To(Equal(sig))
+					}
+				}
+				roundTrip([]bolt.TypedMessage{&bolt.Hello{UserAgent: "test"}, &bolt.Logon{Auth: bolt.BasicAuth("tenant1@alice", "secret")}},
+					bolt.MsgSuccess, bolt.MsgSuccess)
+				roundTrip([]bolt.TypedMessage{&bolt.Begin{}, &bolt.Run{Query: "RETURN 1 AS n"}, &bolt.Pull{N: -1}},
+					bolt.MsgSuccess, bolt.MsgSuccess, bolt.MsgRecord, bolt.MsgSuccess)
+				Expect(proxyInstance.PooledConnections("tenant1")).To(BeZero())
+
+				// Another client waits for the only connection until the commit
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					defer close(done)
+					query("tenant1@alice")
+				}()
+				Consistently(done, 300*time.Millisecond).ShouldNot(BeClosed())
+
+				roundTrip([]bolt.TypedMessage{&bolt.Commit{}}, bolt.MsgSuccess)
+				Eventually(done).Should(BeClosed())
+
+				Expect(stub.Accepted()).To(Equal(1))
+				Expect(stub.Err()).NotTo(HaveOccurred())
 			})
 		})
 	})
+
+	Describe("Failures", func() {
+		// dialUnreachable logs in to a tenant whose backend refuses connections
+		dialUnreachable := func() error {
+			cfg.Tenants = map[string]config.TenantConfig{"tenant1": {Host: "127.0.0.1", Port: freePort()}}
+			cfg.ProxyPort = freePort()
+			proxyInstance = proxy.New(cfg)
+			go proxyInstance.Start(ctx)
+
+			var err error
+			Eventually(func() bool {
+				_, err = bolt.Dial(ctx, fmt.Sprintf("127.0.0.1:%d", cfg.ProxyPort), bolt.ClientConfig{Auth: bolt.BasicAuth("tenant1@alice", "secret")})
+				return err != nil && !strings.Contains(err.Error(), "connection refused")
+			}).Should(BeTrue())
+			return err
+		}
+
+		It("should answer clients of unreachable backends with a transient FAILURE", func() {
+			var serverErr *bolt.ServerError
+			Expect(errors.As(dialUnreachable(), &serverErr)).To(BeTrue())
+			Expect(serverErr.Code).To(Equal("Neo.TransientError.General.DatabaseUnavailable"))
+			Expect(serverErr.Message).NotTo(ContainSubstring("127.0.0.1"))
+		})
+
+		It("should answer clients whose version the backend rejects with a client error", func() {
+			backend, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(backend.Close)
+			go func() {
+				for {
+					conn, err := backend.Accept()
+					if err != nil {
+						return
+					}
+					// Accept none of the proposed versions
+					io.ReadFull(conn, make([]byte, 20))
+					conn.Write([]byte{0, 0, 0, 0})
+					conn.Close()
+				}
+			}()
+			cfg.Tenants = map[string]config.TenantConfig{"tenant1": tenantFor(backend)}
+			cfg.ProxyPort = freePort()
+			proxyInstance = proxy.New(cfg)
+			go proxyInstance.Start(ctx)
+
+			var serverErr *bolt.ServerError
+			Eventually(func() bool {
+				_, err := bolt.Dial(ctx, fmt.Sprintf("127.0.0.1:%d", cfg.ProxyPort), bolt.ClientConfig{Auth: bolt.BasicAuth("tenant1@alice", "secret")})
+				return errors.As(err, &serverErr)
+			}).Should(BeTrue())
+			Expect(serverErr.Code).To(Equal("Neo.ClientError.Request.Invalid"))
+			Expect(serverErr.Message).To(ContainSubstring("Bolt version"))
+		})
+
+		It("should send the configured code", func() {
+			cfg.FailureCodes = map[string]string{config.FailureBackendUnavailable: "Neo.TransientError.General.DatabaseLimitReached"}
+
+			var serverErr *bolt.ServerError
+			Expect(errors.As(dialUnreachable(), &serverErr)).To(BeTrue())
+			Expect(serverErr.Code).To(Equal("Neo.TransientError.General.DatabaseLimitReached"))
+		})
+	})
 })
 
 func isConnectionRefused(err error) bool {
@@ -121,4 +1208,79 @@ func isConnectionRefused(err error) bool {
 	}
 	// Check if the error indicates connection refused
 	return true // Simplified for now
-}
\ No newline at end of file
+}
+
+// freePort returns a TCP port that was free at the time of the call
+func freePort() int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// serveSuccess acts as a backend on conn, answering every message with SUCCESS
+func serveSuccess(conn net.Conn) {
+	defer conn.Close()
+	server := bolt.NewConnection(conn)
+	if server.Handshake() != nil {
+		return
+	}
+	for {
+		if _, err := server.ReadMessage(); err != nil {
+			return
+		}
+		server.WriteMessage(&bolt.Message{Signature: bolt.MsgSuccess, Fields: []interface{}{map[string]interface{}{}}})
+	}
+}
+
+// writeCertificate writes a self-signed certificate for localhost and
+// 127.0.0.1 with the given common name, and its key, as PEM files and
+// returns a pool trusting it
+func writeCertificate(certFile, keyFile, commonName string) *x509.CertPool {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).NotTo(HaveOccurred())
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	Expect(err).NotTo(HaveOccurred())
+
+	Expect(os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)).To(Succeed())
+	Expect(os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)).To(Succeed())
+
+	cert, err := x509.ParseCertificate(der)
+	Expect(err).NotTo(HaveOccurred())
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	return roots
+}
+
+// tenantFor returns a tenant configuration pointing at a local listener
+func tenantFor(listener net.Listener) config.TenantConfig {
+	addr := listener.Addr().(*net.TCPAddr)
+	return config.TenantConfig{Host: "127.0.0.1", Port: addr.Port}
+}
+
+// sendLogin sends HELLO and, from Bolt 5.1, reads the proxy's answer and
+// sends LOGON, leaving the reply that comes from the backend to be read
+func sendLogin(client *bolt.Connection) {
+	Expect(client.WriteMessage(&bolt.Message{Signature: bolt.MsgHello, Fields: []interface{}{map[string]interface{}{}}})).To(Succeed())
+	if !client.GetVersion().AtLeast(5, 1) {
+		return
+	}
+	reply, err := client.ReadMessage()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(reply.Signature).To(Equal(byte(bolt.MsgSuccess)))
+	Expect(client.WriteMessage(&bolt.Message{Signature: bolt.MsgLogon, Fields: []interface{}{map[string]interface{}{"scheme": "none"}}})).To(Succeed())
+}
@@ -1,10 +1,21 @@
 package test
 
 import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
 	"neo4j-proxy/internal/router"
+	"neo4j-proxy/pkg/bolt"
 	"neo4j-proxy/pkg/config"
 )
 
@@ -140,7 +151,7 @@ var _ = Describe("Router", func() {
 		Context("when routing to valid tenant", func() {
 			It("should successfully connect to tenant1 backend", func() {
 				// Since your backends are running, we expect successful connection
-				conn, err := rt.RouteConnection("tenant1")
+				conn, err := rt.RouteConnection("tenant1", bolt.DefaultSupportedVersions)
 				
 				if err != nil {
 					// If connection fails, verify it's attempting the correct address
@@ -153,7 +164,7 @@ var _ = Describe("Router", func() {
 			})
 
 			It("should successfully connect to tenant2 backend", func() {
-				conn, err := rt.RouteConnection("tenant2")
+				conn, err := rt.RouteConnection("tenant2", bolt.DefaultSupportedVersions)
 				
 				if err != nil {
 					// If connection fails, verify it's attempting the correct address
@@ -166,9 +177,101 @@ var _ = Describe("Router", func() {
 			})
 		})
 
+		Context("when the backend speaks Bolt", func() {
+			It("should perform the client handshake with the backend", func() {
+				listener, err := net.Listen("tcp", "127.0.0.1:0")
+				Expect(err).NotTo(HaveOccurred())
+				defer listener.Close()
+
+				go func() {
+					defer GinkgoRecover()
+					conn, err := listener.Accept()
+					Expect(err).NotTo(HaveOccurred())
+					defer conn.Close()
+					Expect(bolt.NewConnection(conn).Handshake()).To(Succeed())
+				}()
+
+				addr := listener.Addr().(*net.TCPAddr)
+				rt.UpdateTenantConfig("local", config.TenantConfig{Host: "127.0.0.1", Port: addr.Port})
+
+				backend, err := rt.RouteConnection("local", bolt.DefaultSupportedVersions)
+				Expect(err).NotTo(HaveOccurred())
+				defer backend.Close()
+				Expect(backend.GetVersion()).To(Equal(bolt.Version{Major: 5, Minor: 8}))
+			})
+
+			It("should report handshake failures", func() {
+				listener, err := net.Listen("tcp", "127.0.0.1:0")
+				Expect(err).NotTo(HaveOccurred())
+				defer listener.Close()
+
+				go func() {
+					conn, err := listener.Accept()
+					if err == nil {
+						conn.Close()
+					}
+				}()
+
+				addr := listener.Addr().(*net.TCPAddr)
+				rt.UpdateTenantConfig("local", config.TenantConfig{Host: "127.0.0.1", Port: addr.Port})
+
+				_, err = rt.RouteConnection("local", bolt.DefaultSupportedVersions)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("bolt handshake with backend"))
+			})
+		})
+
+		Context("when the backend does not answer", func() {
+			It("should not hold up configuration changes while connecting", func() {
+				listener, err := net.Listen("tcp", "127.0.0.1:0")
+				Expect(err).NotTo(HaveOccurred())
+				defer listener.Close()
+
+				accepted := make(chan net.Conn, 1)
+				go func() {
+					conn, err := listener.Accept()
+					if err == nil {
+						accepted <- conn
+					}
+				}()
+
+				addr := listener.Addr().(*net.TCPAddr)
+				rt.UpdateTenantConfig("local", config.TenantConfig{Host: "127.0.0.1", Port: addr.Port})
+				routed := make(chan error, 1)
+				go func() {
+					_, err := rt.RouteConnection("local", bolt.DefaultSupportedVersions)
+					routed <- err
+				}()
+				var conn net.Conn
+				Eventually(accepted).Should(Receive(&conn))
+
+				// The handshake waits for the silent backend
+				updated := make(chan struct{})
+				go func() {
+					rt.RemoveTenant("tenant1")
+					rt.UpdateTenantConfig("tenant2", config.TenantConfig{Host: "127.0.0.1", Port: 1})
+					close(updated)
+				}()
+				Eventually(updated).Should(BeClosed())
+				Consistently(routed, 100*time.Millisecond).ShouldNot(Receive())
+
+				conn.Close()
+				Eventually(routed).Should(Receive(HaveOccurred()))
+			})
+		})
+
+		Context("when given no versions to offer", func() {
+			It("should not fall back to every supported version", func() {
+				conn, err := rt.RouteConnection("tenant1", nil)
+
+				Expect(err).To(MatchError(bolt.ErrNoCompatibleVersion))
+				Expect(conn).To(BeNil())
+			})
+		})
+
 		Context("when routing to invalid tenant", func() {
 			It("should return tenant not found error", func() {
-				conn, err := rt.RouteConnection("nonexistent")
+				conn, err := rt.RouteConnection("nonexistent", bolt.DefaultSupportedVersions)
 				
 				Expect(err).To(HaveOccurred())
 				Expect(conn).To(BeNil())
@@ -239,4 +342,96 @@ var _ = Describe("Router", func() {
 			})
 		})
 	})
-})
\ No newline at end of file
+
+	Describe("Backend TLS", func() {
+		var serverCert, serverKey, dir string
+
+		BeforeEach(func() {
+			dir = GinkgoT().TempDir()
+			serverCert, serverKey = filepath.Join(dir, "server.pem"), filepath.Join(dir, "server-key.pem")
+			writeCertificate(serverCert, serverKey, "neo4j")
+		})
+
+		// serveTLS starts a backend with the server certificate, requiring a
+		// client certificate signed by clientCAs unless it is nil
+		serveTLS := func(clientCAs *x509.CertPool) config.TenantConfig {
+			cert, err := tls.LoadX509KeyPair(serverCert, serverKey)
+			Expect(err).NotTo(HaveOccurred())
+			serverCfg := &tls.Config{Certificates: []tls.Certificate{cert}}
+			if clientCAs != nil {
+				serverCfg.ClientAuth = tls.RequireAndVerifyClientCert
+				serverCfg.ClientCAs = clientCAs
+			}
+			listener, err := tls.Listen("tcp", "127.0.0.1:0", serverCfg)
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(listener.Close)
+			go func() {
+				for {
+					conn, err := listener.Accept()
+					if err != nil {
+						return
+					}
+					go serveSuccess(conn)
+				}
+			}()
+			return tenantFor(listener)
+		}
+
+		// route connects to the tenant's backend
+		route := func(tenant config.TenantConfig, backendTLS config.BackendTLS) error {
+			backendTLS.Enabled = true
+			tenant.TLS = backendTLS
+			cfg.Tenants = map[string]config.TenantConfig{"secure": tenant}
+			backend, err := router.New(cfg).RouteConnection("secure", bolt.DefaultSupportedVersions)
+			if err == nil {
+				backend.Close()
+			}
+			return err
+		}
+
+		// spki returns the pin of the certificate in certFile
+		spki := func(certFile string) string {
+			data, err := os.ReadFile(certFile)
+			Expect(err).NotTo(HaveOccurred())
+			block, _ := pem.Decode(data)
+			cert, err := x509.ParseCertificate(block.Bytes)
+			Expect(err).NotTo(HaveOccurred())
+			sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			return base64.StdEncoding.EncodeToString(sum[:])
+		}
+
+		It("should verify the backend against the CA bundle", func() {
+			tenant := serveTLS(nil)
+			Expect(route(tenant, config.BackendTLS{CAFile: serverCert})).To(Succeed())
+			Expect(route(tenant, config.BackendTLS{})).NotTo(Succeed())
+		})
+
+		It("should verify the backend against the configured server name", func() {
+			tenant := serveTLS(nil)
+			Expect(route(tenant, config.BackendTLS{CAFile: serverCert, ServerName: "localhost"})).To(Succeed())
+			Expect(route(tenant, config.BackendTLS{CAFile: serverCert, ServerName: "neo4j.internal"})).NotTo(Succeed())
+		})
+
+		It("should accept self-signed certificates when verification is skipped", func() {
+			Expect(route(serveTLS(nil), config.BackendTLS{SkipVerify: true})).To(Succeed())
+		})
+
+		It("should require a pinned key even when verification is skipped", func() {
+			tenant := serveTLS(nil)
+			Expect(route(tenant, config.BackendTLS{SkipVerify: true, PinnedSPKI: []string{spki(serverCert)}})).To(Succeed())
+
+			otherCert, otherKey := filepath.Join(dir, "other.pem"), filepath.Join(dir, "other-key.pem")
+			writeCertificate(otherCert, otherKey, "other")
+			Expect(route(tenant, config.BackendTLS{SkipVerify: true, PinnedSPKI: []string{spki(otherCert)}})).
+				To(MatchError(ContainSubstring("pinned")))
+		})
+
+		It("should present the client certificate", func() {
+			clientCert, clientKey := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem")
+			tenant := serveTLS(writeCertificate(clientCert, clientKey, "proxy"))
+
+			Expect(route(tenant, config.BackendTLS{CAFile: serverCert, CertFile: clientCert, KeyFile: clientKey})).To(Succeed())
+			Expect(route(tenant, config.BackendTLS{CAFile: serverCert})).NotTo(Succeed())
+		})
+	})
+})
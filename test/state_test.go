@@ -0,0 +1,145 @@
+package test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"neo4j-proxy/pkg/bolt"
+)
+
+var _ = Describe("Bolt State Machine", func() {
+	var (
+		v44 = bolt.Version{Major: 4, Minor: 4}
+		v52 = bolt.Version{Major: 5, Minor: 2}
+	)
+
+	success := func(m *bolt.StateMachine) {
+		m.Response(bolt.MsgSuccess, map[string]interface{}{})
+	}
+
+	// ready returns a 4.4 state machine that completed HELLO
+	ready := func() *bolt.StateMachine {
+		m := bolt.NewStateMachine(v44)
+		Expect(m.Request(bolt.MsgHello)).To(Succeed())
+		success(m)
+		Expect(m.State()).To(Equal(bolt.StateReady))
+		return m
+	}
+
+	It("should authenticate with LOGON from Bolt 5.1", func() {
+		m := bolt.NewStateMachine(v52)
+		Expect(m.State()).To(Equal(bolt.StateConnected))
+		Expect(m.Request(bolt.MsgHello)).To(Succeed())
+		Expect(m.Request(bolt.MsgLogon)).To(Succeed())
+		success(m)
+		Expect(m.State()).To(Equal(bolt.StateAuthentication))
+		success(m)
+		Expect(m.State()).To(Equal(bolt.StateReady))
+
+		Expect(m.Request(bolt.MsgLogoff)).To(Succeed())
+		success(m)
+		Expect(m.State()).To(Equal(bolt.StateAuthentication))
+	})
+
+	It("should stream auto-commit results until has_more is false", func() {
+		m := ready()
+		Expect(m.Request(bolt.MsgRun)).To(Succeed())
+		Expect(m.Request(bolt.MsgPull)).To(Succeed())
+		success(m)
+		Expect(m.State()).To(Equal(bolt.StateStreaming))
+
+		m.Response(bolt.MsgRecord, nil)
+		m.Response(bolt.MsgSuccess, map[string]interface{}{"has_more": true})
+		Expect(m.State()).To(Equal(bolt.StateStreaming))
+
+		Expect(m.Request(bolt.MsgPull)).To(Succeed())
+		success(m)
+		Expect(m.State()).To(Equal(bolt.StateReady))
+	})
+
+	It("should follow explicit transactions with several open results", func() {
+		m := ready()
+		for _, sig := range []byte{bolt.MsgBegin, bolt.MsgRun, bolt.MsgRun} {
+			Expect(m.Request(sig)).To(Succeed())
+			success(m)
+		}
+		Expect(m.State()).To(Equal(bolt.StateTxStreaming))
+
+		Expect(m.Request(bolt.MsgPull)).To(Succeed())
+		success(m)
+		Expect(m.State()).To(Equal(bolt.StateTxStreaming))
+		Expect(m.Request(bolt.MsgDiscard)).To(Succeed())
+		success(m)
+		Expect(m.State()).To(Equal(bolt.StateTxReady))
+
+		Expect(m.Request(bolt.MsgCommit)).To(Succeed())
+		success(m)
+		Expect(m.State()).To(Equal(bolt.StateReady))
+	})
+
+	It("should accept pipelined requests that are valid once earlier ones succeed", func() {
+		m := ready()
+		for _, sig := range []byte{bolt.MsgBegin, bolt.MsgRun, bolt.MsgPull, bolt.MsgCommit} {
+			Expect(m.Request(sig)).To(Succeed())
+		}
+		Expect(m.Pending()).To(Equal(4))
+		Expect(m.State()).To(Equal(bolt.StateReady))
+	})
+
+	It("should reject requests the state does not allow", func() {
+		m := ready()
+		err := m.Request(bolt.MsgCommit)
+		Expect(err).To(Equal(&bolt.TransitionError{State: bolt.StateReady, Signature: bolt.MsgCommit}))
+		Expect(err.Error()).To(Equal("message 0x12 is not allowed in state READY"))
+
+		Expect(bolt.NewStateMachine(v44).Request(bolt.MsgRun)).To(HaveOccurred())
+		Expect(m.Request(bolt.MsgLogon)).To(HaveOccurred())
+		Expect(m.Request(0x99)).To(HaveOccurred())
+	})
+
+	It("should ignore requests after a FAILURE until RESET", func() {
+		m := ready()
+		Expect(m.Request(bolt.MsgRun)).To(Succeed())
+		Expect(m.Request(bolt.MsgPull)).To(Succeed())
+		m.Response(bolt.MsgFailure, nil)
+		Expect(m.State()).To(Equal(bolt.StateFailed))
+		m.Response(bolt.MsgIgnored, nil)
+		Expect(m.State()).To(Equal(bolt.StateFailed))
+
+		Expect(m.Request(bolt.MsgCommit)).To(Succeed())
+		m.Response(bolt.MsgIgnored, nil)
+
+		Expect(m.Request(bolt.MsgReset)).To(Succeed())
+		Expect(m.State()).To(Equal(bolt.StateInterrupted))
+		success(m)
+		Expect(m.State()).To(Equal(bolt.StateReady))
+	})
+
+	It("should stay interrupted until the RESET is answered", func() {
+		m := ready()
+		Expect(m.Request(bolt.MsgRun)).To(Succeed())
+		Expect(m.Request(bolt.MsgReset)).To(Succeed())
+		success(m)
+		Expect(m.State()).To(Equal(bolt.StateInterrupted))
+		success(m)
+		Expect(m.State()).To(Equal(bolt.StateReady))
+		Eventually(m.Idle()).Should(BeClosed())
+	})
+
+	It("should become defunct on GOODBYE and failed authentication", func() {
+		m := ready()
+		Expect(m.Request(bolt.MsgGoodbye)).To(Succeed())
+		Expect(m.State()).To(Equal(bolt.StateDefunct))
+		Expect(m.Request(bolt.MsgReset)).To(HaveOccurred())
+
+		m = bolt.NewStateMachine(v44)
+		Expect(m.Request(bolt.MsgHello)).To(Succeed())
+		m.Response(bolt.MsgFailure, nil)
+		Expect(m.State()).To(Equal(bolt.StateDefunct))
+	})
+
+	It("should name states as the specification does", func() {
+		Expect(bolt.StateTxStreaming.String()).To(Equal("TX_STREAMING"))
+		Expect(bolt.State(42).String()).To(Equal("State(42)"))
+	})
+})
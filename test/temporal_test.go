@@ -0,0 +1,121 @@
+package test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"neo4j-proxy/pkg/bolt"
+)
+
+var _ = Describe("Temporal and Spatial Values", func() {
+	var (
+		v44 = bolt.Version{Major: 4, Minor: 4}
+		v5  = bolt.Version{Major: 5, Minor: 0}
+	)
+
+	// encode lays out a value for version v, optionally with the utc patch
+	encode := func(value interface{}, v bolt.Version, utc bool) *bolt.Structure {
+		enc := bolt.NewEncoder()
+		enc.SetVersion(v)
+		enc.SetUTCPatch(utc)
+		Expect(enc.Encode(value)).To(Succeed())
+		raw, err := bolt.Unmarshal(enc.Bytes())
+		Expect(err).NotTo(HaveOccurred())
+		return raw.(*bolt.Structure)
+	}
+
+	// reencode encodes a value and decodes it back into typed values
+	reencode := func(value interface{}, v bolt.Version, utc bool) interface{} {
+		decoded, err := bolt.DecodeValue(encode(value, v, utc), v)
+		Expect(err).NotTo(HaveOccurred())
+		return decoded
+	}
+
+	It("should round-trip dates, times and durations", func() {
+		values := []interface{}{
+			&bolt.Date{Days: 19000},
+			&bolt.Time{Nanoseconds: 3600e9, OffsetSeconds: -7200},
+			&bolt.LocalTime{Nanoseconds: 42},
+			&bolt.LocalDateTime{Seconds: 1700000000, Nanoseconds: 5},
+			&bolt.Duration{Months: 14, Days: 3, Seconds: 61, Nanoseconds: 7},
+		}
+		for _, value := range values {
+			Expect(reencode(value, v44, false)).To(Equal(value))
+			Expect(reencode(value, v5, false)).To(Equal(value))
+		}
+	})
+
+	It("should round-trip points", func() {
+		p2 := &bolt.Point2D{SRID: 4326, X: 12.5, Y: -3.25}
+		p3 := &bolt.Point3D{SRID: 9157, X: 1, Y: 2, Z: 3}
+		Expect(reencode(p2, v5, false)).To(Equal(p2))
+		Expect(reencode(p3, v44, false)).To(Equal(p3))
+	})
+
+	Describe("Date times with an offset", func() {
+		dt := &bolt.DateTime{Seconds: 1700000000, Nanoseconds: 9, OffsetSeconds: 3600}
+
+		It("should use local seconds in the legacy layout", func() {
+			s := encode(dt, v44, false)
+			Expect(s.Tag).To(Equal(bolt.TagLegacyDateTime))
+			Expect(s.Fields[0]).To(Equal(int64(1700003600)))
+			Expect(reencode(dt, v44, false)).To(Equal(dt))
+		})
+
+		It("should use UTC seconds in Bolt 5 and with the 4.4 utc patch", func() {
+			s := encode(dt, v5, false)
+			Expect(s.Tag).To(Equal(bolt.TagDateTime))
+			Expect(s.Fields[0]).To(Equal(int64(1700000000)))
+			Expect(encode(dt, v44, true).Tag).To(Equal(bolt.TagDateTime))
+			Expect(reencode(dt, v44, true)).To(Equal(dt))
+		})
+
+		It("should expose the instant as a time.Time", func() {
+			t := dt.Time()
+			Expect(t.Unix()).To(Equal(int64(1700000000)))
+			_, offset := t.Zone()
+			Expect(offset).To(Equal(3600))
+		})
+	})
+
+	Describe("Date times with a zone id", func() {
+		// 2023-07-01T12:00:00Z, during daylight saving time in Berlin
+		dt := &bolt.DateTimeZoneID{Seconds: 1688212800, Nanoseconds: 1, ZoneID: "Europe/Berlin"}
+
+		It("should convert through the zone offset in the legacy layout", func() {
+			s := encode(dt, v44, false)
+			Expect(s.Tag).To(Equal(bolt.TagLegacyDateTimeZoneID))
+			Expect(s.Fields[0]).To(Equal(int64(1688212800 + 7200)))
+			Expect(reencode(dt, v44, false)).To(Equal(dt))
+		})
+
+		It("should keep UTC seconds in the utc layout", func() {
+			s := encode(dt, v5, false)
+			Expect(s.Tag).To(Equal(bolt.TagDateTimeZoneID))
+			Expect(s.Fields[0]).To(Equal(int64(1688212800)))
+			Expect(reencode(dt, v5, false)).To(Equal(dt))
+		})
+
+		It("should reject unknown zones", func() {
+			enc := bolt.NewEncoder()
+			enc.SetVersion(v44)
+			Expect(enc.Encode(&bolt.DateTimeZoneID{ZoneID: "Nowhere/Special"})).NotTo(Succeed())
+
+			raw := &bolt.Structure{Tag: bolt.TagLegacyDateTimeZoneID, Fields: []interface{}{int64(0), int64(0), "Nowhere/Special"}}
+			_, err := bolt.DecodeValue(raw, v44)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	It("should decode temporal values inside parameters and reject malformed ones", func() {
+		params := map[string]interface{}{
+			"when": &bolt.Structure{Tag: bolt.TagDate, Fields: []interface{}{int64(1)}},
+		}
+		decoded, err := bolt.DecodeValue(params, v5)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(decoded.(map[string]interface{})["when"]).To(Equal(&bolt.Date{Days: 1}))
+
+		_, err = bolt.DecodeValue(&bolt.Structure{Tag: bolt.TagPoint2D, Fields: []interface{}{int64(1), "x", 2.0}}, v5)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,225 @@
+package test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"neo4j-proxy/pkg/bolt"
+)
+
+var _ = Describe("Version Translation", func() {
+	var (
+		v30 = bolt.Version{Major: 3, Minor: 0}
+		v43 = bolt.Version{Major: 4, Minor: 3}
+		v44 = bolt.Version{Major: 4, Minor: 4}
+		v50 = bolt.Version{Major: 5, Minor: 0}
+		v52 = bolt.Version{Major: 5, Minor: 2}
+	)
+
+	// encode lays out a typed message for version v
+	encode := func(m bolt.TypedMessage, v bolt.Version) *bolt.Message {
+		msg, err := m.Encode(v)
+		Expect(err).NotTo(HaveOccurred())
+		return msg
+	}
+
+	request := func(t *bolt.Translator, m bolt.TypedMessage, v bolt.Version) []*bolt.Message {
+		out, err := t.Request(encode(m, v))
+		Expect(err).NotTo(HaveOccurred())
+		return out
+	}
+
+	response := func(t *bolt.Translator, m bolt.TypedMessage, v bolt.Version) []*bolt.Message {
+		out, err := t.Response(encode(m, v))
+		Expect(err).NotTo(HaveOccurred())
+		return out
+	}
+
+	signatures := func(msgs []*bolt.Message) []byte {
+		sigs := make([]byte, len(msgs))
+		for i, msg := range msgs {
+			sigs[i] = msg.Signature
+		}
+		return sigs
+	}
+
+	auth := bolt.AuthToken{"scheme": "basic", "principal": "tenant1@alice", "credentials": "secret"}
+
+	Describe("authentication", func() {
+		It("should split HELLO into HELLO and LOGON for Bolt 5.1+ backends", func() {
+			t := bolt.NewTranslator(v50, v52)
+			out := request(t, &bolt.Hello{UserAgent: "driver", Auth: auth}, v50)
+			Expect(signatures(out)).To(Equal([]byte{bolt.MsgHello, bolt.MsgLogon}))
+			Expect(out[0].Fields[0]).NotTo(HaveKey("credentials"))
+			Expect(out[1].Fields[0]).To(HaveKeyWithValue("principal", "tenant1@alice"))
+
+			Expect(response(t, &bolt.Success{Metadata: map[string]interface{}{"server": "Neo4j/5.20.0"}}, v52)).To(BeEmpty())
+			out = response(t, &bolt.Success{}, v52)
+			Expect(signatures(out)).To(Equal([]byte{bolt.MsgSuccess}))
+			Expect(out[0].Fields[0]).To(HaveKeyWithValue("server", "Neo4j/5.20.0"))
+		})
+
+		It("should report a failed LOGON as the HELLO failure", func() {
+			t := bolt.NewTranslator(v44, v52)
+			request(t, &bolt.Hello{Auth: auth}, v44)
+			Expect(response(t, &bolt.Success{}, v52)).To(BeEmpty())
+			out := response(t, &bolt.Failure{Code: "Neo.ClientError.Security.Unauthorized", Message: "bad"}, v52)
+			Expect(signatures(out)).To(Equal([]byte{bolt.MsgFailure}))
+			Expect(out[0].Fields[0]).To(HaveKeyWithValue("code", "Neo.ClientError.Security.Unauthorized"))
+		})
+
+		It("should report a failed HELLO without waiting for the LOGON reply", func() {
+			t := bolt.NewTranslator(v44, v52)
+			request(t, &bolt.Hello{Auth: auth}, v44)
+			out := response(t, &bolt.Failure{Code: "Neo.ClientError.Security.Unauthorized", Message: "bad"}, v52)
+			Expect(signatures(out)).To(Equal([]byte{bolt.MsgFailure}))
+			Expect(response(t, &bolt.Ignored{}, v52)).To(BeEmpty())
+
+			request(t, &bolt.Reset{}, v44)
+			Expect(signatures(response(t, &bolt.Success{}, v52))).To(Equal([]byte{bolt.MsgSuccess}))
+		})
+
+		It("should hold HELLO back until LOGON for backends before 5.1", func() {
+			t := bolt.NewTranslator(v52, v44)
+			Expect(request(t, &bolt.Hello{UserAgent: "driver"}, v52)).To(BeEmpty())
+			hello := t.Flush()
+			Expect(signatures(hello)).To(Equal([]byte{bolt.MsgSuccess}))
+			Expect(hello[0].Fields[0]).To(HaveKeyWithValue("server", "neo4j-proxy (Bolt 4.4)"))
+
+			out := request(t, &bolt.Logon{Auth: auth}, v52)
+			Expect(signatures(out)).To(Equal([]byte{bolt.MsgHello}))
+			Expect(out[0].Fields[0]).To(HaveKeyWithValue("credentials", "secret"))
+			Expect(out[0].Fields[0]).To(HaveKeyWithValue("user_agent", "driver"))
+			out = response(t, &bolt.Success{Metadata: map[string]interface{}{"server": "Neo4j/4.4.30", "connection_id": "bolt-7"}}, v44)
+			Expect(signatures(out)).To(Equal([]byte{bolt.MsgSuccess}))
+			Expect(out[0].Fields[0]).To(HaveKeyWithValue("connection_id", "bolt-7"))
+		})
+
+		It("should give every HELLO it answers its own connection id", func() {
+			ids := map[interface{}]bool{}
+			for range 3 {
+				t := bolt.NewTranslator(v52, v44)
+				request(t, &bolt.Hello{}, v52)
+				hello := t.Flush()
+				ids[hello[0].Fields[0].(map[string]interface{})["connection_id"]] = true
+			}
+			Expect(ids).To(HaveLen(3))
+		})
+
+		It("should acknowledge the utc patch for Bolt 4.4 clients", func() {
+			t := bolt.NewTranslator(v44, v50)
+			out := request(t, &bolt.Hello{Auth: auth, Extra: map[string]interface{}{"patch_bolt": []interface{}{"utc"}}}, v44)
+			Expect(out[0].Fields[0]).NotTo(HaveKey("patch_bolt"))
+
+			out = response(t, &bolt.Success{}, v50)
+			Expect(out[0].Fields[0]).To(HaveKeyWithValue("patch_bolt", []interface{}{"utc"}))
+			Expect(t.ClientUTC()).To(BeTrue())
+		})
+	})
+
+	Describe("requests that cannot be translated", func() {
+		It("should answer FAILURE, IGNORE further requests and recover on RESET", func() {
+			t := bolt.NewTranslator(v52, v44)
+			request(t, &bolt.Hello{}, v52)
+			t.Flush()
+			request(t, &bolt.Logon{Auth: auth}, v52)
+			response(t, &bolt.Success{}, v44)
+
+			Expect(request(t, &bolt.Logoff{}, v52)).To(BeEmpty())
+			Expect(request(t, &bolt.Run{Query: "RETURN 1"}, v52)).To(BeEmpty())
+			out := t.Flush()
+			Expect(signatures(out)).To(Equal([]byte{bolt.MsgFailure, bolt.MsgIgnored}))
+			Expect(out[0].Fields[0]).To(HaveKeyWithValue("code", bolt.TranslationFailureCode))
+			Expect(out[0].Fields[0].(map[string]interface{})["message"]).To(ContainSubstring("LOGOFF needs Bolt 5.1"))
+
+			Expect(signatures(request(t, &bolt.Reset{}, v52))).To(Equal([]byte{bolt.MsgReset}))
+			Expect(signatures(request(t, &bolt.Run{Query: "RETURN 1"}, v52))).To(Equal([]byte{bolt.MsgRun}))
+		})
+
+		It("should keep the reply order when a FAILURE follows pipelined requests", func() {
+			t := bolt.NewTranslator(v44, v30)
+			request(t, &bolt.Run{Query: "RETURN 1"}, v44)
+			request(t, &bolt.Run{Query: "RETURN 1", Extra: bolt.TxExtra{"db": "neo4j"}}, v44)
+			Expect(t.Flush()).To(BeEmpty())
+
+			out := response(t, &bolt.Success{}, v30)
+			Expect(signatures(out)).To(Equal([]byte{bolt.MsgSuccess, bolt.MsgFailure}))
+		})
+
+		It("should reject options the backend does not know", func() {
+			t := bolt.NewTranslator(v44, v43)
+			request(t, &bolt.Route{Database: "neo4j", ImpersonatedUser: "bob"}, v44)
+			Expect(signatures(t.Flush())).To(Equal([]byte{bolt.MsgFailure}))
+		})
+	})
+
+	Describe("message shapes", func() {
+		It("should translate ROUTE between the 4.3 and 4.4 layouts", func() {
+			t := bolt.NewTranslator(v44, v43)
+			out := request(t, &bolt.Route{Database: "neo4j"}, v44)
+			Expect(out[0].Fields[2]).To(Equal("neo4j"))
+
+			t = bolt.NewTranslator(v43, v50)
+			out = request(t, &bolt.Route{Database: "neo4j"}, v43)
+			Expect(out[0].Fields[2]).To(Equal(map[string]interface{}{"db": "neo4j"}))
+		})
+
+		It("should turn batched PULL into PULL_ALL for Bolt 3 backends", func() {
+			t := bolt.NewTranslator(v44, v30)
+			out := request(t, &bolt.Pull{N: 1000, QID: -1}, v44)
+			Expect(out[0].Fields).To(BeEmpty())
+		})
+
+		It("should answer TELEMETRY itself for backends before 5.4", func() {
+			v58 := bolt.Version{Major: 5, Minor: 8}
+			t := bolt.NewTranslator(v58, v52)
+			Expect(request(t, &bolt.Telemetry{API: 1}, v58)).To(BeEmpty())
+			Expect(signatures(t.Flush())).To(Equal([]byte{bolt.MsgSuccess}))
+		})
+
+		It("should rename the failure code for Bolt 5.7 clients", func() {
+			v57 := bolt.Version{Major: 5, Minor: 7}
+			t := bolt.NewTranslator(v57, v44)
+			request(t, &bolt.Run{Query: "RETURN 1"}, v57)
+			out := response(t, &bolt.Failure{Code: "Neo.ClientError.Statement.SyntaxError", Message: "oops"}, v44)
+			Expect(out[0].Fields[0]).To(HaveKeyWithValue("neo4j_code", "Neo.ClientError.Statement.SyntaxError"))
+			Expect(out[0].Fields[0]).To(HaveKey("gql_status"))
+		})
+	})
+
+	Describe("values", func() {
+		It("should decode RECORD values so they re-encode for the client", func() {
+			t := bolt.NewTranslator(v50, v44)
+			request(t, &bolt.Run{Query: "MATCH (n) RETURN n"}, v50)
+
+			node := &bolt.Node{ID: 7, Labels: []string{"Person"}, Properties: map[string]interface{}{}}
+			enc := bolt.NewEncoder()
+			enc.SetVersion(v44)
+			Expect(enc.Encode(node)).To(Succeed())
+			raw, err := bolt.Unmarshal(enc.Bytes())
+			Expect(err).NotTo(HaveOccurred())
+
+			out, err := t.Response(&bolt.Message{Signature: bolt.MsgRecord, Fields: []interface{}{[]interface{}{raw}}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(out[0].Fields[0]).To(Equal([]interface{}{node}))
+
+			// Encoding for the Bolt 5 client adds the element id
+			structure, err := node.Structure(v50, true)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(structure.Fields).To(HaveLen(4))
+		})
+
+		It("should decode RUN parameters so they re-encode for the backend", func() {
+			t := bolt.NewTranslator(v50, v44)
+			dt := &bolt.DateTime{Seconds: 1700000000, OffsetSeconds: 3600}
+			utc, err := dt.Structure(v50, true)
+			Expect(err).NotTo(HaveOccurred())
+
+			out, err := t.Request(&bolt.Message{Signature: bolt.MsgRun, Fields: []interface{}{
+				"RETURN $t", map[string]interface{}{"t": utc}, map[string]interface{}{},
+			}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(out[0].Fields[1]).To(Equal(map[string]interface{}{"t": dt}))
+		})
+	})
+})
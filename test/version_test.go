@@ -0,0 +1,98 @@
+package test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"neo4j-proxy/pkg/bolt"
+)
+
+var _ = Describe("Bolt Versions", func() {
+	Describe("Decoding proposals", func() {
+		It("should decode major, minor and range", func() {
+			r := bolt.DecodeVersionRange(0x00040404)
+			Expect(r.Max).To(Equal(bolt.Version{Major: 4, Minor: 4}))
+			Expect(r.Range).To(Equal(byte(4)))
+			Expect(r.Encode()).To(Equal(uint32(0x00040404)))
+
+			r = bolt.DecodeVersionRange(0x00000805)
+			Expect(r.Max).To(Equal(bolt.Version{Major: 5, Minor: 8}))
+			Expect(r.Range).To(Equal(byte(0)))
+		})
+
+		It("should check range membership", func() {
+			r := bolt.DecodeVersionRange(0x00020404)
+			Expect(r.Contains(bolt.Version{Major: 4, Minor: 4})).To(BeTrue())
+			Expect(r.Contains(bolt.Version{Major: 4, Minor: 2})).To(BeTrue())
+			Expect(r.Contains(bolt.Version{Major: 4, Minor: 1})).To(BeFalse())
+			Expect(r.Contains(bolt.Version{Major: 5, Minor: 4})).To(BeFalse())
+		})
+	})
+
+	Describe("Selecting a version", func() {
+		It("should pick the newest supported version in the first matching proposal", func() {
+			v, err := bolt.SelectVersion([]uint32{0x00080805, 0x00040404, 0, 0}, bolt.DefaultSupportedVersions)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(v).To(Equal(bolt.Version{Major: 5, Minor: 8}))
+		})
+
+		It("should fall through to later proposals", func() {
+			supported := []bolt.Version{{Major: 4, Minor: 3}, {Major: 4, Minor: 2}}
+			v, err := bolt.SelectVersion([]uint32{0x00000805, 0x00040404, 0, 0}, supported)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(v).To(Equal(bolt.Version{Major: 4, Minor: 3}))
+		})
+
+		It("should accept legacy single-byte proposals", func() {
+			v, err := bolt.SelectVersion([]uint32{bolt.Version4, bolt.Version3, 0, 0}, bolt.DefaultSupportedVersions)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(v).To(Equal(bolt.Version{Major: 4, Minor: 0}))
+		})
+
+		It("should fail when nothing matches", func() {
+			_, err := bolt.SelectVersion([]uint32{0x00000006, 0, 0, 0}, bolt.DefaultSupportedVersions)
+			Expect(err).To(MatchError(bolt.ErrNoCompatibleVersion))
+		})
+	})
+
+	Describe("Proposing versions", func() {
+		It("should fold 4.3+ minor versions into ranges", func() {
+			Expect(bolt.ProposeVersions(bolt.DefaultSupportedVersions)).To(Equal([]uint32{
+				0x00080805, 0x00010404, 0x00000204, 0x00000003,
+			}))
+		})
+
+		It("should keep proposing the oldest version when versions do not fit", func() {
+			supported := []bolt.Version{{Major: 4, Minor: 2}, {Major: 4, Minor: 1}, {Major: 4}, {Major: 3}, {Major: 1}}
+			Expect(bolt.ProposeVersions(supported)).To(Equal([]uint32{
+				0x00000204, 0x00000104, 0x00000004, 0x00000001,
+			}))
+		})
+
+		It("should pad to four proposals", func() {
+			Expect(bolt.ProposeVersions([]bolt.Version{{Major: 3}})).To(Equal([]uint32{0x00000003, 0, 0, 0}))
+		})
+	})
+
+	Describe("Version values", func() {
+		It("should parse and format versions", func() {
+			v, err := bolt.ParseVersion("5.4")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(v).To(Equal(bolt.Version{Major: 5, Minor: 4}))
+			Expect(v.String()).To(Equal("5.4"))
+
+			v, err = bolt.ParseVersion("3")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(v).To(Equal(bolt.Version{Major: 3}))
+
+			_, err = bolt.ParseVersion("five")
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should order versions", func() {
+			Expect(bolt.Version{Major: 5, Minor: 0}.Compare(bolt.Version{Major: 4, Minor: 4})).To(Equal(1))
+			Expect(bolt.Version{Major: 4, Minor: 4}.AtLeast(4, 3)).To(BeTrue())
+			Expect(bolt.Version{Major: 4, Minor: 2}.AtLeast(4, 3)).To(BeFalse())
+		})
+	})
+})